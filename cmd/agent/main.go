@@ -1,48 +1,117 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os"
-	"strconv"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/GGmuzem/yandex-project/internal/agent"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
 	log.Println("Agent starting...")
 
-	// Получение количества воркеров из переменной окружения
-	power, err := strconv.Atoi(os.Getenv("COMPUTING_POWER"))
-	if err != nil || power <= 0 {
-		power = 3 // По умолчанию 3 воркера
-		log.Printf("COMPUTING_POWER не указано или некорректно, используем значение по умолчанию: %d", power)
+	// Настройки из файла (--config или CONFIG_FILE), окружения и флагов
+	cfg := config.MustLoad(config.Default())
+	agent.Config = cfg
+	if cfg.File != "" {
+		log.Printf("Загружен файл конфигурации: %s", cfg.File)
 	}
 
-	// Получение адреса gRPC сервера из переменной окружения
-	grpcServer := os.Getenv("GRPC_SERVER")
-	if grpcServer == "" {
-		grpcPort := os.Getenv("GRPC_PORT")
-		if grpcPort == "" {
-			grpcPort = "50052" // По умолчанию порт 50052
-		}
-		grpcServer = "localhost:" + grpcPort
-		log.Printf("GRPC_SERVER не указано, используем значение по умолчанию: %s", grpcServer)
+	// Количество одновременно выполняемых задач и адрес gRPC сервера оркестратора
+	power := cfg.Agent.ComputingPower
+	grpcServer := cfg.AgentServer()
+	log.Printf("Вычислительная мощность: %d, сервер оркестратора: %s", power, grpcServer)
+
+	// Получаем задачи через поток StreamTasks: оркестратор присылает задачи сразу
+	// по мере готовности, не больше power одновременно
+	client, err := agent.NewGRPCClient(grpcServer, 0)
+	if err != nil {
+		log.Fatalf("Ошибка создания gRPC клиента: %v", err)
 	}
 
-	// Запускаем gRPC воркеры
-	log.Printf("Запуск %d gRPC воркеров...", power)
-	for i := 0; i < power; i++ {
-		go agent.StartGRPCWorker(i, grpcServer)
+	// По SIGINT или SIGTERM агент перестает брать задачи и доделывает текущие
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Не начинаем работу, пока оркестратор не подключил БД и не восстановил очередь задач
+	client.WaitReady(ctx, 2*time.Second)
+
+	// Heartbeat продолжается, пока агент доделывает задачи, иначе оркестратор
+	// сочтет его отключившимся и отдаст задачи другим агентам
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+
+	// Регистрируемся в оркестраторе, чтобы получить уникальный ID, и отправляем heartbeat
+	for ctx.Err() == nil {
+		interval, err := client.Register(ctx, power)
+		if err == nil {
+			go client.RunHeartbeat(heartbeatCtx, interval, power)
+			break
+		}
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("Оркестратор не поддерживает регистрацию агентов: %v", err)
+			break
+		}
+		log.Printf("Ошибка регистрации агента: %v. Повторная попытка через 2s", err)
+		time.Sleep(2 * time.Second)
 	}
 
+	// Воркеры, которые нужно дождаться при остановке
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		if err := client.RunStream(ctx, power); errors.Is(err, agent.ErrStreamUnsupported) {
+			// Оркестратор старой версии: опрашиваем GetTask из отдельных воркеров
+			log.Printf("Запуск %d gRPC воркеров...", power)
+			for i := 0; i < power; i++ {
+				workers.Add(1)
+				go func(id int) {
+					defer workers.Done()
+					agent.StartGRPCWorker(ctx, id, grpcServer)
+				}(i)
+			}
+		}
+	}()
+
+	// Метрики воркеров в формате Prometheus
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		log.Printf("Метрики агента доступны на http://localhost:%d/metrics", cfg.Agent.MetricsPort)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Agent.MetricsPort), mux); err != nil {
+			log.Printf("Ошибка запуска HTTP сервера метрик: %v", err)
+		}
+	}()
+
 	log.Println("Agent started")
 
 	// Если нужно поддерживать обратную совместимость с HTTP
-	if os.Getenv("USE_HTTP") == "true" {
+	if cfg.Agent.UseHTTP {
 		log.Println("Также запускаем HTTP воркеры для обратной совместимости")
-		agent.StartWorker()
+		agent.StartWorker(ctx, &workers)
 	}
 
-	// Бесконечный цикл для поддержания работы агента
-	select {}
+	<-ctx.Done()
+	stop()
+
+	drainTimeout := agent.DrainTimeout()
+	log.Printf("Получен сигнал остановки, ожидаем завершения задач не дольше %v", drainTimeout)
+	if !agent.WaitGroupTimeout(&workers, drainTimeout) {
+		log.Printf("Задачи не завершились за %v, оркестратор вернет их в очередь", drainTimeout)
+	}
+	stopHeartbeat()
+	client.Close()
+	log.Println("Agent stopped")
 }
@@ -1,44 +1,49 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
 	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/metrics"
 	"github.com/GGmuzem/yandex-project/internal/orchestrator"
 	"github.com/joho/godotenv"
 )
 
 // Упрощенная точка входа для запуска сервера
 func main() {
-	// Добавляем флаг для указания порта
-	var port string
-	flag.StringVar(&port, "port", "", "PORT для HTTP сервера")
-	flag.Parse()
-
 	// Загрузка переменных окружения из .env файла, если он существует
 	_ = godotenv.Load()
 
+	// Настройки из файла (--config или CONFIG_FILE), окружения и флагов
+	cfg := config.MustLoad(config.Default())
+	orchestrator.Config = cfg
+	if err := auth.Configure(cfg.Auth); err != nil {
+		log.Fatalf("Ошибка загрузки ключей JWT: %v", err)
+	}
+	if cfg.File != "" {
+		log.Printf("Загружен файл конфигурации: %s", cfg.File)
+	}
+
 	// Логируем версию Go и статус CGO
 	log.Printf("Go Version: %s", runtime.Version())
 	log.Printf("CGO Enabled: %t", false) // Изменяем на false, так как не используем CGO
 
 	// Настройка веб-интерфейса
-	// Получаем пути к директориям из переменных окружения или используем значения по умолчанию
-	staticDir := os.Getenv("STATIC_DIR")
-	if staticDir == "" {
-		staticDir = "./web/static"
-	}
-
-	templateDir := os.Getenv("TEMPLATE_DIR")
-	if templateDir == "" {
-		templateDir = "./web/templates"
-	}
+	staticDir := cfg.HTTP.StaticDir
+	templateDir := cfg.HTTP.TemplateDir
 
 	// Проверяем существование путей
 	if _, err := os.Stat(staticDir); os.IsNotExist(err) {
@@ -76,8 +81,8 @@ func main() {
 	webHandler.SetupWebRoutes()
 
 	// Создаем базу данных
-	dbPath := "./data/calculator.db"
-	db, err := database.New(dbPath)
+	log.Printf("Путь к базе данных: %s", cfg.Database.Path)
+	db, err := database.New(cfg.Database.Path)
 	if err != nil {
 		log.Fatalf("Ошибка создания базы данных: %v", err)
 	}
@@ -90,17 +95,42 @@ func main() {
 		log.Fatalf("Ошибка миграции базы данных: %v", err)
 	}
 
+	// Назначаем администраторов из настроек (auth.admin_logins, auth.bootstrap_admin)
+	if err := auth.BootstrapAdmins(db, cfg.Auth); err != nil {
+		log.Fatalf("Ошибка назначения администраторов: %v", err)
+	}
+
 	// Создаем мьютексы для синхронизации
 	var mu sync.Mutex
 	var tasksMutex sync.Mutex
 
+	// Инициализируем менеджер задач и восстанавливаем незавершенные выражения из БД
+	// до запуска gRPC сервера, чтобы агенты сразу получили восстановленные задачи
+	orchestrator.InitTaskManager()
+
+	// Загружаем реестр агентов, чтобы продолжить нумерацию ID после перезапуска
+	if err := orchestrator.Agents.Load(db); err != nil {
+		log.Printf("Ошибка загрузки реестра агентов: %v", err)
+	}
+
 	// Запускаем gRPC сервер для обработки задач
-	if err := orchestrator.StartGRPCServer(db, &mu, &tasksMutex); err != nil {
+	grpcServer, err := orchestrator.StartGRPCServer(db, &mu, &tasksMutex)
+	if err != nil {
 		log.Fatalf("Ошибка запуска gRPC сервера: %v", err)
 	}
 
-	// Инициализируем менеджер задач
-	orchestrator.InitTaskManager()
+	// Фоновые проверки работают до остановки оркестратора, пока БД еще открыта
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Возвращаем в очередь задачи агентов, не приславших результат до истечения аренды
+	go orchestrator.Manager.StartLeaseReaper(background, time.Second)
+
+	// Отключаем агентов, переставших присылать heartbeat, и возвращаем их задачи в очередь
+	go orchestrator.Agents.StartAgentReaper(background, time.Second)
+
+	// Публикуем готовность оркестратора через grpc.health.v1
+	go orchestrator.StartHealthMonitor(background, db, time.Second)
 
 	// Создаем обработчики аутентификации
 	authHandlers := orchestrator.NewAuthHandlers(db)
@@ -109,31 +139,79 @@ func main() {
 	// Аутентификация
 	http.HandleFunc("/api/v1/register", authHandlers.RegisterHandler)
 	http.HandleFunc("/api/v1/login", authHandlers.LoginHandler)
+	http.HandleFunc("/api/v1/token/refresh", authHandlers.RefreshHandler)
+	http.HandleFunc("/api/v1/logout", authHandlers.AuthMiddleware(authHandlers.LogoutHandler))
+
+	// Ключи API для машинных клиентов (заголовок X-API-Key вместо Bearer токена)
+	http.HandleFunc("/api/v1/api-keys", authHandlers.AuthMiddleware(authHandlers.APIKeysHandler))
+	http.HandleFunc("/api/v1/api-keys/", authHandlers.AuthMiddleware(authHandlers.APIKeysHandler))
+
+	// Открытые ключи для проверки токенов оркестратора другими сервисами
+	http.HandleFunc("/.well-known/jwks.json", auth.JWKSHandler)
 
 	// Выражения
 	http.HandleFunc("/api/v1/calculate", authHandlers.AuthMiddleware(authHandlers.CalculateWithAuthHandler))
 	http.HandleFunc("/api/v1/expressions", authHandlers.AuthMiddleware(authHandlers.ListExpressionsWithAuthHandler))
 	http.HandleFunc("/api/v1/expressions/", authHandlers.AuthMiddleware(authHandlers.GetExpressionWithAuthHandler))
+	http.HandleFunc("/api/v1/me/usage", authHandlers.AuthMiddleware(authHandlers.UsageHandler))
+
+	// Сохраненные формулы пользователя и их вычисление с переданными значениями параметров
+	http.HandleFunc("/api/v1/formulas", authHandlers.AuthMiddleware(authHandlers.FormulasHandler))
+	http.HandleFunc("/api/v1/formulas/", authHandlers.AuthMiddleware(authHandlers.FormulasHandler))
+
+	// Административный API для диагностики планировщика и агентов, доступен пользователям с ролью admin
+	adminHandlers := orchestrator.NewAdminHandlers(db)
+	http.HandleFunc("/api/v1/admin/", adminHandlers.AdminOnly(adminHandlers.Handler))
 
 	// Внутренний API для агентов
 	http.HandleFunc("/internal/task", orchestrator.TaskHandler)
 
-	// Проверка статуса сервера
-	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	// Проверки жизнеспособности и готовности (/status оставлен для совместимости)
+	http.HandleFunc("/healthz", orchestrator.HealthzHandler)
+	http.HandleFunc("/status", orchestrator.HealthzHandler)
+	http.HandleFunc("/readyz", orchestrator.ReadyzHandler(db))
+
+	// Метрики в формате Prometheus
+	http.Handle("/metrics", metrics.Handler())
 
 	// Запускаем HTTP сервер
-	serverAddr := ":8080"
+	serverAddr := fmt.Sprintf(":%d", cfg.HTTP.Port)
+
+	httpServer := &http.Server{Addr: serverAddr}
+	go func() {
+		log.Printf("HTTP сервер запущен на http://localhost%s", serverAddr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Ошибка HTTP сервера: %v", err)
+		}
+	}()
+
+	// Ждем SIGINT или SIGTERM (например, при обновлении контейнера)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	drainTimeout := orchestrator.DrainTimeout()
+	log.Printf("Получен сигнал остановки, ожидаем завершения выданных задач не дольше %v", drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	// Перестаем принимать выражения и выдавать задачи, ждем результаты уже выданных.
+	// Невыполненные задачи остаются в БД и будут восстановлены после перезапуска
+	orchestrator.BeginShutdown()
+	if err := orchestrator.Manager.WaitIdle(drainCtx); err != nil {
+		log.Printf("Не все выданные задачи завершились за %v: %v", drainTimeout, err)
+	}
 
-	// Используем порт из флага командной строки или из переменной окружения
-	if port != "" {
-		serverAddr = ":" + port
-	} else if envPort := os.Getenv("HTTP_PORT"); envPort != "" {
-		serverAddr = ":" + envPort
+	// Серверам дается собственный срок: даже если ожидание задач исчерпало drainTimeout,
+	// запросы, уже находящиеся в обработке (например, SubmitResult), должны завершиться
+	serverCtx, cancelServers := context.WithTimeout(context.Background(), orchestrator.ServerShutdownGrace())
+	defer cancelServers()
+	if err := httpServer.Shutdown(serverCtx); err != nil {
+		log.Printf("HTTP сервер не остановился за отведенное время: %v", err)
 	}
+	orchestrator.StopGRPCServer(serverCtx, grpcServer)
+	stopBackground()
 
-	log.Printf("HTTP сервер запущен на http://localhost%s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, nil))
+	log.Println("Оркестратор остановлен")
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
 )
 
 func main() {
@@ -45,7 +47,11 @@ func main() {
 		fmt.Fprintf(w, `{"status":"ok"}`)
 	})
 
-	// Запускаем HTTP сервер
-	log.Println("Запуск тестового сервера на порту 8082")
-	log.Fatal(http.ListenAndServe(":8082", nil))
+	// Запускаем HTTP сервер. Тестовый сервер по умолчанию слушает порт 8082,
+	// чтобы не конфликтовать с оркестратором
+	defaults := config.Default()
+	defaults.HTTP.Port = 8082
+	cfg := config.MustLoad(defaults)
+	log.Printf("Запуск тестового сервера на порту %d", cfg.HTTP.Port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", cfg.HTTP.Port), nil))
 }
@@ -2,14 +2,19 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 
+	"github.com/GGmuzem/yandex-project/internal/config"
 	"github.com/GGmuzem/yandex-project/pkg/models"
 )
 
+// Config настройки агента, загружаются при запуске из файла, окружения и флагов
+var Config = config.Default()
+
 // Agent представляет агента, который выполняет задачи
 type Agent struct {
 	ID         int
@@ -20,11 +25,21 @@ type Agent struct {
 type Result struct {
 	TaskID       int
 	ExpressionID string
+	LeaseID      string // Аренда задачи, которую нужно вернуть оркестратору
 	Value        float64
 	Success      bool
+	ErrorCode    string // Код ошибки из models.TaskError*, если Success=false
 	ErrorMessage string
 }
 
+// TaskResult преобразует результат в модель для отправки оркестратору
+func (r Result) TaskResult() *models.TaskResult {
+	if r.Success {
+		return &models.TaskResult{ID: r.TaskID, Result: r.Value, LeaseID: r.LeaseID}
+	}
+	return &models.TaskResult{ID: r.TaskID, LeaseID: r.LeaseID, ErrorCode: r.ErrorCode, Error: r.ErrorMessage}
+}
+
 // NewAgent создает нового агента
 func NewAgent(id int, serverAddr string) (*Agent, error) {
 	client, err := NewGRPCClient(serverAddr, int32(id))
@@ -38,186 +53,192 @@ func NewAgent(id int, serverAddr string) (*Agent, error) {
 	}, nil
 }
 
-// Run запускает агента и начинает выполнение задач
+// Run запускает агента и начинает выполнение задач.
+// Задачи получаются через поток StreamTasks; если оркестратор его не поддерживает,
+// агент опрашивает GetTask. После отмены ctx агент доделывает текущие задачи
+// и отправляет их результаты, новые задачи не берет.
 func (a *Agent) Run(ctx context.Context) {
-	log.Printf("Агент #%d: запущен (ID=%d)", a.grpcClient.agentID, a.ID)
+	log.Printf("Агент #%d: запущен (ID=%d)", a.grpcClient.AgentID(), a.ID)
+	if err := a.grpcClient.RunStream(ctx, 1); !errors.Is(err, ErrStreamUnsupported) {
+		log.Printf("Агент #%d: получен сигнал остановки", a.grpcClient.AgentID())
+		return
+	}
 	retryInterval := 2 * time.Second
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("Агент #%d: получен сигнал остановки", a.grpcClient.agentID)
+			log.Printf("Агент #%d: получен сигнал остановки", a.grpcClient.AgentID())
 			return
 		default:
 			// Запрашиваем задачу от оркестратора
 			task, err := a.grpcClient.GetTask()
 			if err != nil {
 				log.Printf("Агент #%d: ошибка при получении задачи: %v. Повторная попытка через %v",
-					a.grpcClient.agentID, err, retryInterval)
-				time.Sleep(retryInterval)
+					a.grpcClient.AgentID(), err, retryInterval)
+				sleepCtx(ctx, retryInterval)
 				continue
 			}
 
 			// Если задач нет, ждем и пробуем снова
-			if (task == models.Task{}) {
-				log.Printf("Агент #%d: нет задач, ожидание %v", a.grpcClient.agentID, retryInterval)
-				time.Sleep(retryInterval)
+			if task.ID == 0 {
+				log.Printf("Агент #%d: нет задач, ожидание %v", a.grpcClient.AgentID(), retryInterval)
+				sleepCtx(ctx, retryInterval)
 				continue
 			}
 
 			// Вычисляем результат
+			start := time.Now()
 			result := a.computeTask(task)
 
 			// Имитируем длительное время вычисления, если указано
 			if task.OperationTime > 0 {
 				log.Printf("Агент #%d: имитация длительного вычисления задачи #%d (%d мс)",
-					a.grpcClient.agentID, task.ID, task.OperationTime)
+					a.grpcClient.AgentID(), task.ID, task.OperationTime)
 				time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
 			}
+			observeTask(a.ID, start, !result.Success)
 
-			// Отправляем результат оркестратору
-			taskResult := &models.TaskResult{
-				ID:     result.TaskID,
-				Result: result.Value,
-			}
+			// Отправляем результат оркестратору (ошибка вычисления тоже результат)
+			taskResult := result.TaskResult()
 			err = a.grpcClient.SubmitResult(taskResult, task.ExpressionID)
 			if err != nil {
 				log.Printf("Агент #%d: ошибка при отправке результата задачи #%d: %v",
-					a.grpcClient.agentID, task.ID, err)
+					a.grpcClient.AgentID(), task.ID, err)
 				continue
 			}
 			log.Printf("Агент #%d: результат задачи #%d успешно отправлен (результат = %f)",
-				a.grpcClient.agentID, task.ID, result.Value)
+				a.grpcClient.AgentID(), task.ID, result.Value)
 		}
 	}
 }
 
 // computeTask вычисляет результат для данной задачи
 func (a *Agent) computeTask(task models.Task) Result {
-	log.Printf("Агент #%d: начало вычисления задачи #%d (операция: '%s', аргументы: '%s', '%s')",
-		a.grpcClient.agentID, task.ID, task.Operation, task.Arg1, task.Arg2)
+	log.Printf("Агент #%d: начало вычисления задачи #%d (операция: '%s', аргументы: %v)",
+		a.grpcClient.AgentID(), task.ID, task.Operation, task.Operands())
 
-	var value float64
 	var success bool
-	var errorMsg string
+	var errorCode, errorMsg string
 
 	// Проверяем, что аргументы не пустые
-	if task.Arg1 == "" || task.Arg2 == "" {
+	if !task.IsFunction() && (task.Arg1 == "" || task.Arg2 == "") {
 		errorMsg = "пустые аргументы в задаче"
-		log.Printf("Агент #%d: %s #%d: '%s', '%s'", a.grpcClient.agentID, errorMsg, task.ID, task.Arg1, task.Arg2)
+		log.Printf("Агент #%d: %s #%d: '%s', '%s'", a.grpcClient.AgentID(), errorMsg, task.ID, task.Arg1, task.Arg2)
 		return Result{
 			TaskID:       task.ID,
 			ExpressionID: task.ExpressionID,
+			LeaseID:      task.LeaseID,
 			Value:        0,
 			Success:      false,
+			ErrorCode:    models.TaskErrorInvalidArgument,
 			ErrorMessage: errorMsg,
 		}
 	}
 
 	// Преобразуем аргументы в числа
-	arg1, err1 := strconv.ParseFloat(task.Arg1, 64)
-	arg2, err2 := strconv.ParseFloat(task.Arg2, 64)
-
-	if err1 != nil || err2 != nil {
-		errorMsg = fmt.Sprintf("ошибка преобразования аргументов: arg1=%v, arg2=%v", err1, err2)
-		log.Printf("Агент #%d: %s", a.grpcClient.agentID, errorMsg)
-		return Result{
-			TaskID:       task.ID,
-			ExpressionID: task.ExpressionID,
-			Value:        0,
-			Success:      false,
-			ErrorMessage: errorMsg,
+	operands := task.Operands()
+	args := make([]float64, len(operands))
+	for i, operand := range operands {
+		arg, err := strconv.ParseFloat(operand, 64)
+		if err != nil {
+			errorMsg = fmt.Sprintf("ошибка преобразования аргумента %d: %v", i+1, err)
+			log.Printf("Агент #%d: %s", a.grpcClient.AgentID(), errorMsg)
+			return Result{
+				TaskID:       task.ID,
+				ExpressionID: task.ExpressionID,
+				LeaseID:      task.LeaseID,
+				Value:        0,
+				Success:      false,
+				ErrorCode:    models.TaskErrorInvalidArgument,
+				ErrorMessage: errorMsg,
+			}
 		}
+		args[i] = arg
 	}
 
 	// Выполняем операцию
-	switch task.Operation {
-	case "+":
-		value = arg1 + arg2
+	value, err := Evaluate(task.Operation, args)
+	if err == nil {
 		success = true
-	case "-":
-		value = arg1 - arg2
-		success = true
-	case "*":
-		value = arg1 * arg2
-		success = true
-	case "/":
-		if arg2 == 0 {
-			errorMsg = "деление на ноль"
-			success = false
-		} else {
-			value = arg1 / arg2
-			success = true
+	} else {
+		errorCode = models.TaskErrorInvalidArgument
+		var computeErr *ComputeError
+		if errors.As(err, &computeErr) {
+			errorCode = computeErr.Code
 		}
-	default:
-		errorMsg = fmt.Sprintf("неизвестная операция: %s", task.Operation)
-		success = false
+		errorMsg = err.Error()
 	}
 
 	log.Printf("Агент #%d: завершено вычисление задачи #%d, результат: %f, успех: %v",
-		a.grpcClient.agentID, task.ID, value, success)
+		a.grpcClient.AgentID(), task.ID, value, success)
 
 	return Result{
 		TaskID:       task.ID,
 		ExpressionID: task.ExpressionID,
+		LeaseID:      task.LeaseID,
 		Value:        value,
 		Success:      success,
+		ErrorCode:    errorCode,
 		ErrorMessage: errorMsg,
 	}
 }
 
 // StartProcessing запускает обработку задач
 func (a *Agent) StartProcessing() {
+	if err := a.grpcClient.RunStream(context.Background(), 1); !errors.Is(err, ErrStreamUnsupported) {
+		return
+	}
+
 	for {
 		// Получаем задачу от оркестратора
 		task, err := a.grpcClient.GetTask()
 		if err != nil {
 			// Если ошибка - ждем и пробуем снова
-			log.Printf("Воркер gRPC %d: Ошибка получения задачи: %v", a.grpcClient.agentID, err)
+			log.Printf("Воркер gRPC %d: Ошибка получения задачи: %v", a.grpcClient.AgentID(), err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
 		// Если произошла ошибка или нет задач, продолжаем опрашивать сервер
 		if err != nil {
-			log.Printf("Воркер gRPC %d: Ошибка получения задачи: %v", a.grpcClient.agentID, err)
+			log.Printf("Воркер gRPC %d: Ошибка получения задачи: %v", a.grpcClient.AgentID(), err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
 		// Проверяем, что задача не пустая
 		if task.ID == 0 && task.Operation == "" && task.Arg1 == "" && task.Arg2 == "" {
-			log.Printf("Воркер gRPC %d: Получена пустая задача, ожидание", a.grpcClient.agentID)
+			log.Printf("Воркер gRPC %d: Получена пустая задача, ожидание", a.grpcClient.AgentID())
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
 
 		// Обрабатываем задачу
-		log.Printf("Воркер gRPC %d: Начало выполнения задачи #%d", a.grpcClient.agentID, task.ID)
+		log.Printf("Воркер gRPC %d: Начало выполнения задачи #%d", a.grpcClient.AgentID(), task.ID)
 
 		// Используем существующую функцию computeTask
+		start := time.Now()
 		result := a.computeTask(task)
 
 		// Если имитация длительных вычислений
 		if task.OperationTime > 0 {
 			log.Printf("Воркер gRPC %d: имитация длительного вычисления задачи #%d (%d мс)",
-				a.grpcClient.agentID, task.ID, task.OperationTime)
+				a.grpcClient.AgentID(), task.ID, task.OperationTime)
 			time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
 		}
+		observeTask(a.ID, start, !result.Success)
 
 		// Формируем объект TaskResult в соответствии с определением из models.go
-		taskResult := &models.TaskResult{
-			ID:     result.TaskID,
-			Result: result.Value,
-		}
+		taskResult := result.TaskResult()
 
 		log.Printf("Воркер gRPC %d: Успешно выполнена задача #%d с результатом %f",
-			a.grpcClient.agentID, task.ID, result.Value)
+			a.grpcClient.AgentID(), task.ID, result.Value)
 
 		// Отправляем результат оркестратору, используя ExpressionID из результата
 		if err := a.grpcClient.SubmitResult(taskResult, result.ExpressionID); err != nil {
 			log.Printf("Воркер gRPC %d: Ошибка отправки результата задачи #%d: %v",
-				a.grpcClient.agentID, task.ID, err)
+				a.grpcClient.AgentID(), task.ID, err)
 		}
 	}
 }
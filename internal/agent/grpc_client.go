@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/GGmuzem/yandex-project/pkg/calculator"
@@ -14,9 +15,12 @@ import (
 
 // GRPCClient клиент для gRPC взаимодействия с оркестратором
 type GRPCClient struct {
-	client  calculator.CalculatorClient
-	conn    *grpc.ClientConn
-	agentID int32
+	client   calculator.CalculatorClient
+	conn     *grpc.ClientConn
+	agentID  atomic.Int32 // Меняется при повторной регистрации из горутины heartbeat
+	inFlight atomic.Int32 // Задачи, которые агент выполняет в данный момент
+
+	drainTimeout time.Duration // Сколько ждать выполняемые задачи при остановке
 }
 
 // NewGRPCClient создает новый gRPC клиент
@@ -30,11 +34,18 @@ func NewGRPCClient(serverAddr string, agentID int32) (*GRPCClient, error) {
 	// Создаем клиента
 	client := calculator.NewCalculatorClient(conn)
 
-	return &GRPCClient{
-		client:  client,
-		conn:    conn,
-		agentID: agentID,
-	}, nil
+	gc := &GRPCClient{
+		client:       client,
+		conn:         conn,
+		drainTimeout: DrainTimeout(),
+	}
+	gc.agentID.Store(agentID)
+	return gc, nil
+}
+
+// AgentID возвращает ID агента, выданный оркестратором при регистрации
+func (c *GRPCClient) AgentID() int32 {
+	return c.agentID.Load()
 }
 
 // Close закрывает соединение с сервером
@@ -44,7 +55,7 @@ func (c *GRPCClient) Close() error {
 
 // GetTask получает задачу от оркестратора
 func (gc *GRPCClient) GetTask() (models.Task, error) {
-	log.Printf("Агент #%d: Запрос задачи от сервера", gc.agentID)
+	log.Printf("Агент #%d: Запрос задачи от сервера", gc.AgentID())
 	
 	// Создаем контекст с таймаутом
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -60,27 +71,27 @@ func (gc *GRPCClient) GetTask() (models.Task, error) {
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		// Проверяем, что клиент инициализирован
 		if gc.client == nil {
-			log.Printf("Агент #%d: Ошибка - GRPC-клиент не инициализирован", gc.agentID)
+			log.Printf("Агент #%d: Ошибка - GRPC-клиент не инициализирован", gc.AgentID())
 			return models.Task{}, fmt.Errorf("GRPC-клиент не инициализирован")
 		}
 		
-		log.Printf("Агент #%d: Отправка GetTask запроса (попытка %d)", gc.agentID, attempt)
+		log.Printf("Агент #%d: Отправка GetTask запроса (попытка %d)", gc.AgentID(), attempt)
 		resp, err = gc.client.GetTask(ctx, &calculator.GetTaskRequest{
-			AgentID: int32(gc.agentID),
+			AgentId: gc.AgentID(),
 		})
 		
 		if err == nil {
-			log.Printf("Агент #%d: Успешно получен ответ от сервера", gc.agentID)
+			log.Printf("Агент #%d: Успешно получен ответ от сервера", gc.AgentID())
 			break // Успешно получили ответ
 		}
 		
 		log.Printf("Агент #%d: Ошибка при получении задачи: %v (попытка %d из %d)", 
-			gc.agentID, err, attempt, maxRetries)
+			gc.AgentID(), err, attempt, maxRetries)
 		
 		if attempt < maxRetries {
 			// Ждем перед следующей попыткой
 			backoff := time.Duration(attempt*500) * time.Millisecond
-			log.Printf("Агент #%d: Ожидание %v перед повторной попыткой", gc.agentID, backoff)
+			log.Printf("Агент #%d: Ожидание %v перед повторной попыткой", gc.AgentID(), backoff)
 			time.Sleep(backoff)
 		}
 	}
@@ -90,26 +101,28 @@ func (gc *GRPCClient) GetTask() (models.Task, error) {
 	}
 	
 	log.Printf("Агент #%d: Получен ответ от сервера: ID=%d, Arg1='%s', Arg2='%s', Operation='%s', ExpressionID='%s', OperationTime=%d", 
-		gc.agentID, resp.ID, resp.Arg1, resp.Arg2, resp.Operation, resp.ExpressionID, resp.OperationTime)
+		gc.AgentID(), resp.Id, resp.Arg1, resp.Arg2, resp.Operation, resp.ExpressionId, resp.OperationTime)
 	
 	// Проверяем, что задача не пустая
-	if resp.ID == 0 && resp.Operation == "" {
-		log.Printf("Агент #%d: Получен пустой ответ от сервера (нет готовых задач), запрошу задачу позже", gc.agentID)
+	if resp.Id == 0 && resp.Operation == "" {
+		log.Printf("Агент #%d: Получен пустой ответ от сервера (нет готовых задач), запрошу задачу позже", gc.AgentID())
 		return models.Task{}, nil
 	}
 	
 	// Преобразуем в нашу модель задачи
 	task := models.Task{
-		ID:            int(resp.ID),
+		ID:            int(resp.Id),
 		Arg1:          resp.Arg1,
 		Arg2:          resp.Arg2,
 		Operation:     resp.Operation,
-		ExpressionID:  resp.ExpressionID,
+		ExpressionID:  resp.ExpressionId,
 		OperationTime: int(resp.OperationTime),
+		LeaseID:       resp.LeaseId,
+		Args:          resp.Args,
 	}
 
 	log.Printf("Агент #%d: Успешно получена задача: ID=%d, Arg1='%s', Arg2='%s', Operation='%s', ExpressionID='%s'",
-		gc.agentID, task.ID, task.Arg1, task.Arg2, task.Operation, task.ExpressionID)
+		gc.AgentID(), task.ID, task.Arg1, task.Arg2, task.Operation, task.ExpressionID)
 
 	return task, nil
 }
@@ -121,14 +134,10 @@ func (c *GRPCClient) SubmitResult(result *models.TaskResult, expressionID string
 	defer cancel()
 
 	// Преобразуем результат в protobuf формат
-	pbResult := &calculator.TaskResult{
-		ID:           int32(result.ID),
-		Result:       result.Result,
-		ExpressionID: expressionID,
-	}
+	pbResult := calculator.ConvertTaskResultToGRPC(*result, expressionID)
 
 	log.Printf("Агент #%d: Отправка результата задачи #%d: %f, выражение: %s", 
-		c.agentID, result.ID, result.Result, expressionID)
+		c.AgentID(), result.ID, result.Result, expressionID)
 
 	// Добавляем механизм повторных попыток при ошибке связи
 	var resp *calculator.SubmitResultResponse
@@ -141,36 +150,37 @@ func (c *GRPCClient) SubmitResult(result *models.TaskResult, expressionID string
 			break
 		}
 		log.Printf("Агент #%d: Ошибка отправки результата задачи #%d (попытка %d/%d): %v", 
-			c.agentID, result.ID, retries+1, maxRetries, err)
+			c.AgentID(), result.ID, retries+1, maxRetries, err)
 		if retries < maxRetries-1 {
 			// Увеличиваем интервал между попытками (экспоненциальный бэкофф)
 			backoff := time.Duration(500*(1<<retries)) * time.Millisecond
-			log.Printf("Агент #%d: Ожидание %v перед следующей попыткой", c.agentID, backoff)
+			log.Printf("Агент #%d: Ожидание %v перед следующей попыткой", c.AgentID(), backoff)
 			time.Sleep(backoff)
 		}
 	}
 
 	if err != nil {
 		log.Printf("Агент #%d: Не удалось отправить результат задачи #%d после %d попыток: %v", 
-			c.agentID, result.ID, maxRetries, err)
+			c.AgentID(), result.ID, maxRetries, err)
 		return err
 	}
 
 	log.Printf("Агент #%d: Ответ сервера на результат задачи #%d: success=%v, message=%s", 
-		c.agentID, result.ID, resp.Success, resp.Message)
+		c.AgentID(), result.ID, resp.Success, resp.Message)
 
 	if !resp.Success {
 		log.Printf("Агент #%d: Сервер отклонил результат задачи #%d: %s", 
-			c.agentID, result.ID, resp.Message)
+			c.AgentID(), result.ID, resp.Message)
 		return fmt.Errorf("сервер отклонил результат: %s", resp.Message)
 	}
 
-	log.Printf("Агент #%d: Результат задачи #%d успешно отправлен", c.agentID, result.ID)
+	log.Printf("Агент #%d: Результат задачи #%d успешно отправлен", c.AgentID(), result.ID)
 	return nil
 }
 
-// StartGRPCWorker запускает воркер, взаимодействующий с оркестратором через gRPC
-func StartGRPCWorker(id int, serverAddr string) {
+// StartGRPCWorker запускает воркер, взаимодействующий с оркестратором через gRPC.
+// После отмены ctx воркер завершает текущую задачу и останавливается.
+func StartGRPCWorker(ctx context.Context, id int, serverAddr string) {
 	// Создаем клиента gRPC
 	client, err := NewGRPCClient(serverAddr, int32(id))
 	if err != nil {
@@ -190,13 +200,10 @@ func StartGRPCWorker(id int, serverAddr string) {
 			id, task.ID, task.Arg1, task.Operation, task.Arg2)
 
 		// Вычисляем результат
-		result := computeTask(task)
+		result, computeErr := computeTask(task)
 
 		// Результат задачи
-		taskResult := &models.TaskResult{
-			ID:     task.ID,
-			Result: result,
-		}
+		taskResult := newTaskResult(task, result, computeErr)
 
 		// Отправляем результат
 		err = client.SubmitResult(taskResult, task.ExpressionID)
@@ -209,21 +216,21 @@ func StartGRPCWorker(id int, serverAddr string) {
 		log.Printf("Воркер gRPC %d: ТЕСТ - не удалось получить задачу: %v", id, err)
 	}
 
-	for {
+	for ctx.Err() == nil {
 		// Запрашиваем задачу от оркестратора
 		task, err := client.GetTask()
 		if err != nil {
 			log.Printf("Воркер gRPC %d: ошибка получения задачи: %v", id, err)
 			// Увеличиваем интервал при ошибке связи
-			time.Sleep(retryInterval * 2)
+			sleepCtx(ctx, retryInterval*2)
 			continue
 		}
 
 		// Если задач нет, ждем и пробуем снова
-		if task == (models.Task{}) {
+		if task.ID == 0 {
 			// Динамически регулируем интервал опроса в зависимости от загрузки
 			log.Printf("Воркер gRPC %d: нет готовых задач, ожидание %v", id, retryInterval)
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			// Постепенно увеличиваем интервал при отсутствии задач, но не более 5 секунд
 			if retryInterval < 5*time.Second {
 				retryInterval += 100 * time.Millisecond
@@ -235,9 +242,9 @@ func StartGRPCWorker(id int, serverAddr string) {
 		}
 
 		// Проверка на пустые аргументы
-		if task.Arg1 == "" || task.Arg2 == "" {
+		if !task.IsFunction() && (task.Arg1 == "" || task.Arg2 == "") {
 			log.Printf("Воркер gRPC %d: ошибка - пустые аргументы в задаче #%d: '%s', '%s'", id, task.ID, task.Arg1, task.Arg2)
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 
@@ -245,19 +252,18 @@ func StartGRPCWorker(id int, serverAddr string) {
 			id, task.ID, task.Arg1, task.Operation, task.Arg2, task.ExpressionID)
 
 		// Вычисляем результат
-		result := computeTask(task)
+		start := time.Now()
+		result, computeErr := computeTask(task)
 
 		// Имитируем длительное время вычисления
 		if task.OperationTime > 0 {
 			log.Printf("Воркер gRPC %d: выполняется задача #%d (%d мс)...", id, task.ID, task.OperationTime)
 			time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
 		}
+		observeTask(id, start, computeErr != nil)
 
-		// Результат задачи
-		taskResult := &models.TaskResult{
-			ID:     task.ID,
-			Result: result,
-		}
+		// Результат задачи (при ошибке вычисления содержит код и описание ошибки)
+		taskResult := newTaskResult(task, result, computeErr)
 
 		log.Printf("Воркер gRPC %d: готов результат задачи #%d: %f", id, task.ID, result)
 
@@ -266,9 +272,10 @@ func StartGRPCWorker(id int, serverAddr string) {
 		if err != nil {
 			log.Printf("Воркер gRPC %d: не удалось отправить результат задачи #%d: %v", id, task.ID, err)
 			// При ошибке отправки результата делаем паузу перед следующей задачей
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 		} else {
 			log.Printf("Воркер gRPC %d: задача #%d успешно завершена, результат: %f", id, task.ID, result)
 		}
 	}
+	log.Printf("Воркер gRPC %d: остановлен", id)
 }
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// WaitReady ждет, пока оркестратор сообщит о готовности через grpc.health.v1,
+// проверяя состояние с интервалом interval. Если оркестратор не поддерживает
+// проверку здоровья, ожидание пропускается. Возвращает ошибку только при отмене ctx.
+func (c *GRPCClient) WaitReady(ctx context.Context, interval time.Duration) error {
+	health := healthpb.NewHealthClient(c.conn)
+
+	for {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+		switch {
+		case err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING:
+			log.Printf("Агент #%d: оркестратор готов к работе", c.AgentID())
+			return nil
+		case status.Code(err) == codes.Unimplemented:
+			log.Printf("Агент #%d: оркестратор не поддерживает grpc.health.v1, ожидание готовности пропущено", c.AgentID())
+			return nil
+		case err != nil:
+			log.Printf("Агент #%d: оркестратор недоступен: %v. Повторная проверка через %v", c.AgentID(), err, interval)
+		default:
+			log.Printf("Агент #%d: оркестратор не готов (%s). Повторная проверка через %v", c.AgentID(), resp.Status, interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
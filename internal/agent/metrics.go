@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/metrics"
+)
+
+// Метрики агента, которые отдаются на /metrics
+var (
+	tasksProcessed = metrics.NewCounterVec("calculator_agent_tasks_processed_total",
+		"Задачи, выполненные воркерами агента, по исходу вычисления (ok или error)", "worker", "outcome")
+	computeSeconds = metrics.NewHistogramVec("calculator_agent_compute_seconds",
+		"Время выполнения задачи воркером, включая имитацию TIME_*_MS", metrics.DurationBuckets, "worker")
+)
+
+// observeTask учитывает задачу, выполненную воркером worker начиная с момента start
+func observeTask(worker int, start time.Time, failed bool) {
+	label := strconv.Itoa(worker)
+	outcome := "ok"
+	if failed {
+		outcome = "error"
+	}
+	tasksProcessed.Inc(label, outcome)
+	computeSeconds.Observe(time.Since(start).Seconds(), label)
+}
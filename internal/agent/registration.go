@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+)
+
+// Version версия агента, сообщаемая оркестратору при регистрации.
+// Задается при сборке: -ldflags "-X github.com/GGmuzem/yandex-project/internal/agent.Version=..."
+var Version = "dev"
+
+// Register регистрирует агента в оркестраторе и запоминает назначенный ID.
+// Повторная регистрация сохраняет ранее выданный ID. Агент сообщает операции, которые
+// умеет выполнять (agent.operations), и получает только задачи с ними. Возвращает интервал heartbeat.
+func (c *GRPCClient) Register(ctx context.Context, capacity int) (time.Duration, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	ops := Config.Agent.SupportedOperations()
+	resp, err := c.client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{
+		AgentId:    c.AgentID(),
+		Hostname:   hostname,
+		Version:    Version,
+		Capacity:   int32(capacity),
+		Operations: ops,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Повторная регистрация возвращает тот же ID, и его не нужно перезаписывать
+	if resp.AgentId != c.AgentID() {
+		c.agentID.Store(resp.AgentId)
+	}
+	log.Printf("Агент #%d: зарегистрирован в оркестраторе (хост %s, версия %s, емкость %d, операции %v)",
+		c.AgentID(), hostname, Version, capacity, ops)
+	return time.Duration(resp.HeartbeatIntervalMs) * time.Millisecond, nil
+}
+
+// RunHeartbeat периодически сообщает оркестратору, что агент жив, и сколько задач он выполняет.
+// Если оркестратор не знает агента, агент регистрируется заново с тем же ID. Работает до отмены ctx.
+func (c *GRPCClient) RunHeartbeat(ctx context.Context, interval time.Duration, capacity int) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		resp, err := c.client.Heartbeat(ctx, &calculator.HeartbeatRequest{
+			AgentId:  c.AgentID(),
+			InFlight: c.inFlight.Load(),
+		})
+		if err != nil {
+			log.Printf("Агент #%d: ошибка отправки heartbeat: %v", c.AgentID(), err)
+			continue
+		}
+		if !resp.Known {
+			log.Printf("Агент #%d: оркестратор не знает агента, повторная регистрация", c.AgentID())
+			if _, err := c.Register(ctx, capacity); err != nil {
+				log.Printf("Агент #%d: ошибка повторной регистрации: %v", c.AgentID(), err)
+			}
+		}
+	}
+}
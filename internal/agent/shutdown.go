@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DrainTimeout время, которое агент ждет завершения выполняемых задач при остановке
+func DrainTimeout() time.Duration {
+	return time.Duration(Config.Shutdown.TimeoutMs) * time.Millisecond
+}
+
+// SetDrainTimeout задает время ожидания выполняемых задач при остановке агента
+func (c *GRPCClient) SetDrainTimeout(timeout time.Duration) {
+	c.drainTimeout = timeout
+}
+
+// WaitGroupTimeout ждет wg не дольше timeout. Возвращает false, если время истекло.
+func WaitGroupTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// sleepCtx ждет d или отмены ctx. Возвращает false, если ctx отменен.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
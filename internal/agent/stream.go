@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrStreamUnsupported оркестратор не поддерживает потоковую выдачу задач,
+// агенту нужно перейти на опрос через GetTask
+var ErrStreamUnsupported = errors.New("оркестратор не поддерживает StreamTasks")
+
+// RunStream получает задачи через поток StreamTasks и выполняет до capacity задач одновременно.
+// При обрыве соединения поток открывается заново. Работает до отмены ctx.
+// Возвращает ErrStreamUnsupported, если оркестратор не реализует StreamTasks.
+func (c *GRPCClient) RunStream(ctx context.Context, capacity int) error {
+	retryInterval := time.Second
+
+	for {
+		err := c.streamTasks(ctx, capacity)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("Агент #%d: оркестратор не поддерживает поток задач: %v", c.AgentID(), err)
+			return ErrStreamUnsupported
+		}
+
+		log.Printf("Агент #%d: поток задач прерван: %v. Переподключение через %v", c.AgentID(), err, retryInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// streamTasks открывает поток, объявляет емкость и выполняет присланные задачи,
+// возвращая результат вместе с освободившимся слотом.
+// После отмены ctx агент не берет новые задачи, дожидается выполняемых (не дольше
+// drainTimeout) и закрывает поток; невыполненные задачи оркестратор вернет в очередь.
+func (c *GRPCClient) streamTasks(ctx context.Context, capacity int) error {
+	// Поток живет дольше ctx, чтобы успеть отправить результаты выполняемых задач
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.client.StreamTasks(streamCtx)
+	if err != nil {
+		return err
+	}
+
+	var sendMu sync.Mutex
+	send := func(msg *calculator.AgentMessage) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(msg)
+	}
+
+	var wg sync.WaitGroup
+	var draining atomic.Bool
+
+	// Номера свободных слотов, по которым задачи учитываются в метриках воркеров
+	slots := make(chan int, capacity)
+	for i := 0; i < capacity; i++ {
+		slots <- i
+	}
+
+	if err := send(&calculator.AgentMessage{AgentId: c.AgentID(), Capacity: int32(capacity)}); err != nil {
+		return err
+	}
+	log.Printf("Агент #%d: открыт поток задач, емкость %d", c.AgentID(), capacity)
+
+	// Читаем поток в отдельной горутине, чтобы одновременно следить за ctx
+	type received struct {
+		msg *calculator.ServerMessage
+		err error
+	}
+	messages := make(chan received)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			select {
+			case messages <- received{msg, err}:
+			case <-streamCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var in received
+		select {
+		case <-ctx.Done():
+			draining.Store(true)
+			log.Printf("Агент #%d: остановка, ожидаем завершения %d задач не дольше %v",
+				c.AgentID(), c.inFlight.Load(), c.drainTimeout)
+			if !WaitGroupTimeout(&wg, c.drainTimeout) {
+				log.Printf("Агент #%d: задачи не завершились за %v, оркестратор вернет их в очередь",
+					c.AgentID(), c.drainTimeout)
+				return ctx.Err()
+			}
+			sendMu.Lock()
+			stream.CloseSend()
+			sendMu.Unlock()
+			log.Printf("Агент #%d: поток задач закрыт", c.AgentID())
+			return ctx.Err()
+		case in = <-messages:
+		}
+
+		msg, err := in.msg, in.err
+		if err != nil {
+			wg.Wait()
+			return err
+		}
+
+		if msg.Ack != nil {
+			if !msg.Ack.Success {
+				log.Printf("Агент #%d: Сервер отклонил результат задачи #%d: %s", c.AgentID(), msg.Ack.TaskId, msg.Ack.Message)
+			}
+			continue
+		}
+		if msg.Task == nil {
+			continue
+		}
+
+		task := calculator.ConvertGRPCToTask(msg.Task)
+		log.Printf("Агент #%d: получена задача #%d из потока: %s %s %s, ExprID=%s",
+			c.AgentID(), task.ID, task.Arg1, task.Operation, task.Arg2, task.ExpressionID)
+
+		// Оркестратор присылает не больше задач, чем объявлено слотов
+		wg.Add(1)
+		c.inFlight.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.inFlight.Add(-1)
+			slot := <-slots
+			defer func() { slots <- slot }()
+
+			start := time.Now()
+			value, computeErr := computeTask(task)
+			if task.OperationTime > 0 {
+				time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+			}
+			observeTask(slot, start, computeErr != nil)
+
+			// При остановке слот не возвращаем, чтобы оркестратор не присылал новые задачи
+			var freed int32 = 1
+			if draining.Load() {
+				freed = 0
+			}
+			result := calculator.ConvertTaskResultToGRPC(*newTaskResult(task, value, computeErr), task.ExpressionID)
+			if err := send(&calculator.AgentMessage{AgentId: c.AgentID(), Capacity: freed, Result: result}); err != nil {
+				log.Printf("Агент #%d: ошибка отправки результата задачи #%d в поток: %v", c.AgentID(), task.ID, err)
+			}
+		}()
+	}
+}
@@ -2,17 +2,20 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/GGmuzem/yandex-project/pkg/operations"
 )
 
 // getTaskResult получает результат задачи от оркестратора
@@ -22,14 +25,8 @@ func getTaskResult(taskID int) (float64, error) {
 	// и агент получает только готовые задачи, мы можем просто использовать
 	// значение, которое уже должно быть в аргументе
 	
-	// Получаем адрес HTTP сервера из переменной окружения
-	httpServer := os.Getenv("HTTP_SERVER")
-	if httpServer == "" {
-		httpServer = "localhost:8080"
-	}
-	
-	// Формируем URL для запроса результата задачи
-	url := fmt.Sprintf("http://%s/internal/task/result/%d", httpServer, taskID)
+	// Формируем URL для запроса результата задачи по адресу HTTP сервера из настроек
+	url := fmt.Sprintf("http://%s/internal/task/result/%d", Config.Agent.HTTPServer, taskID)
 	
 	// Отправляем GET запрос
 	resp, err := http.Get(url)
@@ -65,33 +62,30 @@ func getTaskResult(taskID int) (float64, error) {
 	return result.Value, nil
 }
 
-// StartWorker запускает агент с несколькими воркерами
-func StartWorker() {
-	// Получаем количество вычислительных мощностей из переменной окружения
-	power, err := strconv.Atoi(os.Getenv("COMPUTING_POWER"))
-	if err != nil || power <= 0 {
-		power = 10 // По умолчанию 1 воркер
-		log.Printf("COMPUTING_POWER не указано или некорректно, используем значение по умолчанию: %d", power)
-	}
+// StartWorker запускает агент с несколькими воркерами.
+// Воркеры добавляются в wg и завершаются после отмены ctx, доделав текущую задачу.
+func StartWorker(ctx context.Context, wg *sync.WaitGroup) {
+	// Количество вычислительных мощностей из настроек
+	power := Config.Agent.ComputingPower
 
 	log.Printf("Запуск агента с %d воркерами", power)
 
 	// Запускаем необходимое количество горутин
 	for i := 0; i < power; i++ {
-		go workerLoop(i)
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			workerLoop(ctx, id)
+		}(i)
 	}
 }
 
 // workerLoop непрерывно опрашивает оркестратор на наличие новых задач и выполняет их
-func workerLoop(id int) {
+func workerLoop(ctx context.Context, id int) {
 	client := &http.Client{Timeout: 10 * time.Second}
 
 	// Настройка HTTP-сервера для запросов задач
-	httpServer := os.Getenv("HTTP_SERVER")
-	if httpServer == "" {
-		httpServer = "localhost:8080"
-	}
-	taskURL := "http://" + httpServer + "/internal/task"
+	taskURL := "http://" + Config.Agent.HTTPServer + "/internal/task"
 
 	// Интервал между запросами при отсутствии задач
 	retryInterval := 100 * time.Millisecond
@@ -99,13 +93,14 @@ func workerLoop(id int) {
 	maxRetries := 5
 
 	log.Printf("Воркер %d: запущен", id)
+	defer log.Printf("Воркер %d: остановлен", id)
 
-	for {
+	for ctx.Err() == nil {
 		// Запрашиваем задачу от оркестратора
-		req, err := http.NewRequest("GET", taskURL, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", taskURL, nil)
 		if err != nil {
 			log.Printf("Воркер %d: ошибка создания запроса: %v", id, err)
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 
@@ -114,21 +109,21 @@ func workerLoop(id int) {
 		// Обрабатываем ошибки и случай отсутствия задач
 		if err != nil {
 			log.Printf("Воркер %d: ошибка соединения с оркестратором: %v", id, err)
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 
 		if resp.StatusCode == http.StatusNotFound {
 			// Если нет задач, повторяем через небольшой интервал
 			resp.Body.Close()
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("Воркер %d: неожиданный статус от оркестратора: %d", id, resp.StatusCode)
 			resp.Body.Close()
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 
@@ -140,7 +135,7 @@ func workerLoop(id int) {
 		if err := json.NewDecoder(resp.Body).Decode(&taskResp); err != nil {
 			log.Printf("Воркер %d: ошибка декодирования ответа: %v", id, err)
 			resp.Body.Close()
-			time.Sleep(retryInterval)
+			sleepCtx(ctx, retryInterval)
 			continue
 		}
 		resp.Body.Close()
@@ -149,17 +144,16 @@ func workerLoop(id int) {
 		log.Printf("Воркер %d: получена задача #%d: %s %s %s", id, task.ID, task.Arg1, task.Operation, task.Arg2)
 
 		// Вычисляем результат
-		result := computeTask(task)
+		start := time.Now()
+		result, computeErr := computeTask(task)
 
 		// Имитируем длительное время вычисления
 		log.Printf("Воркер %d: выполняется задача #%d (%d мс)...", id, task.ID, task.OperationTime)
 		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+		observeTask(id, start, computeErr != nil)
 
 		// Подготавливаем данные результата
-		resultData, err := json.Marshal(models.TaskResult{
-			ID:     task.ID,
-			Result: result,
-		})
+		resultData, err := json.Marshal(newTaskResult(task, result, computeErr))
 
 		if err != nil {
 			log.Printf("Воркер %d: ошибка маршалинга результата: %v", id, err)
@@ -209,114 +203,111 @@ func workerLoop(id int) {
 	}
 }
 
-// computeTask выполняет арифметическую операцию
-func computeTask(t models.Task) float64 {
+// computeTask выполняет арифметическую операцию.
+// Ошибки вычисления возвращаются как *ComputeError с кодом для оркестратора.
+func computeTask(t models.Task) (float64, error) {
 	// Проверяем на пустые аргументы
-	if t.Arg1 == "" || t.Arg2 == "" {
+	if !t.IsFunction() && (t.Arg1 == "" || t.Arg2 == "") {
 		log.Printf("Ошибка: пустые аргументы в задаче #%d: '%s', '%s'", t.ID, t.Arg1, t.Arg2)
-		return 0
+		return 0, &ComputeError{Code: models.TaskErrorInvalidArgument, Message: "пустые аргументы в задаче"}
+	}
+
+	log.Printf("Задача #%d: обработка аргументов: %s %v", t.ID, t.Operation, t.Operands())
+
+	operands := t.Operands()
+	values := make([]float64, len(operands))
+	for i, arg := range operands {
+		value, err := resolveOperand(t.ID, i+1, arg)
+		if err != nil {
+			return 0, err
+		}
+		values[i] = value
 	}
 
-	log.Printf("Задача #%d: обработка аргументов: '%s' %s '%s'", t.ID, t.Arg1, t.Operation, t.Arg2)
+	log.Printf("Задача #%d: преобразованные аргументы: %s %v", t.ID, t.Operation, values)
 
+	value, err := Evaluate(t.Operation, values)
+	if err != nil {
+		log.Printf("Ошибка вычисления задачи #%d: %v", t.ID, err)
+	}
+	return value, err
+}
+
+// resolveOperand возвращает значение аргумента n задачи taskID: число или результат другой задачи
+func resolveOperand(taskID, n int, arg string) (float64, error) {
 	// Проверка, является ли аргумент ссылкой на результат другой задачи
-	var a, b float64
-
-	// Обработка первого аргумента
-	if strings.HasPrefix(t.Arg1, "result") {
-		// Это ссылка на результат другой задачи
-		// Результаты должны быть предварительно подготовлены оркестратором
-		// Агент получает задачу только когда она готова к выполнению
-		// Поэтому мы просто извлекаем числовое значение из аргумента
-		log.Printf("Задача #%d: аргумент 1 '%s' является ссылкой на результат другой задачи", t.ID, t.Arg1)
-		
+	if strings.HasPrefix(arg, "result") {
+		// Результаты должны быть предварительно подготовлены оркестратором,
+		// агент получает задачу только когда она готова к выполнению
+		log.Printf("Задача #%d: аргумент %d '%s' является ссылкой на результат другой задачи", taskID, n, arg)
+
 		// Извлекаем ID задачи из ссылки (например, из "result1" получаем "1")
-		resultID := strings.TrimPrefix(t.Arg1, "result")
-		
-		// Преобразуем ID в число
-		resultTaskID, err := strconv.Atoi(resultID)
+		resultTaskID, err := strconv.Atoi(strings.TrimPrefix(arg, "result"))
 		if err != nil {
-			log.Printf("Ошибка при извлечении ID задачи из ссылки '%s': %v", t.Arg1, err)
-			return 0
+			log.Printf("Ошибка при извлечении ID задачи из ссылки '%s': %v", arg, err)
+			return 0, &ComputeError{Code: models.TaskErrorInvalidArgument, Message: "некорректная ссылка на результат: " + arg}
 		}
-		
-		// Получаем результат предыдущей задачи от оркестратора
-		// Это должно быть сделано через HTTP или gRPC запрос к оркестратору
-		// Но так как оркестратор уже проверил, что задача готова к выполнению,
-		// и агент получает только готовые задачи, мы можем просто использовать
-		// числовое значение, переданное в аргументе
-		
+
 		// Запрашиваем результат у оркестратора
 		result, err := getTaskResult(resultTaskID)
 		if err != nil {
 			log.Printf("Ошибка при получении результата задачи #%d: %v", resultTaskID, err)
-			return 0
-		}
-		
-		a = result
-		log.Printf("Задача #%d: получен результат задачи #%d: %f", t.ID, resultTaskID, a)
-	} else {
-		// Обычное числовое значение
-		var errA error
-		a, errA = strconv.ParseFloat(t.Arg1, 64)
-		if errA != nil {
-			log.Printf("Невозможно преобразовать аргумент 1 '%s' в число для задачи #%d: %v", t.Arg1, t.ID, errA)
-			return 0
+			return 0, err
 		}
+		log.Printf("Задача #%d: получен результат задачи #%d: %f", taskID, resultTaskID, result)
+		return result, nil
 	}
 
-	// Обработка второго аргумента
-	if strings.HasPrefix(t.Arg2, "result") {
-		// Это ссылка на результат другой задачи
-		log.Printf("Задача #%d: аргумент 2 '%s' является ссылкой на результат другой задачи", t.ID, t.Arg2)
-		
-		// Извлекаем ID задачи из ссылки
-		resultID := strings.TrimPrefix(t.Arg2, "result")
-		
-		// Преобразуем ID в число
-		resultTaskID, err := strconv.Atoi(resultID)
-		if err != nil {
-			log.Printf("Ошибка при извлечении ID задачи из ссылки '%s': %v", t.Arg2, err)
-			return 0
-		}
-		
-		// Получаем результат предыдущей задачи
-		result, err := getTaskResult(resultTaskID)
-		if err != nil {
-			log.Printf("Ошибка при получении результата задачи #%d: %v", resultTaskID, err)
-			return 0
-		}
-		
-		b = result
-		log.Printf("Задача #%d: получен результат задачи #%d: %f", t.ID, resultTaskID, b)
-	} else {
-		// Обычное числовое значение
-		var errB error
-		b, errB = strconv.ParseFloat(t.Arg2, 64)
-		if errB != nil {
-			log.Printf("Невозможно преобразовать аргумент 2 '%s' в число для задачи #%d: %v", t.Arg2, t.ID, errB)
-			return 0
-		}
+	// Обычное числовое значение
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		log.Printf("Невозможно преобразовать аргумент %d '%s' в число для задачи #%d: %v", n, arg, taskID, err)
+		return 0, &ComputeError{Code: models.TaskErrorInvalidArgument, Message: "аргумент не является числом: " + arg}
 	}
+	return value, nil
+}
 
-	log.Printf("Задача #%d: преобразованные аргументы: %f %s %f", t.ID, a, t.Operation, b)
-
-	// Выполняем операцию
-	switch t.Operation {
-	case "+":
-		return a + b
-	case "-":
-		return a - b
-	case "*":
-		return a * b
-	case "/":
-		if b == 0 {
-			log.Printf("Ошибка: деление на ноль в задаче #%d", t.ID)
-			return 0
+// Evaluate выполняет операцию из реестра pkg/operations: бинарный оператор или встроенную функцию.
+// Деление на ноль дает ошибку с кодом division_by_zero, аргументы вне области определения
+// (sqrt(-1), 0 ^ -1) - domain_error, неверное число аргументов - invalid_argument.
+// Ошибки возвращаются как *ComputeError.
+func Evaluate(op string, args []float64) (float64, error) {
+	o, ok := operations.Lookup(op)
+	if !ok {
+		return 0, &ComputeError{Code: models.TaskErrorUnknownOperation, Message: "неизвестная операция: " + op}
+	}
+	value, err := o.Call(args)
+	if err != nil {
+		var opErr *operations.Error
+		if errors.As(err, &opErr) {
+			return 0, &ComputeError{Code: opErr.Code, Message: opErr.Message}
 		}
-		return a / b
-	default:
-		log.Printf("Неизвестная операция в задаче #%d: %s", t.ID, t.Operation)
+		return 0, &ComputeError{Code: models.TaskErrorInvalidArgument, Message: err.Error()}
+	}
+	return value, nil
+}
+
+// ComputeError ошибка вычисления задачи с кодом, который передается оркестратору
+type ComputeError struct {
+	Code    string
+	Message string
+}
+
+func (e *ComputeError) Error() string {
+	return e.Message
+}
+
+// newTaskResult формирует результат задачи для отправки оркестратору.
+// При ошибке вычисления в результат записываются код и описание ошибки.
+func newTaskResult(task models.Task, value float64, err error) *models.TaskResult {
+	if err == nil {
+		return &models.TaskResult{ID: task.ID, Result: value, LeaseID: task.LeaseID}
+	}
+
+	code := models.TaskErrorInvalidArgument
+	var computeErr *ComputeError
+	if errors.As(err, &computeErr) {
+		code = computeErr.Code
 	}
-	return 0
+	return &models.TaskResult{ID: task.ID, LeaseID: task.LeaseID, ErrorCode: code, Error: err.Error()}
 }
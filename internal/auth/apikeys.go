@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+const (
+	// apiKeyPrefix начало каждого ключа API, по нему ключ легко найти в логах и конфигурации
+	apiKeyPrefix = "calc_"
+	// apiKeyPrefixLen сколько символов ключа сохраняется открыто для списка ключей
+	apiKeyPrefixLen = len(apiKeyPrefix) + 6
+	// maxAPIKeyName максимальная длина имени ключа
+	maxAPIKeyName = 100
+)
+
+var (
+	// ErrInvalidAPIKey ключ API не найден, отозван или истек
+	ErrInvalidAPIKey = errors.New("неверный, отозванный или истекший ключ API")
+	// ErrInvalidAPIKeyName имя ключа пустое или слишком длинное
+	ErrInvalidAPIKeyName = errors.New("имя ключа API должно содержать от 1 до 100 символов")
+)
+
+// CreateAPIKey создает ключ API пользователя. Ключ возвращается только здесь, в БД хранится его хеш.
+// ttl равный нулю означает бессрочный ключ
+func CreateAPIKey(db database.Database, user *models.User, name string, ttl time.Duration) (string, *models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxAPIKeyName {
+		return "", nil, ErrInvalidAPIKeyName
+	}
+
+	secret, err := newRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := apiKeyPrefix + secret
+
+	now := time.Now()
+	key := &models.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    raw[:apiKeyPrefixLen],
+		Hash:      hashToken(raw),
+		CreatedAt: now.UnixMilli(),
+	}
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl).UnixMilli()
+	}
+
+	key.ID, err = db.CreateAPIKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, key, nil
+}
+
+// AuthenticateAPIKey проверяет ключ API, запоминает момент его использования и возвращает владельца
+func AuthenticateAPIKey(db database.Database, raw string) (*models.User, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := db.GetAPIKeyByHash(hashToken(raw))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	if key.RevokedAt != 0 || (key.ExpiresAt != 0 && key.ExpiresAt <= now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := db.GetUserByID(key.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Ошибка записи времени использования не мешает выполнению запроса
+	if err := db.TouchAPIKey(key.ID, now); err != nil {
+		log.Printf("AuthenticateAPIKey: Не удалось обновить время использования ключа %d: %v", key.ID, err)
+	}
+	return user, nil
+}
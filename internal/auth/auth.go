@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/GGmuzem/yandex-project/internal/config"
 	"github.com/GGmuzem/yandex-project/internal/database"
 	"github.com/GGmuzem/yandex-project/pkg/models"
 	"github.com/golang-jwt/jwt/v5"
@@ -15,9 +16,6 @@ import (
 )
 
 var (
-	// Секретный ключ для подписи JWT токенов
-	jwtSecret = []byte("super_secret_key_change_in_production")
-
 	// Время жизни токена (1 час)
 	tokenExpiration = time.Hour * 1
 
@@ -27,22 +25,63 @@ var (
 	ErrUserExists         = errors.New("пользователь с таким логином уже существует")
 )
 
+// Configure загружает ключи подписи, задает время жизни JWT токенов, требования к паролям
+// и пороги блокировки входа из настроек
+func Configure(cfg config.Auth) error {
+	set, err := NewKeySet(cfg)
+	if err != nil {
+		return err
+	}
+	p, err := newPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	policyMu.Lock()
+	policy = p
+	policyMu.Unlock()
+	SetLoginLimiter(NewLoginLimiter(cfg))
+
+	keysMu.Lock()
+	keys = set
+	tokenExpiration = time.Duration(cfg.TokenTTLMs) * time.Millisecond
+	if cfg.RefreshTokenTTLMs > 0 {
+		refreshTokenExpiration = time.Duration(cfg.RefreshTokenTTLMs) * time.Millisecond
+	}
+	keysMu.Unlock()
+
+	log.Printf("JWT: подпись %s, ключ %s, ключей проверки: %d", set.Algorithm(), set.KeyID(), len(set.keys))
+	if set.Algorithm() == AlgorithmHS256 && cfg.JWTSecretFile == "" && cfg.JWTSecret == config.DefaultJWTSecret {
+		log.Printf("ВНИМАНИЕ: используется секрет JWT по умолчанию, задайте JWT_SECRET или auth.jwt_secret")
+	}
+	return nil
+}
+
 // Claims структура для JWT-токена
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Login  string `json:"login"`
+	UserID    int    `json:"user_id"`
+	Login     string `json:"login"`
+	Role      string `json:"role,omitempty"` // Роль на момент выдачи, права проверяются по роли из БД
+	SessionID string `json:"sid,omitempty"`  // Сессия, выданная при входе; пустая у токенов без refresh
 	jwt.RegisteredClaims
 }
 
-// GenerateToken создает JWT токен для пользователя
+// GenerateToken создает JWT токен для пользователя без сессии, такой токен нельзя отозвать
 func GenerateToken(user *models.User) (string, error) {
+	return generateToken(user, "")
+}
+
+// generateToken создает JWT токен для пользователя, привязанный к сессии sessionID
+func generateToken(user *models.User, sessionID string) (string, error) {
 	// Устанавливаем срок действия токена
 	expirationTime := time.Now().Add(tokenExpiration)
 
 	// Создаем claims с данными пользователя
 	claims := &Claims{
-		UserID: user.ID,
-		Login:  user.Login,
+		UserID:    user.ID,
+		Login:     user.Login,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -50,11 +89,8 @@ func GenerateToken(user *models.User) (string, error) {
 		},
 	}
 
-	// Создаем токен с claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Подписываем токен секретным ключом
-	tokenString, err := token.SignedString(jwtSecret)
+	// Подписываем токен текущим ключом, kid ключа указывается в заголовке
+	tokenString, err := currentKeys().sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -64,14 +100,8 @@ func GenerateToken(user *models.User) (string, error) {
 
 // ValidateToken проверяет и валидирует JWT токен
 func ValidateToken(tokenString string) (*Claims, error) {
-	// Парсим токен
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Проверяем метод подписи
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	// Парсим токен, ключ проверки выбирается по kid из заголовка
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, currentKeys().keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -98,8 +128,21 @@ func ExtractTokenFromRequest(r *http.Request) string {
 	return ""
 }
 
+// ExtractAPIKeyFromRequest извлекает ключ API из заголовка X-API-Key
+func ExtractAPIKeyFromRequest(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
 // RegisterUser регистрирует нового пользователя
 func RegisterUser(db database.Database, req *models.RegisterRequest) error {
+	// Проверяем логин и пароль по требованиям
+	if err := ValidateLogin(req.Login); err != nil {
+		return err
+	}
+	if err := ValidatePassword(req.Password); err != nil {
+		return err
+	}
+
 	// Проверяем, существует ли пользователь
 	exists, err := db.UserExists(req.Login)
 	if err != nil {
@@ -121,13 +164,40 @@ func RegisterUser(db database.Database, req *models.RegisterRequest) error {
 
 // LoginUser аутентифицирует пользователя и возвращает JWT токен
 func LoginUser(db database.Database, req *models.LoginRequest) (string, error) {
+	resp, err := Login(db, req, "")
+	if err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// Login аутентифицирует пользователя, создает сессию и возвращает access и refresh токены.
+// ip адрес клиента для блокировки по IP, пустой для входа не по HTTP.
+// После серии неудачных попыток возвращает *LockoutError
+func Login(db database.Database, req *models.LoginRequest, ip string) (*models.LoginResponse, error) {
 	log.Printf("LoginUser: Попытка входа пользователя %s", req.Login)
 
+	// Во время блокировки пароль не проверяется
+	limiter := currentLimiter()
+	if wait := limiter.Locked(req.Login, ip); wait > 0 {
+		log.Printf("LoginUser: Вход пользователя %s с %s заблокирован еще на %v", req.Login, ip, wait)
+		audit(db, models.AuditLoginLocked, req.Login, ip, "")
+		return nil, &LockoutError{RetryAfter: wait}
+	}
+	fail := func(detail string) error {
+		audit(db, models.AuditLoginFailed, req.Login, ip, detail)
+		if limiter.Failure(req.Login, ip) {
+			log.Printf("LoginUser: Превышено число неудачных попыток входа пользователя %s с %s", req.Login, ip)
+			audit(db, models.AuditLockout, req.Login, ip, "")
+		}
+		return ErrInvalidCredentials
+	}
+
 	// Получаем пользователя по логину
 	user, err := db.GetUserByLogin(req.Login)
 	if err != nil {
 		log.Printf("LoginUser: Пользователь %s не найден: %v", req.Login, err)
-		return "", ErrInvalidCredentials
+		return nil, fail("пользователь не найден")
 	}
 	log.Printf("LoginUser: Пользователь %s найден в базе", req.Login)
 
@@ -136,25 +206,37 @@ func LoginUser(db database.Database, req *models.LoginRequest) (string, error) {
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
 		log.Printf("LoginUser: Неверный пароль для пользователя %s: %v", req.Login, err)
-		return "", ErrInvalidCredentials
+		return nil, fail("неверный пароль")
 	}
+	limiter.Success(req.Login)
 	log.Printf("LoginUser: Пароль проверен успешно для пользователя %s", req.Login)
 
-	// Генерируем токен
+	// Создаем сессию и генерируем токены
 	log.Printf("LoginUser: Генерация JWT токена для пользователя %s", req.Login)
-	token, err := GenerateToken(user)
+	resp, err := StartSession(db, user)
 	if err != nil {
 		log.Printf("LoginUser: Ошибка генерации токена для пользователя %s: %v", req.Login, err)
-		return "", err
+		return nil, err
 	}
 	log.Printf("LoginUser: JWT токен успешно создан для пользователя %s", req.Login)
 
-	return token, nil
+	return resp, nil
 }
 
-// AuthMiddleware middleware для проверки авторизации
+// AuthMiddleware middleware для проверки авторизации по Bearer токену или ключу API (X-API-Key)
 func AuthMiddleware(db database.Database, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Машинные клиенты передают ключ API вместо JWT токена
+		if apiKey := ExtractAPIKeyFromRequest(r); apiKey != "" {
+			user, err := AuthenticateAPIKey(db, apiKey)
+			if err != nil {
+				http.Error(w, "Неверный ключ API", http.StatusUnauthorized)
+				return
+			}
+			next(w, r.WithContext(SetUserContext(r.Context(), user)))
+			return
+		}
+
 		// Извлекаем токен из запроса
 		tokenString := ExtractTokenFromRequest(r)
 		if tokenString == "" {
@@ -169,6 +251,12 @@ func AuthMiddleware(db database.Database, next http.HandlerFunc) http.HandlerFun
 			return
 		}
 
+		// Проверяем, что сессия токена не завершена выходом
+		if err := checkSession(db, claims); err != nil {
+			http.Error(w, "Сессия завершена", http.StatusUnauthorized)
+			return
+		}
+
 		// Проверяем существование пользователя
 		user, err := db.GetUserByLogin(claims.Login)
 		if err != nil || user.ID != claims.UserID {
@@ -176,8 +264,12 @@ func AuthMiddleware(db database.Database, next http.HandlerFunc) http.HandlerFun
 			return
 		}
 
-		// Устанавливаем контекст пользователя
-		r = r.WithContext(SetUserContext(r.Context(), user))
+		// Устанавливаем контекст пользователя и сессии
+		ctx := SetUserContext(r.Context(), user)
+		if claims.SessionID != "" {
+			ctx = SetSessionContext(ctx, claims.SessionID)
+		}
+		r = r.WithContext(ctx)
 
 		// Передаем управление следующему обработчику
 		next(w, r)
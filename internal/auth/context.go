@@ -8,7 +8,10 @@ import (
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+)
 
 // SetUserContext сохраняет пользователя в контексте
 func SetUserContext(ctx context.Context, user *models.User) context.Context {
@@ -20,3 +23,14 @@ func GetUserFromContext(ctx context.Context) (*models.User, bool) {
 	user, ok := ctx.Value(userContextKey).(*models.User)
 	return user, ok
 }
+
+// SetSessionContext сохраняет ID сессии access токена в контексте
+func SetSessionContext(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionContextKey, sessionID)
+}
+
+// GetSessionFromContext извлекает ID сессии из контекста
+func GetSessionFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(sessionContextKey).(string)
+	return sessionID, ok
+}
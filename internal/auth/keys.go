@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи JWT
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// signingKey ключ подписи или проверки токенов
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   interface{} // Секрет HMAC или закрытый ключ, nil у ключей только для проверки
+	verify interface{} // Секрет HMAC или открытый ключ
+}
+
+// KeySet ключ, которым подписываются новые токены, и ключи, которыми проверяются
+// выданные ранее (для смены ключа без выхода пользователей из системы)
+type KeySet struct {
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   = mustDefaultKeys()
+)
+
+func mustDefaultKeys() *KeySet {
+	set, err := NewKeySet(config.Default().Auth)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func currentKeys() *KeySet {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys
+}
+
+// NewKeySet создает набор ключей по настройкам: HS256 с секретом jwt_secret
+// (или из файла jwt_secret_file) либо RS256/EdDSA с закрытым ключом из private_key_file.
+// Ключи из verification_key_files и previous_secrets только проверяют подпись.
+func NewKeySet(cfg config.Auth) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*signingKey)}
+
+	var current *signingKey
+	switch cfg.Algorithm {
+	case "", AlgorithmHS256:
+		secret := cfg.JWTSecret
+		if cfg.JWTSecretFile != "" {
+			data, err := os.ReadFile(cfg.JWTSecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("не удалось прочитать секрет JWT: %w", err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret == "" {
+			return nil, errors.New("секрет JWT не может быть пустым")
+		}
+		current = hmacKey(secret)
+	case AlgorithmRS256, AlgorithmEdDSA:
+		if cfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("для %s нужен закрытый ключ (auth.private_key_file)", cfg.Algorithm)
+		}
+		key, err := loadKeyFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.sign == nil {
+			return nil, fmt.Errorf("%s: ожидался закрытый ключ", cfg.PrivateKeyFile)
+		}
+		if key.method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("%s: ключ подходит для %s, а не для %s", cfg.PrivateKeyFile, key.method.Alg(), cfg.Algorithm)
+		}
+		current = key
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм подписи JWT: %s", cfg.Algorithm)
+	}
+	if cfg.KeyID != "" {
+		current.kid = cfg.KeyID
+	}
+	set.current = current
+	set.keys[current.kid] = current
+
+	for _, path := range cfg.VerificationKeyFiles {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key.sign = nil
+		set.add(key)
+	}
+	for _, secret := range cfg.PreviousSecrets {
+		key := hmacKey(secret)
+		key.sign = nil
+		set.add(key)
+	}
+	return set, nil
+}
+
+// add добавляет ключ проверки, не заменяя ключ подписи с тем же kid
+func (s *KeySet) add(key *signingKey) {
+	if _, exists := s.keys[key.kid]; !exists {
+		s.keys[key.kid] = key
+	}
+}
+
+// KeyID возвращает kid ключа, которым подписываются новые токены
+func (s *KeySet) KeyID() string {
+	return s.current.kid
+}
+
+// Algorithm возвращает алгоритм подписи новых токенов
+func (s *KeySet) Algorithm() string {
+	return s.current.method.Alg()
+}
+
+// sign подписывает токен текущим ключом и указывает его kid в заголовке
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.current.method, claims)
+	token.Header["kid"] = s.current.kid
+	return token.SignedString(s.current.sign)
+}
+
+// keyFunc выбирает ключ проверки по kid из заголовка токена. Токены без kid,
+// выданные до появления ключей с идентификаторами, проверяются текущим ключом.
+// Алгоритм токена должен совпадать с алгоритмом ключа.
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := s.current
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = s.keys[kid]; !ok {
+			return nil, fmt.Errorf("неизвестный ключ подписи: %s", kid)
+		}
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+// hmacKey создает ключ HS256. kid вычисляется по хешу секрета и не раскрывает его
+func hmacKey(secret string) *signingKey {
+	sum := sha256.Sum256([]byte("kid:" + secret))
+	return &signingKey{
+		kid:    "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
+		method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}
+}
+
+// loadKeyFile читает ключ RSA или Ed25519 из PEM файла: закрытый ключ (PKCS#8 или PKCS#1)
+// или открытый ключ (PKIX). kid вычисляется по открытому ключу, поэтому совпадает
+// у закрытого ключа и соответствующего ему открытого.
+func loadKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать ключ JWT: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: ожидался ключ в формате PEM", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: неподдерживаемый тип PEM блока %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &signingKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verify = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verify = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%s: поддерживаются только ключи RSA и Ed25519", path)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.verify)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sum := sha256.Sum256(der)
+	key.kid = base64.RawURLEncoding.EncodeToString(sum[:12])
+	return key, nil
+}
+
+// JWK открытый ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // Модуль RSA
+	E   string `json:"e,omitempty"`   // Экспонента RSA
+	Crv string `json:"crv,omitempty"` // Кривая Ed25519
+	X   string `json:"x,omitempty"`   // Открытый ключ Ed25519
+}
+
+// JWKS набор открытых ключей для проверки токенов другими сервисами
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	add := func(key *signingKey) {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch k := key.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		default:
+			return // Секреты HMAC не публикуются
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	// Текущий ключ первым, затем ключи проверки в порядке kid
+	add(s.current)
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		if kid != s.current.kid {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		add(s.keys[kid])
+	}
+	return set
+}
+
+// JWKSHandler отдает открытые ключи проверки токенов оркестратора (/.well-known/jwks.json)
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(currentKeys().JWKS())
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// LockoutError вход временно заблокирован из-за неудачных попыток
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("слишком много неудачных попыток входа, повторите через %v", e.RetryAfter.Round(time.Second))
+}
+
+// pruneThreshold с какого числа счетчиков начинается удаление устаревших
+const pruneThreshold = 1024
+
+// failureCounter неудачные попытки входа одного логина или IP
+type failureCounter struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// LoginLimiter считает неудачные попытки входа по логину и по IP и временно блокирует вход,
+// когда их число за окно превышает порог. Счетчики хранятся в памяти оркестратора
+type LoginLimiter struct {
+	mu       sync.Mutex
+	byLogin  map[string]*failureCounter
+	byIP     map[string]*failureCounter
+	maxLogin int
+	maxIP    int
+	window   time.Duration
+	lockout  time.Duration
+	now      func() time.Time
+}
+
+// NewLoginLimiter создает счетчики неудачных попыток входа по настройкам auth.*_failed_* и auth.lockout_ms
+func NewLoginLimiter(cfg config.Auth) *LoginLimiter {
+	return &LoginLimiter{
+		byLogin:  make(map[string]*failureCounter),
+		byIP:     make(map[string]*failureCounter),
+		maxLogin: cfg.MaxFailedLogins,
+		maxIP:    cfg.MaxFailedLoginsPerIP,
+		window:   time.Duration(cfg.FailedLoginWindowMs) * time.Millisecond,
+		lockout:  time.Duration(cfg.LockoutMs) * time.Millisecond,
+		now:      time.Now,
+	}
+}
+
+var (
+	limiterMu sync.RWMutex
+	limiter   = NewLoginLimiter(config.Default().Auth)
+)
+
+func currentLimiter() *LoginLimiter {
+	limiterMu.RLock()
+	defer limiterMu.RUnlock()
+	return limiter
+}
+
+// SetLoginLimiter заменяет счетчики неудачных попыток входа (для тестов и смены настроек)
+func SetLoginLimiter(l *LoginLimiter) {
+	limiterMu.Lock()
+	limiter = l
+	limiterMu.Unlock()
+}
+
+// SetClock задает источник времени счетчиков (для тестов)
+func (l *LoginLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	l.now = now
+	l.mu.Unlock()
+}
+
+// Locked возвращает, сколько еще заблокирован вход для логина или IP, 0 если вход разрешен
+func (l *LoginLimiter) Locked(login, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, c := range []*failureCounter{l.byLogin[login], l.counterForIP(ip)} {
+		if c != nil && c.lockedUntil.After(now) && c.lockedUntil.Sub(now) > wait {
+			wait = c.lockedUntil.Sub(now)
+		}
+	}
+	return wait
+}
+
+// Failure учитывает неудачную попытку и сообщает, заблокирован ли из-за нее вход
+func (l *LoginLimiter) Failure(login, ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	locked := l.record(l.byLogin, login, l.maxLogin, now)
+	if ip != "" && l.record(l.byIP, ip, l.maxIP, now) {
+		locked = true
+	}
+	return locked
+}
+
+// Success сбрасывает счетчик логина после успешного входа. Счетчик IP не сбрасывается,
+// чтобы перебор чужих паролей нельзя было скрыть входами в свою учетную запись
+func (l *LoginLimiter) Success(login string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.byLogin, login)
+}
+
+func (l *LoginLimiter) counterForIP(ip string) *failureCounter {
+	if ip == "" {
+		return nil
+	}
+	return l.byIP[ip]
+}
+
+// record увеличивает счетчик key и блокирует вход при достижении порога max
+func (l *LoginLimiter) record(counters map[string]*failureCounter, key string, max int, now time.Time) bool {
+	c, ok := counters[key]
+	if !ok || now.Sub(c.windowStart) > l.window {
+		c = &failureCounter{windowStart: now}
+		counters[key] = c
+	}
+	c.count++
+	if c.count >= max {
+		c.lockedUntil = now.Add(l.lockout)
+		c.count = 0
+		c.windowStart = now
+		return true
+	}
+	return false
+}
+
+// prune удаляет счетчики с истекшим окном и без блокировки, чтобы память не росла
+func (l *LoginLimiter) prune(now time.Time) {
+	if len(l.byLogin)+len(l.byIP) < pruneThreshold {
+		return
+	}
+	for _, counters := range []map[string]*failureCounter{l.byLogin, l.byIP} {
+		for key, c := range counters {
+			if now.Sub(c.windowStart) > l.window && !c.lockedUntil.After(now) {
+				delete(counters, key)
+			}
+		}
+	}
+}
+
+// ClientIP возвращает IP клиента по адресу соединения. Заголовок X-Forwarded-For
+// не учитывается: его может подделать сам клиент, чтобы обойти блокировку по IP
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// audit сохраняет запись журнала безопасности. Ошибка записи не мешает входу
+func audit(db database.Database, event, login, ip, detail string) {
+	entry := &models.AuditEntry{
+		Time:   time.Now().UnixMilli(),
+		Event:  event,
+		Login:  login,
+		IP:     ip,
+		Detail: detail,
+	}
+	if err := db.SaveAuditEntry(entry); err != nil {
+		log.Printf("audit: Не удалось сохранить событие %s для %s: %v", event, login, err)
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+)
+
+// maxPasswordBytes bcrypt учитывает только первые 72 байта пароля
+const maxPasswordBytes = 72
+
+// PolicyError логин или пароль не соответствуют требованиям
+type PolicyError struct {
+	Field    string   `json:"field"`    // login или password
+	Problems []string `json:"problems"` // Нарушенные требования
+}
+
+func (e *PolicyError) Error() string {
+	field := "пароль"
+	if e.Field == "login" {
+		field = "логин"
+	}
+	return fmt.Sprintf("%s не соответствует требованиям: %s", field, strings.Join(e.Problems, "; "))
+}
+
+// credentialPolicy требования к логину и паролю
+type credentialPolicy struct {
+	loginPattern     *regexp.Regexp
+	minLength        int
+	requireLetter    bool
+	requireDigit     bool
+	requireMixedCase bool
+	requireSymbol    bool
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   = mustPolicy(config.Default().Auth)
+)
+
+func mustPolicy(cfg config.Auth) *credentialPolicy {
+	p, err := newPolicy(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// newPolicy создает требования к логину и паролю по настройкам
+func newPolicy(cfg config.Auth) (*credentialPolicy, error) {
+	pattern := cfg.LoginPattern
+	if pattern == "" {
+		pattern = config.DefaultLoginPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("неверный шаблон логина: %w", err)
+	}
+	return &credentialPolicy{
+		loginPattern:     re,
+		minLength:        cfg.PasswordMinLength,
+		requireLetter:    cfg.PasswordRequireLetter,
+		requireDigit:     cfg.PasswordRequireDigit,
+		requireMixedCase: cfg.PasswordRequireMixedCase,
+		requireSymbol:    cfg.PasswordRequireSymbol,
+	}, nil
+}
+
+func currentPolicy() *credentialPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
+
+// ValidateLogin проверяет логин по шаблону auth.login_pattern
+func ValidateLogin(login string) error {
+	p := currentPolicy()
+	if !p.loginPattern.MatchString(login) {
+		return &PolicyError{Field: "login", Problems: []string{"не соответствует шаблону " + p.loginPattern.String()}}
+	}
+	return nil
+}
+
+// ValidatePassword проверяет пароль по требованиям auth.password_*. Возвращает все нарушения сразу
+func ValidatePassword(password string) error {
+	p := currentPolicy()
+	var letter, digit, lower, upper, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+			lower = lower || unicode.IsLower(r)
+			upper = upper || unicode.IsUpper(r)
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var problems []string
+	if n := len([]rune(password)); n < p.minLength {
+		problems = append(problems, fmt.Sprintf("короче %d символов", p.minLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("длиннее %d байт", maxPasswordBytes))
+	}
+	if p.requireLetter && !letter {
+		problems = append(problems, "нет букв")
+	}
+	if p.requireDigit && !digit {
+		problems = append(problems, "нет цифр")
+	}
+	if p.requireMixedCase && !(lower && upper) {
+		problems = append(problems, "нет строчных и заглавных букв одновременно")
+	}
+	if p.requireSymbol && !symbol {
+		problems = append(problems, "нет символов, отличных от букв и цифр")
+	}
+	if len(problems) > 0 {
+		return &PolicyError{Field: "password", Problems: problems}
+	}
+	return nil
+}
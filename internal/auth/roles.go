@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// HasRole проверяет, что у пользователя есть роль role. Администратору доступно все,
+// что доступно обычному пользователю
+func HasRole(user *models.User, role string) bool {
+	switch role {
+	case models.RoleUser:
+		return user.Role == models.RoleUser || user.Role == models.RoleAdmin
+	default:
+		return user.Role == role
+	}
+}
+
+// RequireRole пропускает к next только пользователей с ролью role.
+// Используется после AuthMiddleware, которое кладет пользователя в контекст
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+			return
+		}
+		if !HasRole(user, role) {
+			log.Printf("RequireRole: У пользователя %s нет роли %s, доступ к %s запрещен", user.Login, role, r.URL.Path)
+			http.Error(w, "Недостаточно прав", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// BootstrapAdmins назначает роль admin пользователям из auth.admin_logins и создает
+// администратора auth.bootstrap_admin, если его еще нет. Вызывается при запуске оркестратора
+func BootstrapAdmins(db database.Database, cfg config.Auth) error {
+	if cfg.BootstrapAdmin != "" {
+		exists, err := db.UserExists(cfg.BootstrapAdmin)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			// Пароль администратора из настроек подчиняется тем же требованиям, что и при регистрации
+			if err := ValidatePassword(cfg.BootstrapPassword); err != nil {
+				return fmt.Errorf("auth.bootstrap_password: %w", err)
+			}
+			user := &models.User{Login: cfg.BootstrapAdmin, Password: cfg.BootstrapPassword, Role: models.RoleAdmin}
+			if _, err := db.CreateUser(user); err != nil {
+				return err
+			}
+			log.Printf("BootstrapAdmins: Создан администратор %s", cfg.BootstrapAdmin)
+		} else if err := promote(db, cfg.BootstrapAdmin); err != nil {
+			return err
+		}
+	}
+
+	for _, login := range cfg.AdminLogins {
+		if login == "" {
+			continue
+		}
+		if err := promote(db, login); errors.Is(err, database.ErrNotFound) {
+			log.Printf("BootstrapAdmins: Пользователь %s из auth.admin_logins не найден", login)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promote назначает пользователю роль admin
+func promote(db database.Database, login string) error {
+	if err := db.SetUserRole(login, models.RoleAdmin); err != nil {
+		return err
+	}
+	log.Printf("BootstrapAdmins: Пользователю %s назначена роль admin", login)
+	return nil
+}
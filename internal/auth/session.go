@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// Время жизни refresh токена (30 дней). Каждый обмен продлевает сессию на этот срок
+var refreshTokenExpiration = 30 * 24 * time.Hour
+
+// ErrSessionRevoked сессия завершена выходом или из-за повторного использования refresh токена
+var ErrSessionRevoked = errors.New("сессия завершена")
+
+// newRandomToken создает случайную строку из n байт в base64url
+func newRandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken возвращает хеш refresh токена или ключа API, под которым он хранится в БД
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken создает следующий refresh токен сессии
+func newRefreshToken(sessionID string, now time.Time) (string, *models.RefreshToken, error) {
+	raw, err := newRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, &models.RefreshToken{
+		Hash:      hashToken(raw),
+		SessionID: sessionID,
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(refreshTokenExpiration).UnixMilli(),
+	}, nil
+}
+
+// loginResponse выдает access токен сессии вместе с refresh токеном
+func loginResponse(user *models.User, sessionID, refreshToken string) (*models.LoginResponse, error) {
+	token, err := generateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(tokenExpiration / time.Second),
+	}, nil
+}
+
+// StartSession создает сессию пользователя и выдает первую пару токенов
+func StartSession(db database.Database, user *models.User) (*models.LoginResponse, error) {
+	sessionID, err := newRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	raw, refresh, err := newRefreshToken(sessionID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		ID:        sessionID,
+		UserID:    user.ID,
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: refresh.ExpiresAt,
+	}
+	if err := db.CreateSession(session, refresh); err != nil {
+		return nil, err
+	}
+	return loginResponse(user, sessionID, raw)
+}
+
+// RefreshSession обменивает refresh токен на новую пару токенов. Refresh токен одноразовый:
+// повторное предъявление уже обмененного токена означает его утечку, поэтому сессия
+// завершается и все ее токены перестают приниматься.
+func RefreshSession(db database.Database, refreshToken string) (*models.LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+	used, err := db.GetRefreshToken(hashToken(refreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session, err := db.GetSession(used.SessionID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != 0 {
+		return nil, ErrSessionRevoked
+	}
+	if used.ExpiresAt <= now.UnixMilli() {
+		return nil, ErrInvalidToken
+	}
+	if used.UsedAt != 0 {
+		return nil, revokeReusedSession(db, session, now)
+	}
+
+	raw, next, err := newRefreshToken(session.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.RotateRefreshToken(used.Hash, now.UnixMilli(), next); err != nil {
+		if errors.Is(err, database.ErrRefreshTokenUsed) {
+			return nil, revokeReusedSession(db, session, now)
+		}
+		return nil, err
+	}
+
+	user, err := db.GetUserByID(session.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loginResponse(user, session.ID, raw)
+}
+
+// revokeReusedSession завершает сессию, refresh токен которой предъявлен повторно
+func revokeReusedSession(db database.Database, session *models.Session, now time.Time) error {
+	log.Printf("RefreshSession: Повторное использование refresh токена сессии %s пользователя %d, сессия завершена", session.ID, session.UserID)
+	if err := db.RevokeSession(session.ID, now.UnixMilli()); err != nil {
+		return err
+	}
+	return ErrSessionRevoked
+}
+
+// RevokeSession завершает сессию: ее access и refresh токены больше не принимаются
+func RevokeSession(db database.Database, sessionID string) error {
+	return db.RevokeSession(sessionID, time.Now().UnixMilli())
+}
+
+// checkSession проверяет, что сессия access токена не завершена. Токены без сессии,
+// выданные до появления refresh токенов, принимаются до истечения срока действия
+func checkSession(db database.Database, claims *Claims) error {
+	if claims.SessionID == "" {
+		return nil
+	}
+	session, err := db.GetSession(claims.SessionID)
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != 0 || session.UserID != claims.UserID {
+		return ErrSessionRevoked
+	}
+	return nil
+}
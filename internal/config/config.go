@@ -0,0 +1,347 @@
+// Package config описывает настройки оркестратора и агента и загружает их
+// из файла YAML/TOML, переменных окружения и флагов командной строки.
+// Приоритет источников: значения по умолчанию < файл < окружение < флаги.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/GGmuzem/yandex-project/pkg/operations"
+)
+
+// DefaultJWTSecret секрет подписи JWT по умолчанию, в рабочем окружении его нужно заменить
+const DefaultJWTSecret = "super_secret_key_change_in_production"
+
+// DefaultLoginPattern логин по умолчанию: от 3 до 32 латинских букв, цифр и символов _ . -, начинается с буквы
+const DefaultLoginPattern = `^[A-Za-z][A-Za-z0-9_.-]{2,31}$`
+
+// Config настройки всех команд проекта. Каждое поле можно задать в файле
+// (ключ из тега yaml/toml), переменной окружения (тег env) и флагом (тег flag).
+type Config struct {
+	HTTP       HTTP       `yaml:"http" toml:"http"`
+	GRPC       GRPC       `yaml:"grpc" toml:"grpc"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	Operations Operations `yaml:"operations" toml:"operations"`
+	Scheduler  Scheduler  `yaml:"scheduler" toml:"scheduler"`
+	Limits     Limits     `yaml:"limits" toml:"limits"`
+	Shutdown   Shutdown   `yaml:"shutdown" toml:"shutdown"`
+	Agent      Agent      `yaml:"agent" toml:"agent"`
+
+	// File путь к загруженному файлу конфигурации, пустой, если файл не указан
+	File string `yaml:"-" toml:"-"`
+
+	sources     map[string]string // Источник значения по ключу "раздел.поле", если оно не по умолчанию
+	printConfig bool              // Указан флаг --print-config
+}
+
+// HTTP настройки HTTP сервера оркестратора и веб-интерфейса
+type HTTP struct {
+	Port        int    `yaml:"port" toml:"port" env:"HTTP_PORT" flag:"http-port,port" usage:"порт HTTP сервера"`
+	StaticDir   string `yaml:"static_dir" toml:"static_dir" env:"STATIC_DIR" flag:"static-dir" usage:"каталог статических файлов веб-интерфейса"`
+	TemplateDir string `yaml:"template_dir" toml:"template_dir" env:"TEMPLATE_DIR" flag:"template-dir" usage:"каталог шаблонов веб-интерфейса"`
+}
+
+// GRPC настройки gRPC сервера оркестратора
+type GRPC struct {
+	Port int `yaml:"port" toml:"port" env:"GRPC_PORT" flag:"grpc-port" usage:"порт gRPC сервера"`
+}
+
+// Database настройки хранилища
+type Database struct {
+	Path string `yaml:"path" toml:"path" env:"DB_PATH" flag:"db-path" usage:"путь к файлу базы данных SQLite"`
+}
+
+// Auth настройки аутентификации и ключей подписи JWT.
+// HS256 подписывает токены секретом, RS256 и EdDSA - закрытым ключом из PEM файла.
+// Для смены ключа прежний открытый ключ (или секрет) добавляется в ключи проверки.
+type Auth struct {
+	Algorithm            string   `yaml:"algorithm" toml:"algorithm" env:"JWT_ALGORITHM" flag:"jwt-algorithm" usage:"алгоритм подписи JWT: HS256, RS256 или EdDSA"`
+	JWTSecret            string   `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" flag:"jwt-secret" usage:"секрет подписи JWT токенов (HS256)" secret:"true"`
+	JWTSecretFile        string   `yaml:"jwt_secret_file" toml:"jwt_secret_file" env:"JWT_SECRET_FILE" flag:"jwt-secret-file" usage:"файл с секретом подписи JWT (HS256), важнее jwt_secret"`
+	PrivateKeyFile       string   `yaml:"private_key_file" toml:"private_key_file" env:"JWT_PRIVATE_KEY_FILE" flag:"jwt-private-key-file" usage:"PEM файл закрытого ключа RSA или Ed25519 (RS256, EdDSA)"`
+	KeyID                string   `yaml:"key_id" toml:"key_id" env:"JWT_KEY_ID" flag:"jwt-key-id" usage:"kid ключа подписи (по умолчанию вычисляется по ключу)"`
+	VerificationKeyFiles []string `yaml:"verification_key_files" toml:"verification_key_files" env:"JWT_VERIFICATION_KEY_FILES" flag:"jwt-verification-key-files" usage:"PEM файлы прежних ключей, которыми еще проверяются токены, через запятую"`
+	PreviousSecrets      []string `yaml:"previous_secrets" toml:"previous_secrets" env:"JWT_PREVIOUS_SECRETS" flag:"jwt-previous-secrets" usage:"прежние секреты HS256, которыми еще проверяются токены, через запятую" secret:"true"`
+	TokenTTLMs           int      `yaml:"token_ttl_ms" toml:"token_ttl_ms" env:"TOKEN_TTL_MS" flag:"token-ttl-ms" usage:"время жизни JWT токена, мс"`
+	RefreshTokenTTLMs    int      `yaml:"refresh_token_ttl_ms" toml:"refresh_token_ttl_ms" env:"REFRESH_TOKEN_TTL_MS" flag:"refresh-token-ttl-ms" usage:"время жизни refresh токена (сессии без активности), мс"`
+	AdminLogins          []string `yaml:"admin_logins" toml:"admin_logins" env:"ADMIN_LOGINS" flag:"admin-logins" usage:"логины пользователей, получающих роль admin при запуске, через запятую"`
+	BootstrapAdmin       string   `yaml:"bootstrap_admin" toml:"bootstrap_admin" env:"BOOTSTRAP_ADMIN" flag:"bootstrap-admin" usage:"логин администратора, создаваемого при запуске, если его еще нет"`
+	BootstrapPassword    string   `yaml:"bootstrap_password" toml:"bootstrap_password" env:"BOOTSTRAP_ADMIN_PASSWORD" flag:"bootstrap-admin-password" usage:"пароль создаваемого при запуске администратора" secret:"true"`
+
+	// Требования к логину и паролю при регистрации
+	LoginPattern             string `yaml:"login_pattern" toml:"login_pattern" env:"LOGIN_PATTERN" flag:"login-pattern" usage:"регулярное выражение допустимого логина"`
+	PasswordMinLength        int    `yaml:"password_min_length" toml:"password_min_length" env:"PASSWORD_MIN_LENGTH" flag:"password-min-length" usage:"минимальная длина пароля"`
+	PasswordRequireLetter    bool   `yaml:"password_require_letter" toml:"password_require_letter" env:"PASSWORD_REQUIRE_LETTER" flag:"password-require-letter" usage:"пароль должен содержать букву"`
+	PasswordRequireDigit     bool   `yaml:"password_require_digit" toml:"password_require_digit" env:"PASSWORD_REQUIRE_DIGIT" flag:"password-require-digit" usage:"пароль должен содержать цифру"`
+	PasswordRequireMixedCase bool   `yaml:"password_require_mixed_case" toml:"password_require_mixed_case" env:"PASSWORD_REQUIRE_MIXED_CASE" flag:"password-require-mixed-case" usage:"пароль должен содержать строчные и заглавные буквы"`
+	PasswordRequireSymbol    bool   `yaml:"password_require_symbol" toml:"password_require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" flag:"password-require-symbol" usage:"пароль должен содержать символ, отличный от буквы и цифры"`
+
+	// Временная блокировка входа после неудачных попыток
+	MaxFailedLogins      int `yaml:"max_failed_logins" toml:"max_failed_logins" env:"MAX_FAILED_LOGINS" flag:"max-failed-logins" usage:"неудачных попыток входа в один логин до блокировки"`
+	MaxFailedLoginsPerIP int `yaml:"max_failed_logins_per_ip" toml:"max_failed_logins_per_ip" env:"MAX_FAILED_LOGINS_PER_IP" flag:"max-failed-logins-per-ip" usage:"неудачных попыток входа с одного IP до блокировки"`
+	FailedLoginWindowMs  int `yaml:"failed_login_window_ms" toml:"failed_login_window_ms" env:"FAILED_LOGIN_WINDOW_MS" flag:"failed-login-window-ms" usage:"за какой период считаются неудачные попытки входа, мс"`
+	LockoutMs            int `yaml:"lockout_ms" toml:"lockout_ms" env:"LOGIN_LOCKOUT_MS" flag:"login-lockout-ms" usage:"на сколько блокируется вход после превышения попыток, мс"`
+}
+
+// Operations время выполнения арифметических операций агентом
+type Operations struct {
+	AdditionMs       int `yaml:"addition_ms" toml:"addition_ms" env:"TIME_ADDITION_MS" flag:"time-addition-ms" usage:"время сложения, мс"`
+	SubtractionMs    int `yaml:"subtraction_ms" toml:"subtraction_ms" env:"TIME_SUBTRACTION_MS" flag:"time-subtraction-ms" usage:"время вычитания, мс"`
+	MultiplicationMs int `yaml:"multiplication_ms" toml:"multiplication_ms" env:"TIME_MULTIPLICATIONS_MS" flag:"time-multiplications-ms" usage:"время умножения, мс"`
+	DivisionMs       int `yaml:"division_ms" toml:"division_ms" env:"TIME_DIVISIONS_MS" flag:"time-divisions-ms" usage:"время деления, мс"`
+	IntDivisionMs    int `yaml:"int_division_ms" toml:"int_division_ms" env:"TIME_INT_DIVISIONS_MS" flag:"time-int-divisions-ms" usage:"время целочисленного деления, мс"`
+	ModuloMs         int `yaml:"modulo_ms" toml:"modulo_ms" env:"TIME_MODULO_MS" flag:"time-modulo-ms" usage:"время остатка от деления, мс"`
+	ExponentiationMs int `yaml:"exponentiation_ms" toml:"exponentiation_ms" env:"TIME_EXPONENTIATIONS_MS" flag:"time-exponentiations-ms" usage:"время возведения в степень, мс"`
+	FunctionMs       int `yaml:"function_ms" toml:"function_ms" env:"TIME_FUNCTIONS_MS" flag:"time-functions-ms" usage:"время вычисления встроенной функции (sqrt, min и т.д.), мс"`
+}
+
+// CostMs возвращает время операции класса cost из реестра pkg/operations, мс
+func (o Operations) CostMs(cost operations.Cost) int {
+	switch cost {
+	case operations.CostAddition:
+		return o.AdditionMs
+	case operations.CostSubtraction:
+		return o.SubtractionMs
+	case operations.CostMultiplication:
+		return o.MultiplicationMs
+	case operations.CostDivision:
+		return o.DivisionMs
+	case operations.CostIntDivision:
+		return o.IntDivisionMs
+	case operations.CostModulo:
+		return o.ModuloMs
+	case operations.CostExponentiation:
+		return o.ExponentiationMs
+	case operations.CostFunction:
+		return o.FunctionMs
+	}
+	return 0
+}
+
+// Scheduler настройки выдачи задач агентам
+type Scheduler struct {
+	LeaseSlackMs       int `yaml:"lease_slack_ms" toml:"lease_slack_ms" env:"TASK_LEASE_SLACK_MS" flag:"lease-slack-ms" usage:"запас аренды задачи сверх времени операции, мс"`
+	HeartbeatTimeoutMs int `yaml:"heartbeat_timeout_ms" toml:"heartbeat_timeout_ms" env:"AGENT_HEARTBEAT_TIMEOUT_MS" flag:"heartbeat-timeout-ms" usage:"через сколько без heartbeat агент считается отключившимся, мс"`
+}
+
+// Limits ограничения на отправку выражений для ролей user и admin, 0 - без ограничения.
+// Частота отправки ограничивается маркерным ведром: rate_per_minute маркеров в минуту, не больше burst подряд
+type Limits struct {
+	UserRatePerMinute  int `yaml:"user_rate_per_minute" toml:"user_rate_per_minute" env:"USER_RATE_PER_MINUTE" flag:"user-rate-per-minute" usage:"выражений в минуту для роли user"`
+	UserBurst          int `yaml:"user_burst" toml:"user_burst" env:"USER_BURST" flag:"user-burst" usage:"выражений подряд без ожидания для роли user"`
+	UserMaxPending     int `yaml:"user_max_pending" toml:"user_max_pending" env:"USER_MAX_PENDING" flag:"user-max-pending" usage:"одновременно вычисляемых выражений для роли user"`
+	UserMaxTasks       int `yaml:"user_max_tasks" toml:"user_max_tasks" env:"USER_MAX_TASKS" flag:"user-max-tasks" usage:"задач в одном выражении для роли user"`
+	UserMaxDaily       int `yaml:"user_max_daily" toml:"user_max_daily" env:"USER_MAX_DAILY" flag:"user-max-daily" usage:"выражений в сутки (UTC) для роли user"`
+	AdminRatePerMinute int `yaml:"admin_rate_per_minute" toml:"admin_rate_per_minute" env:"ADMIN_RATE_PER_MINUTE" flag:"admin-rate-per-minute" usage:"выражений в минуту для роли admin"`
+	AdminBurst         int `yaml:"admin_burst" toml:"admin_burst" env:"ADMIN_BURST" flag:"admin-burst" usage:"выражений подряд без ожидания для роли admin"`
+	AdminMaxPending    int `yaml:"admin_max_pending" toml:"admin_max_pending" env:"ADMIN_MAX_PENDING" flag:"admin-max-pending" usage:"одновременно вычисляемых выражений для роли admin"`
+	AdminMaxTasks      int `yaml:"admin_max_tasks" toml:"admin_max_tasks" env:"ADMIN_MAX_TASKS" flag:"admin-max-tasks" usage:"задач в одном выражении для роли admin"`
+	AdminMaxDaily      int `yaml:"admin_max_daily" toml:"admin_max_daily" env:"ADMIN_MAX_DAILY" flag:"admin-max-daily" usage:"выражений в сутки (UTC) для роли admin"`
+}
+
+// RoleLimits ограничения одной роли
+type RoleLimits struct {
+	RatePerMinute int `json:"rate_per_minute"`
+	Burst         int `json:"burst"`
+	MaxPending    int `json:"max_pending"`
+	MaxTasks      int `json:"max_tasks"`
+	MaxDaily      int `json:"max_daily"`
+}
+
+// ForRole возвращает ограничения роли, неизвестные роли ограничиваются как user
+func (l Limits) ForRole(role string) RoleLimits {
+	if role == "admin" {
+		return RoleLimits{l.AdminRatePerMinute, l.AdminBurst, l.AdminMaxPending, l.AdminMaxTasks, l.AdminMaxDaily}
+	}
+	return RoleLimits{l.UserRatePerMinute, l.UserBurst, l.UserMaxPending, l.UserMaxTasks, l.UserMaxDaily}
+}
+
+// Shutdown настройки корректной остановки
+type Shutdown struct {
+	TimeoutMs     int `yaml:"timeout_ms" toml:"timeout_ms" env:"SHUTDOWN_TIMEOUT_MS" flag:"shutdown-timeout-ms" usage:"сколько ждать выполняемые задачи при остановке, мс"`
+	ServerGraceMs int `yaml:"server_grace_ms" toml:"server_grace_ms" env:"SHUTDOWN_SERVER_GRACE_MS" flag:"shutdown-server-grace-ms" usage:"сколько HTTP и gRPC серверы завершают запросы после ожидания задач, мс"`
+}
+
+// Agent настройки агента
+type Agent struct {
+	ComputingPower int      `yaml:"computing_power" toml:"computing_power" env:"COMPUTING_POWER" flag:"computing-power" usage:"число задач, выполняемых агентом одновременно"`
+	Server         string   `yaml:"server" toml:"server" env:"GRPC_SERVER" flag:"grpc-server" usage:"адрес gRPC сервера оркестратора (по умолчанию localhost:<grpc.port>)"`
+	HTTPServer     string   `yaml:"http_server" toml:"http_server" env:"HTTP_SERVER" flag:"http-server" usage:"адрес HTTP сервера оркестратора для HTTP воркеров"`
+	UseHTTP        bool     `yaml:"use_http" toml:"use_http" env:"USE_HTTP" flag:"use-http" usage:"дополнительно запускать HTTP воркеры"`
+	MetricsPort    int      `yaml:"metrics_port" toml:"metrics_port" env:"METRICS_PORT" flag:"metrics-port" usage:"порт HTTP сервера метрик агента"`
+	Operations     []string `yaml:"operations" toml:"operations" env:"AGENT_OPERATIONS" flag:"agent-operations" usage:"операции, которые выполняет агент, через запятую (по умолчанию все известные)"`
+}
+
+// SupportedOperations операции, о которых агент сообщает оркестратору при регистрации
+func (a Agent) SupportedOperations() []string {
+	if len(a.Operations) == 0 {
+		return operations.Symbols()
+	}
+	return a.Operations
+}
+
+// Default возвращает настройки по умолчанию
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Port:        8080,
+			StaticDir:   "./web/static",
+			TemplateDir: "./web/templates",
+		},
+		GRPC:     GRPC{Port: 50052},
+		Database: Database{Path: "./data/calculator.db"},
+		Auth: Auth{
+			Algorithm:         "HS256",
+			JWTSecret:         DefaultJWTSecret,
+			TokenTTLMs:        3600000,
+			RefreshTokenTTLMs: 30 * 24 * 3600000,
+
+			LoginPattern:          DefaultLoginPattern,
+			PasswordMinLength:     8,
+			PasswordRequireLetter: true,
+			PasswordRequireDigit:  true,
+
+			MaxFailedLogins:      5,
+			MaxFailedLoginsPerIP: 20,
+			FailedLoginWindowMs:  900000,
+			LockoutMs:            900000,
+		},
+		Operations: Operations{
+			AdditionMs:       100,
+			SubtractionMs:    100,
+			MultiplicationMs: 200,
+			DivisionMs:       200,
+			IntDivisionMs:    200,
+			ModuloMs:         200,
+			ExponentiationMs: 300,
+			FunctionMs:       200,
+		},
+		Scheduler: Scheduler{
+			LeaseSlackMs:       10000,
+			HeartbeatTimeoutMs: 15000,
+		},
+		Limits: Limits{
+			UserRatePerMinute: 60,
+			UserBurst:         10,
+			UserMaxPending:    20,
+			UserMaxTasks:      500,
+			UserMaxDaily:      5000,
+		},
+		Shutdown: Shutdown{TimeoutMs: 30000, ServerGraceMs: 5000},
+		Agent: Agent{
+			ComputingPower: 3,
+			HTTPServer:     "localhost:8080",
+			MetricsPort:    9100,
+		},
+	}
+}
+
+// AgentServer адрес gRPC сервера оркестратора для агента
+func (c *Config) AgentServer() string {
+	if c.Agent.Server != "" {
+		return c.Agent.Server
+	}
+	return fmt.Sprintf("localhost:%d", c.GRPC.Port)
+}
+
+// PrintRequested сообщает, что указан флаг --print-config
+func (c *Config) PrintRequested() bool {
+	return c.printConfig
+}
+
+// Source возвращает источник значения по ключу "раздел.поле" (например "http.port"):
+// "default", "file", "env:HTTP_PORT" или "flag:--http-port"
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return "default"
+}
+
+// Validate проверяет настройки и возвращает все найденные ошибки
+func (c *Config) Validate() error {
+	var errs []error
+	port := func(key string, value int) {
+		if value < 1 || value > 65535 {
+			errs = append(errs, fmt.Errorf("%s: порт должен быть от 1 до 65535, указано %d", key, value))
+		}
+	}
+	nonNegative := func(key string, value int) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s: значение не может быть отрицательным, указано %d", key, value))
+		}
+	}
+	positive := func(key string, value int) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: значение должно быть больше нуля, указано %d", key, value))
+		}
+	}
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s: значение не может быть пустым", key))
+		}
+	}
+
+	port("http.port", c.HTTP.Port)
+	port("grpc.port", c.GRPC.Port)
+	port("agent.metrics_port", c.Agent.MetricsPort)
+	required("database.path", c.Database.Path)
+	switch c.Auth.Algorithm {
+	case "HS256":
+		if c.Auth.JWTSecretFile == "" {
+			required("auth.jwt_secret", c.Auth.JWTSecret)
+		}
+	case "RS256", "EdDSA":
+		required("auth.private_key_file", c.Auth.PrivateKeyFile)
+	default:
+		errs = append(errs, fmt.Errorf("auth.algorithm: поддерживаются HS256, RS256 и EdDSA, указано %q", c.Auth.Algorithm))
+	}
+	positive("auth.token_ttl_ms", c.Auth.TokenTTLMs)
+	positive("auth.refresh_token_ttl_ms", c.Auth.RefreshTokenTTLMs)
+	if c.Auth.BootstrapAdmin != "" {
+		required("auth.bootstrap_password", c.Auth.BootstrapPassword)
+	}
+	if _, err := regexp.Compile(c.Auth.LoginPattern); err != nil {
+		errs = append(errs, fmt.Errorf("auth.login_pattern: %w", err))
+	}
+	positive("auth.password_min_length", c.Auth.PasswordMinLength)
+	positive("auth.max_failed_logins", c.Auth.MaxFailedLogins)
+	positive("auth.max_failed_logins_per_ip", c.Auth.MaxFailedLoginsPerIP)
+	positive("auth.failed_login_window_ms", c.Auth.FailedLoginWindowMs)
+	positive("auth.lockout_ms", c.Auth.LockoutMs)
+	nonNegative("operations.addition_ms", c.Operations.AdditionMs)
+	nonNegative("operations.subtraction_ms", c.Operations.SubtractionMs)
+	nonNegative("operations.multiplication_ms", c.Operations.MultiplicationMs)
+	nonNegative("operations.division_ms", c.Operations.DivisionMs)
+	nonNegative("operations.int_division_ms", c.Operations.IntDivisionMs)
+	nonNegative("operations.modulo_ms", c.Operations.ModuloMs)
+	nonNegative("operations.exponentiation_ms", c.Operations.ExponentiationMs)
+	nonNegative("operations.function_ms", c.Operations.FunctionMs)
+	nonNegative("scheduler.lease_slack_ms", c.Scheduler.LeaseSlackMs)
+	positive("scheduler.heartbeat_timeout_ms", c.Scheduler.HeartbeatTimeoutMs)
+	for _, role := range []string{"user", "admin"} {
+		limits := c.Limits.ForRole(role)
+		nonNegative("limits."+role+"_rate_per_minute", limits.RatePerMinute)
+		nonNegative("limits."+role+"_max_pending", limits.MaxPending)
+		nonNegative("limits."+role+"_max_tasks", limits.MaxTasks)
+		nonNegative("limits."+role+"_max_daily", limits.MaxDaily)
+		if limits.RatePerMinute > 0 {
+			positive("limits."+role+"_burst", limits.Burst)
+		}
+	}
+	positive("shutdown.timeout_ms", c.Shutdown.TimeoutMs)
+	positive("shutdown.server_grace_ms", c.Shutdown.ServerGraceMs)
+	positive("agent.computing_power", c.Agent.ComputingPower)
+	required("agent.http_server", c.Agent.HTTPServer)
+	for _, op := range c.Agent.Operations {
+		if _, ok := operations.Lookup(op); !ok {
+			errs = append(errs, fmt.Errorf("agent.operations: неизвестная операция %q", op))
+		}
+	}
+
+	return errors.Join(errs...)
+}
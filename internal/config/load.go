@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field поле настроек с ключом и способами задать его значение
+type field struct {
+	key   string   // "раздел.поле" по тегам yaml
+	env   string   // Переменная окружения
+	flags []string // Имена флагов, первое основное
+	usage string
+	value reflect.Value
+}
+
+// fields перечисляет поля разделов настроек
+func (c *Config) fields() []field {
+	var fields []field
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		if section.Type.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.Type.NumField(); j++ {
+			f := section.Type.Field(j)
+			fields = append(fields, field{
+				key:   section.Tag.Get("yaml") + "." + f.Tag.Get("yaml"),
+				env:   f.Tag.Get("env"),
+				flags: strings.Split(f.Tag.Get("flag"), ","),
+				usage: f.Tag.Get("usage"),
+				value: root.Field(i).Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+// setValue присваивает полю значение из строки переменной окружения или флага
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("ожидалось целое число, указано %q", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("ожидалось true или false, указано %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("неподдерживаемый тип %s", v.Type())
+	}
+	return nil
+}
+
+// Load загружает настройки по умолчанию, дополненные файлом, окружением и флагами args
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	if err := cfg.Load(args); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load применяет к текущим значениям файл конфигурации, переменные окружения
+// и флаги args (в порядке возрастания приоритета) и проверяет результат.
+// Файл задается флагом --config или переменной CONFIG_FILE; формат определяется
+// по расширению: .yaml, .yml или .toml.
+func (c *Config) Load(args []string) error {
+	c.sources = make(map[string]string)
+	fields := c.fields()
+
+	// Флаги разбираем сразу, чтобы узнать путь к файлу, но применяем последними
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "файл конфигурации YAML или TOML (CONFIG_FILE)")
+	fs.BoolVar(&c.printConfig, "print-config", false, "вывести действующую конфигурацию и выйти")
+
+	type flagValue struct {
+		field *field
+		name  string
+		value string
+	}
+	var flagValues []flagValue
+	for i := range fields {
+		f := &fields[i]
+		for _, name := range f.flags {
+			name := name
+			usage := fmt.Sprintf("%s (%s, %s)", f.usage, f.env, f.key)
+			fs.Func(name, usage, func(s string) error {
+				flagValues = append(flagValues, flagValue{field: f, name: name, value: s})
+				return nil
+			})
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return fmt.Errorf("файл конфигурации %s: %w", *configFile, err)
+		}
+		c.File = *configFile
+	}
+
+	var errs []error
+	for _, f := range fields {
+		value, ok := os.LookupEnv(f.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setValue(f.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("переменная %s: %w", f.env, err))
+			continue
+		}
+		c.sources[f.key] = "env:" + f.env
+	}
+	for _, fv := range flagValues {
+		if err := setValue(fv.field.value, fv.value); err != nil {
+			errs = append(errs, fmt.Errorf("флаг --%s: %w", fv.name, err))
+			continue
+		}
+		c.sources[fv.field.key] = "flag:--" + fv.name
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return c.Validate()
+}
+
+// loadFile читает файл конфигурации. Неизвестные ключи считаются ошибкой,
+// чтобы опечатка в имени настройки не осталась незамеченной.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		var raw map[string]map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		for section, values := range raw {
+			for name := range values {
+				keys = append(keys, section+"."+name)
+			}
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("неизвестные ключи: %v", undecoded)
+		}
+		for _, key := range meta.Keys() {
+			if len(key) == 2 {
+				keys = append(keys, key.String())
+			}
+		}
+	default:
+		return fmt.Errorf("неизвестный формат %q, ожидается .yaml, .yml или .toml", filepath.Ext(path))
+	}
+
+	for _, key := range keys {
+		c.sources[key] = "file"
+	}
+	return nil
+}
+
+// Print записывает действующие настройки в формате YAML. Секреты маскируются,
+// у значений не по умолчанию в комментарии указан источник.
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	for _, f := range masked.fields() {
+		if !isSecret(f.key) {
+			continue
+		}
+		switch {
+		case f.value.Kind() == reflect.String && f.value.String() != "":
+			f.value.SetString("***")
+		case f.value.Kind() == reflect.Slice && f.value.Len() > 0:
+			hidden := make([]string, f.value.Len())
+			for i := range hidden {
+				hidden[i] = "***"
+			}
+			f.value.Set(reflect.ValueOf(hidden))
+		}
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(&masked); err != nil {
+		return err
+	}
+	sections := doc.Content
+	for i := 0; i+1 < len(sections); i += 2 {
+		values := sections[i+1].Content
+		for j := 0; j+1 < len(values); j += 2 {
+			if source, ok := c.sources[sections[i].Value+"."+values[j].Value]; ok {
+				values[j+1].LineComment = source
+			}
+		}
+	}
+
+	if c.File != "" {
+		fmt.Fprintf(w, "# файл конфигурации: %s\n", c.File)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// isSecret сообщает, что значение поля нельзя выводить в журнал
+func isSecret(key string) bool {
+	section, name, _ := strings.Cut(key, ".")
+	for _, s := range reflect.VisibleFields(reflect.TypeOf(Config{})) {
+		if s.Tag.Get("yaml") != section || s.Type.Kind() != reflect.Struct {
+			continue
+		}
+		for _, f := range reflect.VisibleFields(s.Type) {
+			if f.Tag.Get("yaml") == name {
+				return f.Tag.Get("secret") == "true"
+			}
+		}
+	}
+	return false
+}
+
+// MustLoad загружает настройки команды из os.Args и окружения.
+// При ошибке завершает процесс, при --print-config выводит настройки и завершает процесс.
+func MustLoad(cfg *Config) *Config {
+	if err := cfg.Load(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatalf("Ошибка конфигурации: %v", err)
+	}
+	if cfg.PrintRequested() {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Ошибка вывода конфигурации: %v", err)
+		}
+		os.Exit(0)
+	}
+	return cfg
+}
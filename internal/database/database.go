@@ -1,28 +1,98 @@
 package database
 
 import (
+	"errors"
+
 	"github.com/GGmuzem/yandex-project/pkg/models"
 )
 
+var (
+	// ErrNotFound запись не найдена
+	ErrNotFound = errors.New("запись не найдена")
+	// ErrRefreshTokenUsed refresh токен уже обменян на новый
+	ErrRefreshTokenUsed = errors.New("refresh токен уже использован")
+	// ErrAlreadyExists запись с таким ключом уже существует
+	ErrAlreadyExists = errors.New("запись уже существует")
+)
+
 // Database интерфейс для работы с хранилищем данных
 type Database interface {
 	// Миграция и управление соединением
 	MigrateDB() error
 	Close() error
+	// Ping проверяет, что хранилище доступно и отвечает на запросы
+	Ping() error
 
 	// Методы для работы с пользователями
 	UserExists(login string) (bool, error)
 	CreateUser(user *models.User) (int, error)
 	GetUserByLogin(login string) (*models.User, error)
+	GetUserByID(id int) (*models.User, error)
+	// SetUserRole меняет роль пользователя, возвращает ErrNotFound для несуществующего логина
+	SetUserRole(login, role string) error
 
 	// Методы для работы с выражениями
 	SaveExpression(expr *models.Expression) error
-	UpdateExpressionStatus(id string, status string, result float64) error
+	// errMsg содержит причину ошибки для статуса error и пуст для остальных статусов
+	UpdateExpressionStatus(id string, status string, result float64, errMsg string) error
 	GetExpression(id string, userID int) (*models.Expression, error)
+	// GetExpressionByID возвращает выражение любого пользователя, ErrNotFound для отсутствующего
+	GetExpressionByID(id string) (*models.Expression, error)
 	GetExpressions(userID int) ([]*models.Expression, error)
+	// CountUserExpressions возвращает число вычисляемых выражений пользователя и число выражений,
+	// отправленных начиная с since (секунды Unix)
+	CountUserExpressions(userID int, since int64) (pending int, submitted int, err error)
 
 	// Методы для работы с результатами вычислений
 	SaveResult(taskID int, result float64, exprID string) error
 	GetResult(taskID int) (float64, error)
 	GetResultsByExprID(exprID string) (map[int]float64, error)
+
+	// Методы для работы с задачами, по которым восстанавливается состояние после перезапуска
+	SaveTasks(tasks []models.Task) error
+	// leaseID пустой, если аренда снята и задача вернулась в очередь
+	UpdateTaskLease(taskID int, leaseID string, startedAt int64) error
+	CancelTasks(exprID string) error
+	GetUnfinishedTasks() ([]models.StoredTask, error)
+	// Возвращает все задачи выражения, включая выполненные и отмененные, в исходном виде
+	GetTasksByExprID(exprID string) ([]models.StoredTask, error)
+	GetPendingExpressions() ([]*models.Expression, error)
+	GetMaxTaskID() (int, error)
+
+	// Методы для работы с реестром агентов
+	SaveAgent(agent *models.Agent) error
+	GetAgents() ([]*models.Agent, error)
+
+	// Методы для работы с сессиями и refresh токенами, возвращают ErrNotFound для отсутствующих записей
+	CreateSession(session *models.Session, token *models.RefreshToken) error
+	GetSession(id string) (*models.Session, error)
+	GetRefreshToken(hash string) (*models.RefreshToken, error)
+	// RotateRefreshToken помечает токен usedHash использованным, сохраняет следующий токен сессии
+	// и продлевает сессию до его срока. Возвращает ErrRefreshTokenUsed, если токен уже использован.
+	RotateRefreshToken(usedHash string, usedAt int64, next *models.RefreshToken) error
+	RevokeSession(id string, revokedAt int64) error
+
+	// Методы для работы с ключами API, возвращают ErrNotFound для отсутствующих записей
+	CreateAPIKey(key *models.APIKey) (int, error)
+	GetAPIKeys(userID int) ([]*models.APIKey, error)
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	TouchAPIKey(id int, usedAt int64) error
+	// RevokeAPIKey отзывает ключ пользователя userID, чужие ключи считаются отсутствующими
+	RevokeAPIKey(id, userID int, revokedAt int64) error
+
+	// Методы для работы с формулами пользователя. Формула ищется по владельцу и имени,
+	// возвращают ErrNotFound для отсутствующих формул
+	// CreateFormula возвращает ErrAlreadyExists, если у пользователя уже есть формула с таким именем
+	CreateFormula(formula *models.Formula) (int, error)
+	GetFormulas(userID int) ([]*models.Formula, error)
+	GetFormula(userID int, name string) (*models.Formula, error)
+	// UpdateFormula меняет выражение, параметры и момент изменения формулы
+	UpdateFormula(formula *models.Formula) error
+	DeleteFormula(userID int, name string) error
+	SetFormulaLastExpression(id int, exprID string) error
+
+	// Методы для работы с журналом событий безопасности
+	SaveAuditEntry(entry *models.AuditEntry) error
+	// GetAuditEntries возвращает последние limit записей, новые первыми
+	GetAuditEntries(limit int) ([]*models.AuditEntry, error)
 }
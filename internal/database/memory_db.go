@@ -2,6 +2,9 @@ package database
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,9 +17,19 @@ type MemoryDB struct {
 	users       map[string]*models.User
 	expressions map[string]*models.Expression
 	results     map[int]float64
+	resultExpr  map[int]string // Связь результата с выражением: task_id -> expression_id
+	tasks       map[int]*models.StoredTask
+	agents      map[int32]*models.Agent
+	sessions    map[string]*models.Session
+	refresh     map[string]*models.RefreshToken // По хешу токена
+	apiKeys     map[int]*models.APIKey
+	formulas    map[int]*models.Formula
+	audit       []*models.AuditEntry
 	userByID    map[int]*models.User
 	mutex       sync.RWMutex
 	userIDSeq   int
+	apiKeySeq   int
+	formulaSeq  int
 }
 
 // NewMemoryDB создает новую in-memory БД
@@ -25,8 +38,17 @@ func NewMemoryDB() *MemoryDB {
 		users:       make(map[string]*models.User),
 		expressions: make(map[string]*models.Expression),
 		results:     make(map[int]float64),
+		resultExpr:  make(map[int]string),
+		tasks:       make(map[int]*models.StoredTask),
+		agents:      make(map[int32]*models.Agent),
+		sessions:    make(map[string]*models.Session),
+		refresh:     make(map[string]*models.RefreshToken),
+		apiKeys:     make(map[int]*models.APIKey),
+		formulas:    make(map[int]*models.Formula),
 		userByID:    make(map[int]*models.User),
 		userIDSeq:   1,
+		apiKeySeq:   1,
+		formulaSeq:  1,
 	}
 }
 
@@ -75,6 +97,10 @@ func (db *MemoryDB) CreateUser(user *models.User) (int, error) {
 		ID:       userID,
 		Login:    user.Login,
 		Password: string(hashedPassword),
+		Role:     user.Role,
+	}
+	if newUser.Role == "" {
+		newUser.Role = models.RoleUser
 	}
 
 	// Сохраняем пользователя
@@ -96,6 +122,31 @@ func (db *MemoryDB) GetUserByLogin(login string) (*models.User, error) {
 	return user, nil
 }
 
+// GetUserByID получает пользователя по ID
+func (db *MemoryDB) GetUserByID(id int) (*models.User, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	user, exists := db.userByID[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+// SetUserRole меняет роль пользователя
+func (db *MemoryDB) SetUserRole(login, role string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	user, exists := db.users[login]
+	if !exists {
+		return ErrNotFound
+	}
+	user.Role = role
+	return nil
+}
+
 // SaveExpression сохраняет выражение в БД
 func (db *MemoryDB) SaveExpression(expr *models.Expression) error {
 	db.mutex.Lock()
@@ -103,18 +154,44 @@ func (db *MemoryDB) SaveExpression(expr *models.Expression) error {
 
 	// Создаем копию выражения
 	newExpr := &models.Expression{
-		ID:        expr.ID,
-		Status:    expr.Status,
-		UserID:    expr.UserID,
-		CreatedAt: time.Now().Unix(),
+		ID:         expr.ID,
+		Status:     expr.Status,
+		Result:     expr.Result,
+		UserID:     expr.UserID,
+		CreatedAt:  time.Now().Unix(),
+		Expression: expr.Expression,
+		Normalized: expr.Normalized,
+		TaskCount:  expr.TaskCount,
+		Error:      expr.Error,
+		Variables:  maps.Clone(expr.Variables),
 	}
 
 	db.expressions[expr.ID] = newExpr
 	return nil
 }
 
+// CountUserExpressions считает вычисляемые и недавно отправленные выражения пользователя
+func (db *MemoryDB) CountUserExpressions(userID int, since int64) (int, int, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	pending, submitted := 0, 0
+	for _, expr := range db.expressions {
+		if expr.UserID != userID {
+			continue
+		}
+		if expr.Status == "pending" {
+			pending++
+		}
+		if expr.CreatedAt >= since {
+			submitted++
+		}
+	}
+	return pending, submitted, nil
+}
+
 // UpdateExpressionStatus обновляет статус выражения
-func (db *MemoryDB) UpdateExpressionStatus(id string, status string, result float64) error {
+func (db *MemoryDB) UpdateExpressionStatus(id string, status string, result float64, errMsg string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
@@ -125,6 +202,7 @@ func (db *MemoryDB) UpdateExpressionStatus(id string, status string, result floa
 
 	expr.Status = status
 	expr.Result = result
+	expr.Error = errMsg
 	return nil
 }
 
@@ -140,6 +218,18 @@ func (db *MemoryDB) GetExpression(id string, userID int) (*models.Expression, er
 	return expr, nil
 }
 
+// GetExpressionByID возвращает выражение по ID без проверки владельца
+func (db *MemoryDB) GetExpressionByID(id string) (*models.Expression, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	expr, exists := db.expressions[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return expr, nil
+}
+
 // GetExpressions возвращает все выражения пользователя
 func (db *MemoryDB) GetExpressions(userID int) ([]*models.Expression, error) {
 	db.mutex.RLock()
@@ -160,6 +250,12 @@ func (db *MemoryDB) SaveResult(taskID int, result float64, exprID string) error
 	defer db.mutex.Unlock()
 
 	db.results[taskID] = result
+	db.resultExpr[taskID] = exprID
+	if task, exists := db.tasks[taskID]; exists {
+		task.State = models.TaskStateDone
+		task.LeaseID = ""
+		task.StartedAt = 0
+	}
 	return nil
 }
 
@@ -177,6 +273,424 @@ func (db *MemoryDB) GetResult(taskID int) (float64, error) {
 
 // GetResultsByExprID возвращает все результаты для выражения
 func (db *MemoryDB) GetResultsByExprID(exprID string) (map[int]float64, error) {
-	// Для упрощенной in-memory версии возвращаем пустую карту
-	return make(map[int]float64), nil
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	results := make(map[int]float64)
+	for taskID, id := range db.resultExpr {
+		if id == exprID {
+			results[taskID] = db.results[taskID]
+		}
+	}
+	return results, nil
+}
+
+// SaveTasks сохраняет задачи выражения в состоянии pending
+func (db *MemoryDB) SaveTasks(tasks []models.Task) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, task := range tasks {
+		task.LeaseID = ""
+		db.tasks[task.ID] = &models.StoredTask{Task: task, State: models.TaskStatePending}
+	}
+	return nil
+}
+
+// UpdateTaskLease сохраняет аренду задачи. Пустой leaseID возвращает задачу в состояние pending
+func (db *MemoryDB) UpdateTaskLease(taskID int, leaseID string, startedAt int64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	task, exists := db.tasks[taskID]
+	if !exists || (task.State != models.TaskStatePending && task.State != models.TaskStateProcessing) {
+		return nil
+	}
+
+	task.LeaseID = leaseID
+	if leaseID == "" {
+		task.State = models.TaskStatePending
+		task.StartedAt = 0
+	} else {
+		task.State = models.TaskStateProcessing
+		task.StartedAt = startedAt
+	}
+	return nil
+}
+
+// CancelTasks отменяет невыполненные задачи выражения
+func (db *MemoryDB) CancelTasks(exprID string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, task := range db.tasks {
+		if task.ExpressionID == exprID && task.State != models.TaskStateDone {
+			task.State = models.TaskStateCancelled
+			task.LeaseID = ""
+			task.StartedAt = 0
+		}
+	}
+	return nil
+}
+
+// GetUnfinishedTasks возвращает задачи в состояниях pending и processing
+func (db *MemoryDB) GetUnfinishedTasks() ([]models.StoredTask, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	tasks := []models.StoredTask{}
+	for _, task := range db.tasks {
+		if task.State == models.TaskStatePending || task.State == models.TaskStateProcessing {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// GetTasksByExprID возвращает граф задач выражения со ссылками на результаты в аргументах
+func (db *MemoryDB) GetTasksByExprID(exprID string) ([]models.StoredTask, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	tasks := []models.StoredTask{}
+	for _, task := range db.tasks {
+		if task.ExpressionID == exprID {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// GetPendingExpressions возвращает выражения всех пользователей, которые еще вычисляются
+func (db *MemoryDB) GetPendingExpressions() ([]*models.Expression, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	expressions := []*models.Expression{}
+	for _, expr := range db.expressions {
+		if expr.Status == "pending" {
+			exprCopy := *expr
+			expressions = append(expressions, &exprCopy)
+		}
+	}
+	return expressions, nil
+}
+
+// GetMaxTaskID возвращает наибольший ID сохраненной задачи, чтобы продолжить нумерацию
+func (db *MemoryDB) GetMaxTaskID() (int, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	maxID := 0
+	for taskID := range db.tasks {
+		if taskID > maxID {
+			maxID = taskID
+		}
+	}
+	for taskID := range db.results {
+		if taskID > maxID {
+			maxID = taskID
+		}
+	}
+	return maxID, nil
+}
+
+// Ping всегда успешен: данные хранятся в памяти процесса
+func (db *MemoryDB) Ping() error {
+	return nil
+}
+
+// SaveAgent сохраняет или обновляет запись агента
+func (db *MemoryDB) SaveAgent(agent *models.Agent) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	agentCopy := *agent
+	db.agents[agent.ID] = &agentCopy
+	return nil
+}
+
+// GetAgents возвращает всех зарегистрированных агентов
+func (db *MemoryDB) GetAgents() ([]*models.Agent, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	agents := make([]*models.Agent, 0, len(db.agents))
+	for _, agent := range db.agents {
+		agentCopy := *agent
+		agents = append(agents, &agentCopy)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return agents, nil
+}
+
+// CreateSession сохраняет новую сессию и ее первый refresh токен
+func (db *MemoryDB) CreateSession(session *models.Session, token *models.RefreshToken) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	sessionCopy, tokenCopy := *session, *token
+	db.sessions[session.ID] = &sessionCopy
+	db.refresh[token.Hash] = &tokenCopy
+	return nil
+}
+
+// GetSession возвращает сессию по ID
+func (db *MemoryDB) GetSession(id string) (*models.Session, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	session, exists := db.sessions[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	sessionCopy := *session
+	return &sessionCopy, nil
+}
+
+// GetRefreshToken возвращает refresh токен по хешу
+func (db *MemoryDB) GetRefreshToken(hash string) (*models.RefreshToken, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	token, exists := db.refresh[hash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	tokenCopy := *token
+	return &tokenCopy, nil
+}
+
+// RotateRefreshToken обменивает refresh токен на следующий
+func (db *MemoryDB) RotateRefreshToken(usedHash string, usedAt int64, next *models.RefreshToken) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	used, exists := db.refresh[usedHash]
+	if !exists {
+		return ErrNotFound
+	}
+	if used.UsedAt != 0 {
+		return ErrRefreshTokenUsed
+	}
+	used.UsedAt = usedAt
+
+	nextCopy := *next
+	db.refresh[next.Hash] = &nextCopy
+	if session, exists := db.sessions[next.SessionID]; exists {
+		session.ExpiresAt = next.ExpiresAt
+	}
+	return nil
+}
+
+// RevokeSession завершает сессию
+func (db *MemoryDB) RevokeSession(id string, revokedAt int64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	session, exists := db.sessions[id]
+	if !exists {
+		return ErrNotFound
+	}
+	if session.RevokedAt == 0 {
+		session.RevokedAt = revokedAt
+	}
+	return nil
+}
+
+// CreateAPIKey сохраняет ключ API и возвращает его ID
+func (db *MemoryDB) CreateAPIKey(key *models.APIKey) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	keyCopy := *key
+	keyCopy.ID = db.apiKeySeq
+	db.apiKeySeq++
+	db.apiKeys[keyCopy.ID] = &keyCopy
+	return keyCopy.ID, nil
+}
+
+// GetAPIKeys возвращает ключи API пользователя в порядке создания
+func (db *MemoryDB) GetAPIKeys(userID int) ([]*models.APIKey, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	keys := make([]*models.APIKey, 0)
+	for _, key := range db.apiKeys {
+		if key.UserID == userID {
+			keyCopy := *key
+			keys = append(keys, &keyCopy)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// GetAPIKeyByHash возвращает ключ API по хешу
+func (db *MemoryDB) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, key := range db.apiKeys {
+		if key.Hash == hash {
+			keyCopy := *key
+			return &keyCopy, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// TouchAPIKey запоминает момент последнего использования ключа API
+func (db *MemoryDB) TouchAPIKey(id int, usedAt int64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	key, exists := db.apiKeys[id]
+	if !exists {
+		return ErrNotFound
+	}
+	key.LastUsedAt = usedAt
+	return nil
+}
+
+// RevokeAPIKey отзывает ключ API пользователя
+func (db *MemoryDB) RevokeAPIKey(id, userID int, revokedAt int64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	key, exists := db.apiKeys[id]
+	if !exists || key.UserID != userID {
+		return ErrNotFound
+	}
+	if key.RevokedAt == 0 {
+		key.RevokedAt = revokedAt
+	}
+	return nil
+}
+
+// cloneFormula копирует формулу вместе со списком параметров
+func cloneFormula(formula *models.Formula) *models.Formula {
+	formulaCopy := *formula
+	formulaCopy.Parameters = slices.Clone(formula.Parameters)
+	formulaCopy.LastEvaluation = nil
+	return &formulaCopy
+}
+
+// findFormula ищет формулу пользователя по имени. Вызывается под мьютексом
+func (db *MemoryDB) findFormula(userID int, name string) *models.Formula {
+	for _, formula := range db.formulas {
+		if formula.UserID == userID && formula.Name == name {
+			return formula
+		}
+	}
+	return nil
+}
+
+// CreateFormula сохраняет формулу и возвращает ее ID
+func (db *MemoryDB) CreateFormula(formula *models.Formula) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.findFormula(formula.UserID, formula.Name) != nil {
+		return 0, ErrAlreadyExists
+	}
+	formulaCopy := cloneFormula(formula)
+	formulaCopy.ID = db.formulaSeq
+	db.formulaSeq++
+	db.formulas[formulaCopy.ID] = formulaCopy
+	return formulaCopy.ID, nil
+}
+
+// GetFormulas возвращает формулы пользователя в алфавитном порядке имен
+func (db *MemoryDB) GetFormulas(userID int) ([]*models.Formula, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	formulas := make([]*models.Formula, 0)
+	for _, formula := range db.formulas {
+		if formula.UserID == userID {
+			formulas = append(formulas, cloneFormula(formula))
+		}
+	}
+	sort.Slice(formulas, func(i, j int) bool { return formulas[i].Name < formulas[j].Name })
+	return formulas, nil
+}
+
+// GetFormula возвращает формулу пользователя по имени
+func (db *MemoryDB) GetFormula(userID int, name string) (*models.Formula, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	formula := db.findFormula(userID, name)
+	if formula == nil {
+		return nil, ErrNotFound
+	}
+	return cloneFormula(formula), nil
+}
+
+// UpdateFormula меняет выражение, параметры и момент изменения формулы
+func (db *MemoryDB) UpdateFormula(formula *models.Formula) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	stored := db.findFormula(formula.UserID, formula.Name)
+	if stored == nil {
+		return ErrNotFound
+	}
+	stored.Expression = formula.Expression
+	stored.Parameters = slices.Clone(formula.Parameters)
+	stored.UpdatedAt = formula.UpdatedAt
+	return nil
+}
+
+// DeleteFormula удаляет формулу пользователя
+func (db *MemoryDB) DeleteFormula(userID int, name string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	formula := db.findFormula(userID, name)
+	if formula == nil {
+		return ErrNotFound
+	}
+	delete(db.formulas, formula.ID)
+	return nil
+}
+
+// SetFormulaLastExpression запоминает выражение последнего вычисления формулы
+func (db *MemoryDB) SetFormulaLastExpression(id int, exprID string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	formula, exists := db.formulas[id]
+	if !exists {
+		return ErrNotFound
+	}
+	formula.LastExpressionID = exprID
+	return nil
+}
+
+// SaveAuditEntry добавляет запись в журнал событий безопасности
+func (db *MemoryDB) SaveAuditEntry(entry *models.AuditEntry) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	entryCopy := *entry
+	entryCopy.ID = len(db.audit) + 1
+	db.audit = append(db.audit, &entryCopy)
+	return nil
+}
+
+// GetAuditEntries возвращает последние записи журнала, новые первыми
+func (db *MemoryDB) GetAuditEntries(limit int) ([]*models.AuditEntry, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	entries := make([]*models.AuditEntry, 0, limit)
+	for i := len(db.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entryCopy := *db.audit[i]
+		entries = append(entries, &entryCopy)
+	}
+	return entries, nil
 }
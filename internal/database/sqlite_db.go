@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -41,7 +43,7 @@ func (db *SQLiteDB) Close() error {
 
 // MigrateDB выполняет миграцию базы данных
 func (db *SQLiteDB) MigrateDB() error {
-	// Удаляем старую таблицу results
+	// Удаляем устаревшую таблицу results, результаты задач хранятся в task_results
 	_, err := db.db.Exec(`DROP TABLE IF EXISTS results`)
 	if err != nil {
 		return fmt.Errorf("не удалось удалить таблицу results: %w", err)
@@ -53,12 +55,18 @@ func (db *SQLiteDB) MigrateDB() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		login TEXT NOT NULL UNIQUE,
 		password TEXT NOT NULL,
-		created_at INTEGER NOT NULL
+		created_at INTEGER NOT NULL,
+		role TEXT NOT NULL DEFAULT 'user'
 	)`)
 	if err != nil {
 		return fmt.Errorf("не удалось создать таблицу users: %w", err)
 	}
 
+	// Пользователи, созданные до появления ролей, получают роль user
+	if err := db.addColumnIfMissing("users", "role", "TEXT NOT NULL DEFAULT 'user'"); err != nil {
+		return err
+	}
+
 	// Создаем таблицу выражений
 	_, err = db.db.Exec(`
 	CREATE TABLE IF NOT EXISTS expressions (
@@ -67,32 +75,219 @@ func (db *SQLiteDB) MigrateDB() error {
 		result REAL,
 		user_id INTEGER NOT NULL,
 		created_at INTEGER NOT NULL,
+		expression TEXT NOT NULL DEFAULT '',
+		normalized TEXT NOT NULL DEFAULT '',
+		task_count INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
 		FOREIGN KEY (user_id) REFERENCES users (id)
 	)`)
 	if err != nil {
 		return fmt.Errorf("не удалось создать таблицу expressions: %w", err)
 	}
 
+	// Добавляем новые колонки в таблицу выражений, созданную предыдущими версиями
+	for _, column := range []struct{ name, definition string }{
+		{"expression", "TEXT NOT NULL DEFAULT ''"},
+		{"normalized", "TEXT NOT NULL DEFAULT ''"},
+		{"task_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"error", "TEXT NOT NULL DEFAULT ''"},
+		{"variables", "TEXT NOT NULL DEFAULT ''"}, // JSON-объект имя -> значение
+	} {
+		if err := db.addColumnIfMissing("expressions", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Создаем таблицу задач: граф вычислений выражения и состояние выполнения
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS tasks (
+		id INTEGER PRIMARY KEY,
+		expression_id TEXT NOT NULL,
+		arg1 TEXT NOT NULL,
+		arg2 TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		operation_time INTEGER NOT NULL,
+		state TEXT NOT NULL DEFAULT 'pending',
+		lease_id TEXT NOT NULL DEFAULT '',
+		started_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (expression_id) REFERENCES expressions (id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу tasks: %w", err)
+	}
+
+	// Аргументы вызовов функций хранятся JSON-массивом, у бинарных операций пусто
+	if err := db.addColumnIfMissing("tasks", "args", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	_, err = db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_tasks_state ON tasks(state)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать индекс для таблицы tasks: %w", err)
+	}
+
 	// Создаем таблицу для хранения результатов вычислений
 	_, err = db.db.Exec(`
-	CREATE TABLE IF NOT EXISTS results (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		task_id INTEGER NOT NULL UNIQUE,
+	CREATE TABLE IF NOT EXISTS task_results (
+		task_id INTEGER PRIMARY KEY,
 		result REAL NOT NULL,
 		expression_id TEXT NOT NULL,
 		created_at INTEGER NOT NULL,
 		FOREIGN KEY (expression_id) REFERENCES expressions (id)
 	)`)
 	if err != nil {
-		return fmt.Errorf("не удалось создать таблицу results: %w", err)
+		return fmt.Errorf("не удалось создать таблицу task_results: %w", err)
 	}
 	
 	// Создаем индекс для ускорения поиска по expression_id
-	_, err = db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_results_expression_id ON results(expression_id)`)
+	_, err = db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_task_results_expression_id ON task_results(expression_id)`)
 	if err != nil {
-		return fmt.Errorf("не удалось создать индекс для таблицы results: %w", err)
+		return fmt.Errorf("не удалось создать индекс для таблицы task_results: %w", err)
 	}
 
+	// Создаем таблицу реестра агентов
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS agents (
+		id INTEGER PRIMARY KEY,
+		hostname TEXT NOT NULL,
+		version TEXT NOT NULL,
+		capacity INTEGER NOT NULL,
+		in_flight INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		registered_at INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу agents: %w", err)
+	}
+
+	// Поддерживаемые агентом операции хранятся JSON-массивом, пусто - агент их не сообщил
+	if err := db.addColumnIfMissing("agents", "operations", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Создаем таблицы сессий и refresh токенов (хранятся только хеши токенов)
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		revoked_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу sessions: %w", err)
+	}
+
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		used_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (session_id) REFERENCES sessions (id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу refresh_tokens: %w", err)
+	}
+
+	_, err = db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать индекс для таблицы refresh_tokens: %w", err)
+	}
+
+	// Создаем таблицу ключей API (хранятся только хеши ключей)
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		last_used_at INTEGER NOT NULL DEFAULT 0,
+		revoked_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу api_keys: %w", err)
+	}
+
+	_, err = db.db.Exec(`CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать индекс для таблицы api_keys: %w", err)
+	}
+
+	// Создаем таблицу сохраненных формул пользователей
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS formulas (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		expression TEXT NOT NULL,
+		parameters TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		last_expression_id TEXT NOT NULL DEFAULT '',
+		UNIQUE (user_id, name),
+		FOREIGN KEY (user_id) REFERENCES users (id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу formulas: %w", err)
+	}
+
+	// Создаем журнал событий безопасности
+	_, err = db.db.Exec(`
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		login TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		return fmt.Errorf("не удалось создать таблицу audit_log: %w", err)
+	}
+
+	return nil
+}
+
+// addColumnIfMissing добавляет колонку в таблицу, если ее еще нет
+func (db *SQLiteDB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("не удалось получить структуру таблицы %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("не удалось добавить колонку %s в таблицу %s: %w", column, table, err)
+	}
+	log.Printf("В таблицу %s добавлена колонка %s", table, column)
 	return nil
 }
 
@@ -123,10 +318,15 @@ func (db *SQLiteDB) CreateUser(user *models.User) (int, error) {
 		return 0, err
 	}
 
+	role := user.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
 	// Сохраняем пользователя
 	result, err := db.db.Exec(
-		"INSERT INTO users (login, password, created_at) VALUES (?, ?, ?)",
-		user.Login, string(hashedPassword), time.Now().Unix(),
+		"INSERT INTO users (login, password, created_at, role) VALUES (?, ?, ?, ?)",
+		user.Login, string(hashedPassword), time.Now().Unix(), role,
 	)
 	if err != nil {
 		return 0, err
@@ -144,8 +344,8 @@ func (db *SQLiteDB) CreateUser(user *models.User) (int, error) {
 // GetUserByLogin возвращает пользователя по логину
 func (db *SQLiteDB) GetUserByLogin(login string) (*models.User, error) {
 	user := &models.User{}
-	err := db.db.QueryRow("SELECT id, login, password FROM users WHERE login = ?", login).Scan(
-		&user.ID, &user.Login, &user.Password,
+	err := db.db.QueryRow("SELECT id, login, password, role FROM users WHERE login = ?", login).Scan(
+		&user.ID, &user.Login, &user.Password, &user.Role,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -156,17 +356,67 @@ func (db *SQLiteDB) GetUserByLogin(login string) (*models.User, error) {
 	return user, nil
 }
 
+// GetUserByID получает пользователя по ID
+func (db *SQLiteDB) GetUserByID(id int) (*models.User, error) {
+	user := &models.User{}
+	err := db.db.QueryRow("SELECT id, login, password, role FROM users WHERE id = ?", id).Scan(
+		&user.ID, &user.Login, &user.Password, &user.Role,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetUserRole меняет роль пользователя
+func (db *SQLiteDB) SetUserRole(login, role string) error {
+	res, err := db.db.Exec("UPDATE users SET role = ? WHERE login = ?", role, login)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // SaveExpression сохраняет выражение в БД
 func (db *SQLiteDB) SaveExpression(expr *models.Expression) error {
-	_, err := db.db.Exec(
-		"INSERT INTO expressions (id, status, user_id, created_at) VALUES (?, ?, ?, ?)",
-		expr.ID, expr.Status, expr.UserID, time.Now().Unix(),
+	// Результат есть только у уже вычисленных выражений (например, у констант)
+	result := sql.NullFloat64{Float64: expr.Result, Valid: expr.Status == "completed"}
+	variables, err := encodeVariables(expr.Variables)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.Exec(
+		`INSERT INTO expressions (id, status, result, user_id, created_at, expression, normalized, task_count, error, variables)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		expr.ID, expr.Status, result, expr.UserID, time.Now().Unix(),
+		expr.Expression, expr.Normalized, expr.TaskCount, expr.Error, variables,
 	)
 	return err
 }
 
+// CountUserExpressions считает вычисляемые и недавно отправленные выражения пользователя
+func (db *SQLiteDB) CountUserExpressions(userID int, since int64) (int, int, error) {
+	var pending, submitted int
+	err := db.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0)
+		FROM expressions WHERE user_id = ?`, since, userID).Scan(&pending, &submitted)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pending, submitted, nil
+}
+
 // UpdateExpressionStatus обновляет статус выражения
-func (db *SQLiteDB) UpdateExpressionStatus(id string, status string, result float64) error {
+func (db *SQLiteDB) UpdateExpressionStatus(id string, status string, result float64, errMsg string) error {
 	log.Printf("=== ОТЛАДКА SQLiteDB.UpdateExpressionStatus: Обновление выражения %s, статус %s, результат %f", id, status, result)
 	
 	// Проверяем текущее значение в БД перед обновлением
@@ -198,8 +448,8 @@ func (db *SQLiteDB) UpdateExpressionStatus(id string, status string, result floa
 	
 	// Выполняем обновление
 	res, err := db.db.Exec(
-		"UPDATE expressions SET status = ?, result = ? WHERE id = ?",
-		status, result, id,
+		"UPDATE expressions SET status = ?, result = ?, error = ? WHERE id = ?",
+		status, result, errMsg, id,
 	)
 	
 	if err != nil {
@@ -230,11 +480,13 @@ func (db *SQLiteDB) GetExpression(id string, userID int) (*models.Expression, er
 	expr := &models.Expression{}
 
 	var result sql.NullFloat64
+	var variables string
 	err := db.db.QueryRow(`
-		SELECT id, status, result, user_id, created_at 
+		SELECT id, status, result, user_id, created_at, expression, normalized, task_count, error, variables
 		FROM expressions 
 		WHERE id = ? AND user_id = ?`, id, userID).Scan(
 		&expr.ID, &expr.Status, &result, &expr.UserID, &expr.CreatedAt,
+		&expr.Expression, &expr.Normalized, &expr.TaskCount, &expr.Error, &variables,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -242,6 +494,39 @@ func (db *SQLiteDB) GetExpression(id string, userID int) (*models.Expression, er
 		}
 		return nil, err
 	}
+	if expr.Variables, err = decodeVariables(variables); err != nil {
+		return nil, err
+	}
+
+	if result.Valid {
+		expr.Result = result.Float64
+	}
+
+	return expr, nil
+}
+
+// GetExpressionByID возвращает выражение по ID без проверки владельца
+func (db *SQLiteDB) GetExpressionByID(id string) (*models.Expression, error) {
+	expr := &models.Expression{}
+
+	var result sql.NullFloat64
+	var variables string
+	err := db.db.QueryRow(`
+		SELECT id, status, result, user_id, created_at, expression, normalized, task_count, error, variables
+		FROM expressions
+		WHERE id = ?`, id).Scan(
+		&expr.ID, &expr.Status, &result, &expr.UserID, &expr.CreatedAt,
+		&expr.Expression, &expr.Normalized, &expr.TaskCount, &expr.Error, &variables,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if expr.Variables, err = decodeVariables(variables); err != nil {
+		return nil, err
+	}
 
 	if result.Valid {
 		expr.Result = result.Float64
@@ -253,7 +538,7 @@ func (db *SQLiteDB) GetExpression(id string, userID int) (*models.Expression, er
 // GetExpressions возвращает все выражения пользователя
 func (db *SQLiteDB) GetExpressions(userID int) ([]*models.Expression, error) {
 	rows, err := db.db.Query(`
-		SELECT id, status, result, user_id, created_at 
+		SELECT id, status, result, user_id, created_at, expression, normalized, task_count, error, variables
 		FROM expressions 
 		WHERE user_id = ? 
 		ORDER BY created_at DESC`, userID)
@@ -266,7 +551,12 @@ func (db *SQLiteDB) GetExpressions(userID int) ([]*models.Expression, error) {
 	for rows.Next() {
 		expr := &models.Expression{}
 		var result sql.NullFloat64
-		if err := rows.Scan(&expr.ID, &expr.Status, &result, &expr.UserID, &expr.CreatedAt); err != nil {
+		var variables string
+		if err := rows.Scan(&expr.ID, &expr.Status, &result, &expr.UserID, &expr.CreatedAt,
+			&expr.Expression, &expr.Normalized, &expr.TaskCount, &expr.Error, &variables); err != nil {
+			return nil, err
+		}
+		if expr.Variables, err = decodeVariables(variables); err != nil {
 			return nil, err
 		}
 
@@ -284,74 +574,38 @@ func (db *SQLiteDB) GetExpressions(userID int) ([]*models.Expression, error) {
 	return expressions, nil
 }
 
-// SaveResult сохраняет результат задачи и обновляет статус выражения, если все задачи завершены
+// SaveResult сохраняет результат задачи и отмечает задачу выполненной.
+// Статус выражения обновляет менеджер задач через UpdateExpressionStatus.
 func (db *SQLiteDB) SaveResult(taskID int, result float64, exprID string) error {
-	log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Задача #%d, результат %f, выражение %s - сохраняем результат", taskID, result, exprID)
-	
-	// Сохраняем результат задачи в таблицу task_results
-	_, err := db.db.Exec(
-		"INSERT OR REPLACE INTO task_results (task_id, result, expression_id) VALUES (?, ?, ?)",
-		taskID, result, exprID,
-	)
+	tx, err := db.db.Begin()
 	if err != nil {
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Ошибка при сохранении результата в таблицу task_results: %v", err)
 		return err
 	}
-	log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Результат задачи #%d сохранен в таблицу task_results", taskID)
-	
-	// Удаляем задачу из таблицы tasks, так как она уже выполнена
-	_, err = db.db.Exec("DELETE FROM tasks WHERE id = ?", taskID)
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO task_results (task_id, result, expression_id, created_at) VALUES (?, ?, ?, ?)",
+		taskID, result, exprID, time.Now().Unix(),
+	)
 	if err != nil {
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Ошибка при удалении задачи из таблицы tasks: %v", err)
-		// Не возвращаем ошибку, так как результат уже сохранен
-	} else {
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Задача #%d удалена из таблицы tasks", taskID)
+		return fmt.Errorf("не удалось сохранить результат задачи %d: %w", taskID, err)
 	}
-	
-	// Проверяем, остались ли задачи для этого выражения
-	var count int
-	err = db.db.QueryRow("SELECT COUNT(*) FROM tasks WHERE expression_id = ?", exprID).Scan(&count)
+
+	_, err = tx.Exec(
+		"UPDATE tasks SET state = ?, lease_id = '', started_at = 0 WHERE id = ?",
+		models.TaskStateDone, taskID,
+	)
 	if err != nil {
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Ошибка при проверке оставшихся задач: %v", err)
-		return err
+		return fmt.Errorf("не удалось обновить состояние задачи %d: %w", taskID, err)
 	}
-	
-	log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Для выражения %s осталось %d невыполненных задач", exprID, count)
-	
-	// Если задач больше нет, обновляем результат выражения
-	if count == 0 {
-		// Получаем последний результат для выражения
-		var finalResult float64
-		row := db.db.QueryRow(
-			"SELECT result FROM task_results WHERE expression_id = ? ORDER BY task_id DESC LIMIT 1",
-			exprID,
-		)
-		err = row.Scan(&finalResult)
-		if err != nil {
-			log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Ошибка при получении финального результата: %v", err)
-			// Используем текущий результат, если не можем получить последний
-			finalResult = result
-		}
-		
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Обновляем результат выражения %s на %f", exprID, finalResult)
-		
-		// Обновляем выражение в БД
-		if err := db.UpdateExpressionStatus(exprID, "completed", finalResult); err != nil {
-			log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Ошибка при обновлении выражения: %v", err)
-			return err
-		}
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Успешно обновлен результат выражения %s на %f", exprID, finalResult)
-	} else {
-		log.Printf("=== ОТЛАДКА SQLiteDB.SaveResult: Для выражения %s остались невыполненные задачи, не обновляем результат", exprID)
-	}
-	
-	return nil
+
+	return tx.Commit()
 }
 
 // GetResult возвращает результат задачи по ID
 func (db *SQLiteDB) GetResult(taskID int) (float64, error) {
 	var result float64
-	err := db.db.QueryRow("SELECT result FROM expressions WHERE id = ?", taskID).Scan(&result)
+	err := db.db.QueryRow("SELECT result FROM task_results WHERE task_id = ?", taskID).Scan(&result)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("результат для задачи %d не найден", taskID)
@@ -365,9 +619,8 @@ func (db *SQLiteDB) GetResult(taskID int) (float64, error) {
 func (db *SQLiteDB) GetResultsByExprID(exprID string) (map[int]float64, error) {
 	rows, err := db.db.Query(`
 		SELECT task_id, result 
-		FROM results 
-		WHERE expression_id = ?
-		ORDER BY created_at DESC`, exprID)
+		FROM task_results 
+		WHERE expression_id = ?`, exprID)
 	if err != nil {
 		return nil, err
 	}
@@ -383,7 +636,7 @@ func (db *SQLiteDB) GetResultsByExprID(exprID string) (map[int]float64, error) {
 		results[taskID] = result
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
 // GetLastResultByExprID возвращает последний результат для выражения
@@ -391,9 +644,9 @@ func (db *SQLiteDB) GetLastResultByExprID(exprID string) (*models.TaskResult, er
 	result := &models.TaskResult{}
 	err := db.db.QueryRow(`
 		SELECT task_id, result 
-		FROM results 
+		FROM task_results 
 		WHERE expression_id = ?
-		ORDER BY created_at DESC
+		ORDER BY task_id DESC
 		LIMIT 1`, exprID).Scan(&result.ID, &result.Result)
 	
 	if err != nil {
@@ -405,3 +658,581 @@ func (db *SQLiteDB) GetLastResultByExprID(exprID string) (*models.TaskResult, er
 
 	return result, nil
 }
+
+// SaveTasks сохраняет задачи выражения в состоянии pending
+func (db *SQLiteDB) SaveTasks(tasks []models.Task) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO tasks (id, expression_id, arg1, arg2, operation, operation_time, state, lease_id, started_at, args)
+		VALUES (?, ?, ?, ?, ?, ?, ?, '', 0, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, task := range tasks {
+		args, err := encodeStrings(task.Args)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(task.ID, task.ExpressionID, task.Arg1, task.Arg2,
+			task.Operation, task.OperationTime, models.TaskStatePending, args); err != nil {
+			return fmt.Errorf("не удалось сохранить задачу %d: %w", task.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// encodeStrings сериализует список строк (аргументы функции, операции агента, параметры формулы) в JSON-массив,
+// пустая строка - пустой список
+func encodeStrings(items []string) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeStrings восстанавливает список строк, сохраненный encodeStrings
+func decodeStrings(data string) ([]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var items []string
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, fmt.Errorf("некорректный список %q: %w", data, err)
+	}
+	return items, nil
+}
+
+// encodeVariables сериализует значения переменных выражения в JSON-объект, пустая строка - нет переменных
+func encodeVariables(variables map[string]float64) (string, error) {
+	if len(variables) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeVariables восстанавливает значения переменных, сохраненные encodeVariables
+func decodeVariables(data string) (map[string]float64, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var variables map[string]float64
+	if err := json.Unmarshal([]byte(data), &variables); err != nil {
+		return nil, fmt.Errorf("некорректные переменные выражения %q: %w", data, err)
+	}
+	return variables, nil
+}
+
+// UpdateTaskLease сохраняет аренду задачи. Пустой leaseID возвращает задачу в состояние pending
+func (db *SQLiteDB) UpdateTaskLease(taskID int, leaseID string, startedAt int64) error {
+	state := models.TaskStateProcessing
+	if leaseID == "" {
+		state = models.TaskStatePending
+		startedAt = 0
+	}
+
+	_, err := db.db.Exec(
+		"UPDATE tasks SET state = ?, lease_id = ?, started_at = ? WHERE id = ? AND state IN (?, ?)",
+		state, leaseID, startedAt, taskID, models.TaskStatePending, models.TaskStateProcessing,
+	)
+	return err
+}
+
+// CancelTasks отменяет невыполненные задачи выражения
+func (db *SQLiteDB) CancelTasks(exprID string) error {
+	_, err := db.db.Exec(
+		"UPDATE tasks SET state = ?, lease_id = '', started_at = 0 WHERE expression_id = ? AND state IN (?, ?)",
+		models.TaskStateCancelled, exprID, models.TaskStatePending, models.TaskStateProcessing,
+	)
+	return err
+}
+
+// GetUnfinishedTasks возвращает задачи в состояниях pending и processing
+func (db *SQLiteDB) GetUnfinishedTasks() ([]models.StoredTask, error) {
+	rows, err := db.db.Query(`
+		SELECT id, expression_id, arg1, arg2, operation, operation_time, state, lease_id, started_at, args
+		FROM tasks
+		WHERE state IN (?, ?)
+		ORDER BY id`, models.TaskStatePending, models.TaskStateProcessing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.StoredTask{}
+	for rows.Next() {
+		var task models.StoredTask
+		var args string
+		if err := rows.Scan(&task.ID, &task.ExpressionID, &task.Arg1, &task.Arg2, &task.Operation,
+			&task.OperationTime, &task.State, &task.LeaseID, &task.StartedAt, &args); err != nil {
+			return nil, err
+		}
+		if task.Args, err = decodeStrings(args); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetTasksByExprID возвращает граф задач выражения со ссылками на результаты в аргументах
+func (db *SQLiteDB) GetTasksByExprID(exprID string) ([]models.StoredTask, error) {
+	rows, err := db.db.Query(`
+		SELECT id, expression_id, arg1, arg2, operation, operation_time, state, lease_id, started_at, args
+		FROM tasks
+		WHERE expression_id = ?
+		ORDER BY id`, exprID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.StoredTask{}
+	for rows.Next() {
+		var task models.StoredTask
+		var args string
+		if err := rows.Scan(&task.ID, &task.ExpressionID, &task.Arg1, &task.Arg2, &task.Operation,
+			&task.OperationTime, &task.State, &task.LeaseID, &task.StartedAt, &args); err != nil {
+			return nil, err
+		}
+		if task.Args, err = decodeStrings(args); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetPendingExpressions возвращает выражения всех пользователей, которые еще вычисляются
+func (db *SQLiteDB) GetPendingExpressions() ([]*models.Expression, error) {
+	rows, err := db.db.Query(`
+		SELECT id, status, user_id, created_at, expression, normalized, task_count, variables
+		FROM expressions
+		WHERE status = 'pending'
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expressions := []*models.Expression{}
+	for rows.Next() {
+		expr := &models.Expression{}
+		var variables string
+		if err := rows.Scan(&expr.ID, &expr.Status, &expr.UserID, &expr.CreatedAt,
+			&expr.Expression, &expr.Normalized, &expr.TaskCount, &variables); err != nil {
+			return nil, err
+		}
+		if expr.Variables, err = decodeVariables(variables); err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expr)
+	}
+
+	return expressions, rows.Err()
+}
+
+// GetMaxTaskID возвращает наибольший ID сохраненной задачи, чтобы продолжить нумерацию
+func (db *SQLiteDB) GetMaxTaskID() (int, error) {
+	var maxID int
+	err := db.db.QueryRow(`
+		SELECT MAX(
+			COALESCE((SELECT MAX(id) FROM tasks), 0),
+			COALESCE((SELECT MAX(task_id) FROM task_results), 0)
+		)`).Scan(&maxID)
+	return maxID, err
+}
+
+// Ping выполняет запрос к БД, чтобы убедиться, что файл доступен и не заблокирован
+func (db *SQLiteDB) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var count int
+	if err := db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&count); err != nil {
+		return fmt.Errorf("база данных не отвечает: %w", err)
+	}
+	return nil
+}
+
+// SaveAgent сохраняет или обновляет запись агента
+func (db *SQLiteDB) SaveAgent(agent *models.Agent) error {
+	ops, err := encodeStrings(agent.Operations)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec(`
+		INSERT OR REPLACE INTO agents (id, hostname, version, capacity, in_flight, status, registered_at, last_seen, operations)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		agent.ID, agent.Hostname, agent.Version, agent.Capacity, agent.InFlight,
+		agent.Status, agent.RegisteredAt, agent.LastSeen, ops,
+	)
+	return err
+}
+
+// GetAgents возвращает всех зарегистрированных агентов
+func (db *SQLiteDB) GetAgents() ([]*models.Agent, error) {
+	rows, err := db.db.Query(`
+		SELECT id, hostname, version, capacity, in_flight, status, registered_at, last_seen, operations
+		FROM agents
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := []*models.Agent{}
+	for rows.Next() {
+		agent := &models.Agent{}
+		var ops string
+		if err := rows.Scan(&agent.ID, &agent.Hostname, &agent.Version, &agent.Capacity, &agent.InFlight,
+			&agent.Status, &agent.RegisteredAt, &agent.LastSeen, &ops); err != nil {
+			return nil, err
+		}
+		if agent.Operations, err = decodeStrings(ops); err != nil {
+			return nil, err
+		}
+		agents = append(agents, agent)
+	}
+
+	return agents, rows.Err()
+}
+
+// CreateSession сохраняет новую сессию и ее первый refresh токен
+func (db *SQLiteDB) CreateSession(session *models.Session, token *models.RefreshToken) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO sessions (id, user_id, created_at, expires_at, revoked_at) VALUES (?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.CreatedAt, session.ExpiresAt, session.RevokedAt); err != nil {
+		return fmt.Errorf("не удалось сохранить сессию: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO refresh_tokens (token_hash, session_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		token.Hash, token.SessionID, token.CreatedAt, token.ExpiresAt); err != nil {
+		return fmt.Errorf("не удалось сохранить refresh токен: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetSession возвращает сессию по ID
+func (db *SQLiteDB) GetSession(id string) (*models.Session, error) {
+	session := &models.Session{}
+	err := db.db.QueryRow(`SELECT id, user_id, created_at, expires_at, revoked_at FROM sessions WHERE id = ?`, id).Scan(
+		&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetRefreshToken возвращает refresh токен по хешу
+func (db *SQLiteDB) GetRefreshToken(hash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := db.db.QueryRow(`SELECT token_hash, session_id, created_at, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?`, hash).Scan(
+		&token.Hash, &token.SessionID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken обменивает refresh токен на следующий в одной транзакции.
+// Токен помечается использованным, только если он еще не использован, поэтому
+// из двух одновременных обменов одного токена успешен только один.
+func (db *SQLiteDB) RotateRefreshToken(usedHash string, usedAt int64, next *models.RefreshToken) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at = 0`, usedAt, usedHash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRefreshTokenUsed
+	}
+
+	if _, err := tx.Exec(`INSERT INTO refresh_tokens (token_hash, session_id, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		next.Hash, next.SessionID, next.CreatedAt, next.ExpiresAt); err != nil {
+		return fmt.Errorf("не удалось сохранить refresh токен: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET expires_at = ? WHERE id = ?`, next.ExpiresAt, next.SessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeSession завершает сессию. Повторное завершение не меняет момент выхода
+func (db *SQLiteDB) RevokeSession(id string, revokedAt int64) error {
+	res, err := db.db.Exec(`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at = 0`, revokedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := db.GetSession(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiKeyColumns столбцы таблицы api_keys в порядке scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, created_at, expires_at, last_used_at, revoked_at`
+
+// scanAPIKey читает ключ API из строки результата запроса
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	return key, err
+}
+
+// CreateAPIKey сохраняет ключ API и возвращает его ID
+func (db *SQLiteDB) CreateAPIKey(key *models.APIKey) (int, error) {
+	res, err := db.db.Exec(`INSERT INTO api_keys (user_id, name, prefix, key_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.Name, key.Prefix, key.Hash, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить ключ API: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetAPIKeys возвращает ключи API пользователя в порядке создания
+func (db *SQLiteDB) GetAPIKeys(userID int) ([]*models.APIKey, error) {
+	rows, err := db.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash возвращает ключ API по хешу
+func (db *SQLiteDB) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	key, err := scanAPIKey(db.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, hash))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchAPIKey запоминает момент последнего использования ключа API
+func (db *SQLiteDB) TouchAPIKey(id int, usedAt int64) error {
+	res, err := db.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAPIKey отзывает ключ API пользователя. Повторный отзыв не меняет момент отзыва
+func (db *SQLiteDB) RevokeAPIKey(id, userID int, revokedAt int64) error {
+	var current int64
+	err := db.db.QueryRow(`SELECT revoked_at FROM api_keys WHERE id = ? AND user_id = ?`, id, userID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current != 0 {
+		return nil
+	}
+	_, err = db.db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ?`, revokedAt, id)
+	return err
+}
+
+// formulaColumns столбцы таблицы formulas в порядке scanFormula
+const formulaColumns = `id, user_id, name, expression, parameters, created_at, updated_at, last_expression_id`
+
+// scanFormula читает формулу из строки результата запроса
+func scanFormula(row interface{ Scan(...interface{}) error }) (*models.Formula, error) {
+	formula := &models.Formula{}
+	var parameters string
+	err := row.Scan(&formula.ID, &formula.UserID, &formula.Name, &formula.Expression, &parameters,
+		&formula.CreatedAt, &formula.UpdatedAt, &formula.LastExpressionID)
+	if err != nil {
+		return nil, err
+	}
+	if formula.Parameters, err = decodeStrings(parameters); err != nil {
+		return nil, err
+	}
+	if formula.Parameters == nil {
+		formula.Parameters = []string{}
+	}
+	return formula, nil
+}
+
+// CreateFormula сохраняет формулу и возвращает ее ID
+func (db *SQLiteDB) CreateFormula(formula *models.Formula) (int, error) {
+	parameters, err := encodeStrings(formula.Parameters)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.db.Exec(`INSERT INTO formulas (user_id, name, expression, parameters, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (user_id, name) DO NOTHING`,
+		formula.UserID, formula.Name, formula.Expression, parameters, formula.CreatedAt, formula.UpdatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить формулу: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrAlreadyExists
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetFormulas возвращает формулы пользователя в алфавитном порядке имен
+func (db *SQLiteDB) GetFormulas(userID int) ([]*models.Formula, error) {
+	rows, err := db.db.Query(`SELECT `+formulaColumns+` FROM formulas WHERE user_id = ? ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	formulas := make([]*models.Formula, 0)
+	for rows.Next() {
+		formula, err := scanFormula(rows)
+		if err != nil {
+			return nil, err
+		}
+		formulas = append(formulas, formula)
+	}
+	return formulas, rows.Err()
+}
+
+// GetFormula возвращает формулу пользователя по имени
+func (db *SQLiteDB) GetFormula(userID int, name string) (*models.Formula, error) {
+	formula, err := scanFormula(db.db.QueryRow(`SELECT `+formulaColumns+` FROM formulas WHERE user_id = ? AND name = ?`, userID, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return formula, nil
+}
+
+// UpdateFormula меняет выражение, параметры и момент изменения формулы
+func (db *SQLiteDB) UpdateFormula(formula *models.Formula) error {
+	parameters, err := encodeStrings(formula.Parameters)
+	if err != nil {
+		return err
+	}
+	res, err := db.db.Exec(`UPDATE formulas SET expression = ?, parameters = ?, updated_at = ? WHERE user_id = ? AND name = ?`,
+		formula.Expression, parameters, formula.UpdatedAt, formula.UserID, formula.Name)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить формулу: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteFormula удаляет формулу пользователя
+func (db *SQLiteDB) DeleteFormula(userID int, name string) error {
+	res, err := db.db.Exec(`DELETE FROM formulas WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetFormulaLastExpression запоминает выражение последнего вычисления формулы
+func (db *SQLiteDB) SetFormulaLastExpression(id int, exprID string) error {
+	res, err := db.db.Exec(`UPDATE formulas SET last_expression_id = ? WHERE id = ?`, exprID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveAuditEntry добавляет запись в журнал событий безопасности
+func (db *SQLiteDB) SaveAuditEntry(entry *models.AuditEntry) error {
+	_, err := db.db.Exec(`INSERT INTO audit_log (time, event, login, ip, detail) VALUES (?, ?, ?, ?, ?)`,
+		entry.Time, entry.Event, entry.Login, entry.IP, entry.Detail)
+	if err != nil {
+		return fmt.Errorf("не удалось сохранить запись журнала: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries возвращает последние записи журнала, новые первыми
+func (db *SQLiteDB) GetAuditEntries(limit int) ([]*models.AuditEntry, error) {
+	rows, err := db.db.Query(`SELECT id, time, event, login, ip, detail FROM audit_log ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*models.AuditEntry, 0)
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.Event, &entry.Login, &entry.IP, &entry.Detail); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
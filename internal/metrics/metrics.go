@@ -0,0 +1,312 @@
+// Package metrics содержит счетчики, gauge и гистограммы, которые отдаются
+// по HTTP в текстовом формате Prometheus (version 0.0.4)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DurationBuckets границы гистограмм длительности в секундах: от миллисекунд
+// для быстрых операций до минуты для задач с большим TIME_*_MS
+var DurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector метрика, которая умеет записать себя в текстовом формате
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry набор метрик, отдаваемых одним эндпоинтом /metrics
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default реестр, в который регистрируются метрики оркестратора и агента
+var Default = NewRegistry()
+
+// NewRegistry создает пустой реестр метрик
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write записывает все метрики реестра в текстовом формате Prometheus
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	buf.Flush()
+}
+
+// Handler возвращает HTTP обработчик для сбора метрик Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler возвращает HTTP обработчик реестра Default
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// desc имя, описание и имена меток метрики
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// labelKey склеивает значения меток в ключ карты значений метрики
+func (d desc) labelKey(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: метрика %s ожидает %d меток, передано %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels формирует {name="value",...} по ключу значений и дополнительной метке
+func (d desc) formatLabels(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys возвращает ключи карты значений в стабильном порядке
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec монотонно растущий счетчик с метками
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec создает счетчик и регистрирует его в реестре
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name: name, help: help, kind: "counter", labels: labels}, values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+// NewCounterVec создает счетчик в реестре Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// Add увеличивает счетчик с указанными значениями меток на v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.labelKey(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc увеличивает счетчик с указанными значениями меток на единицу
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value возвращает текущее значение счетчика
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(key), formatValue(c.values[key]))
+	}
+}
+
+// GaugeFunc gauge, значения которого вычисляются в момент сбора метрик.
+// Функция возвращает значения по значению единственной метки
+// или по пустой строке, если метка не задана.
+type GaugeFunc struct {
+	desc
+	fn func() map[string]float64
+}
+
+// NewGaugeFunc создает gauge без меток и регистрирует его в реестре
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		desc: desc{name: name, help: help, kind: "gauge"},
+		fn:   func() map[string]float64 { return map[string]float64{"": fn()} },
+	}
+	r.register(g)
+	return g
+}
+
+// NewGaugeFunc создает gauge без меток в реестре Default
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewGaugeVecFunc создает gauge с одной меткой label и регистрирует его в реестре
+func (r *Registry) NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge", labels: []string{label}}, fn: fn}
+	r.register(g)
+	return g
+}
+
+// NewGaugeVecFunc создает gauge с одной меткой в реестре Default
+func NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	return Default.NewGaugeVecFunc(name, help, label, fn)
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := g.fn()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.formatLabels(key), formatValue(values[key]))
+	}
+}
+
+// histogram накопленные наблюдения одной комбинации меток
+type histogram struct {
+	counts []uint64 // Количество наблюдений по корзинам, не накопительно
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec гистограмма с метками
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+// NewHistogramVec создает гистограмму с границами корзин buckets и регистрирует ее в реестре
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: sorted,
+		values:  make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// NewHistogramVec создает гистограмму в реестре Default
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe добавляет наблюдение v для указанных значений меток
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.labelKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, exists := h.values[key]
+	if !exists {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+// Count возвращает количество наблюдений для указанных значений меток
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, exists := h.values[key]; exists {
+		return hist.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(key, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(key), formatValue(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(key), hist.count)
+	}
+}
@@ -0,0 +1,378 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// Ошибки административных операций
+var (
+	// ErrExpressionNotFound выражение неизвестно менеджеру задач
+	ErrExpressionNotFound = errors.New("выражение не найдено")
+	// ErrExpressionFinished выражение уже вычислено или завершилось ошибкой
+	ErrExpressionFinished = errors.New("выражение уже завершено")
+	// ErrTaskNotProcessing задача не выдана агенту, возвращать в очередь нечего
+	ErrTaskNotProcessing = errors.New("задача не находится в обработке")
+)
+
+// Состояние задачи в графе выражения, которое видит администратор
+const (
+	AdminTaskWaiting    = "waiting"    // Ждет результатов других задач
+	AdminTaskReady      = "ready"      // В очереди готовых задач
+	AdminTaskProcessing = "processing" // Выдана агенту по аренде
+	AdminTaskDone       = "done"       // Результат получен
+	AdminTaskCancelled  = "cancelled"  // Отменена вместе с выражением
+)
+
+// AdminTask задача вместе с текущим состоянием в планировщике
+type AdminTask struct {
+	models.Task
+	State     string   `json:"state"`
+	AgentID   int32    `json:"agent_id,omitempty"`   // Агент, которому выдана задача
+	StartedAt int64    `json:"started_at,omitempty"` // Начало аренды в миллисекундах Unix
+	Deadline  int64    `json:"deadline,omitempty"`   // Срок аренды в миллисекундах Unix
+	Result    *float64 `json:"result,omitempty"`
+}
+
+// ExpressionGraph выражение вместе с графом его задач и результатами
+type ExpressionGraph struct {
+	Expression models.Expression `json:"expression"`
+	Tasks      []AdminTask       `json:"tasks"`
+}
+
+// processingTask описывает задачу, выданную агенту.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) processingTask(task models.Task) AdminTask {
+	node := AdminTask{Task: task, State: AdminTaskProcessing, AgentID: tm.TaskAgents[task.ID]}
+	node.LeaseID = tm.TaskLeases[task.ID]
+	if start, ok := tm.TaskProcessingStartTime[task.ID]; ok {
+		node.StartedAt = start.UnixMilli()
+		node.Deadline = LeaseDeadline(start, task.OperationTime).UnixMilli()
+	}
+	return node
+}
+
+// QueueSnapshot возвращает копию очереди готовых задач и задач в обработке
+// с агентами и временем начала аренды
+func (tm *TaskManager) QueueSnapshot() (ready []models.Task, processing []AdminTask) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	ready = append([]models.Task{}, tm.ReadyTasks...)
+	processing = []AdminTask{}
+	for taskID := range tm.ProcessingTasks {
+		task, exists := tm.Tasks[taskID]
+		if !exists {
+			continue
+		}
+		processing = append(processing, tm.processingTask(*task))
+	}
+	sort.Slice(processing, func(i, j int) bool { return processing[i].StartedAt < processing[j].StartedAt })
+	return ready, processing
+}
+
+// ExpressionGraph возвращает граф задач выражения. stored - задачи выражения из БД
+// в исходном виде со ссылками на результаты; если он пуст, граф строится по задачам в памяти.
+func (tm *TaskManager) ExpressionGraph(exprID string, stored []models.StoredTask) (*ExpressionGraph, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	expr, exists := tm.Expressions[exprID]
+	if !exists {
+		return nil, false
+	}
+
+	if len(stored) == 0 {
+		for taskID, id := range tm.TaskToExpr {
+			if id != exprID {
+				continue
+			}
+			task := models.StoredTask{Task: models.Task{ID: taskID, ExpressionID: exprID}, State: models.TaskStateCancelled}
+			if current, ok := tm.Tasks[taskID]; ok {
+				task.Task = *current
+				task.State = models.TaskStatePending
+			} else if _, ok := tm.Results[taskID]; ok {
+				task.State = models.TaskStateDone
+			}
+			stored = append(stored, task)
+		}
+		sort.Slice(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+	}
+
+	ready := make(map[int]bool, len(tm.ReadyTasks))
+	for _, task := range tm.ReadyTasks {
+		ready[task.ID] = true
+	}
+
+	graph := &ExpressionGraph{Expression: *expr, Tasks: make([]AdminTask, 0, len(stored))}
+	for _, task := range stored {
+		task.LeaseID = ""
+		node := AdminTask{Task: task.Task, State: AdminTaskCancelled}
+
+		_, pending := tm.Tasks[task.ID]
+		switch {
+		case tm.ProcessingTasks[task.ID]:
+			node = tm.processingTask(task.Task)
+		case ready[task.ID]:
+			node.State = AdminTaskReady
+		case pending:
+			node.State = AdminTaskWaiting
+		case task.State == models.TaskStateDone:
+			node.State = AdminTaskDone
+		}
+
+		if result, ok := tm.Results[task.ID]; ok {
+			node.State = AdminTaskDone
+			node.Result = &result
+		}
+		graph.Tasks = append(graph.Tasks, node)
+	}
+	return graph, true
+}
+
+// CancelExpression отменяет вычисляемое выражение: оно переводится в статус error
+// с причиной reason, а его задачи удаляются из очереди. Результаты уже выданных
+// задач будут отклонены как результаты неизвестных задач.
+func (tm *TaskManager) CancelExpression(exprID string, reason string) error {
+	tm.mu.Lock()
+	expr, exists := tm.Expressions[exprID]
+	if !exists {
+		tm.mu.Unlock()
+		return ErrExpressionNotFound
+	}
+	if expr.Status != "pending" {
+		tm.mu.Unlock()
+		return ErrExpressionFinished
+	}
+
+	snapshot := *tm.failExpression(exprID, reason)
+	tm.mu.Unlock()
+
+	log.Printf("CancelExpression: Выражение %s отменено: %s", exprID, reason)
+	if DB != nil {
+		if err := DB.UpdateExpressionStatus(snapshot.ID, snapshot.Status, snapshot.Result, snapshot.Error); err != nil {
+			log.Printf("CancelExpression: Ошибка при обновлении статуса выражения %s в БД: %v", exprID, err)
+		}
+	}
+	return nil
+}
+
+// RequeueTask снимает аренду с зависшей задачи и возвращает ее в очередь готовых задач.
+// Результат по снятой аренде будет отклонен с ErrStaleLease.
+func (tm *TaskManager) RequeueTask(taskID int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, exists := tm.Tasks[taskID]; !exists {
+		return ErrTaskNotFound
+	}
+	if !tm.ProcessingTasks[taskID] {
+		return ErrTaskNotProcessing
+	}
+
+	log.Printf("RequeueTask: Аренда %s задачи #%d (агент #%d) снята администратором, задача возвращена в очередь",
+		tm.TaskLeases[taskID], taskID, tm.TaskAgents[taskID])
+	tm.releaseTask(taskID)
+	persist("RequeueTask", func(db database.Database) error {
+		return db.UpdateTaskLease(taskID, "", 0)
+	})
+	tm.updateReadyTasksList()
+	return nil
+}
+
+// AdminHandlers содержит обработчики административного API для диагностики планировщика
+type AdminHandlers struct {
+	DB database.Database
+}
+
+// NewAdminHandlers создает обработчики административного API
+func NewAdminHandlers(db database.Database) *AdminHandlers {
+	return &AdminHandlers{DB: db}
+}
+
+// adminLogin возвращает логин администратора, выполняющего запрос, для журнала
+func adminLogin(r *http.Request) string {
+	if user, ok := auth.GetUserFromContext(r.Context()); ok {
+		return user.Login
+	}
+	return "неизвестен"
+}
+
+// writeJSON отправляет ответ в формате JSON с указанным кодом
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// AdminOnly пропускает к административному API только аутентифицированных пользователей с ролью admin
+func (h *AdminHandlers) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return auth.AuthMiddleware(h.DB, auth.RequireRole(models.RoleAdmin, next))
+}
+
+// Handler разбирает путь /api/v1/admin/... и вызывает нужный обработчик
+func (h *AdminHandlers) Handler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin"), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "queue" && r.Method == http.MethodGet:
+		h.QueueHandler(w, r)
+	case len(parts) == 1 && parts[0] == "agents" && r.Method == http.MethodGet:
+		h.AgentsHandler(w, r)
+	case len(parts) == 1 && parts[0] == "audit" && r.Method == http.MethodGet:
+		h.AuditHandler(w, r)
+	case len(parts) == 2 && parts[0] == "expressions" && r.Method == http.MethodGet:
+		h.ExpressionHandler(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "expressions" && parts[2] == "cancel" && r.Method == http.MethodPost:
+		h.CancelExpressionHandler(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "requeue" && r.Method == http.MethodPost:
+		h.RequeueTaskHandler(w, r, parts[1])
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+// QueueHandler возвращает готовые задачи и задачи в обработке со временем начала аренды
+func (h *AdminHandlers) QueueHandler(w http.ResponseWriter, r *http.Request) {
+	ready, processing := Manager.QueueSnapshot()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ready":      ready,
+		"processing": processing,
+	})
+}
+
+// AgentsHandler возвращает зарегистрированных агентов
+func (h *AdminHandlers) AgentsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]models.Agent{"agents": Agents.List()})
+}
+
+// AuditHandler возвращает последние записи журнала безопасности (?limit=N, по умолчанию 100)
+func (h *AdminHandlers) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 1000 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.DB.GetAuditEntries(limit)
+	if err != nil {
+		log.Printf("AuditHandler: Ошибка чтения журнала: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]*models.AuditEntry{"entries": entries})
+}
+
+// ExpressionHandler возвращает выражение любого пользователя с графом задач и результатами.
+// Выражения, которых нет в менеджере задач, ищутся в БД
+func (h *AdminHandlers) ExpressionHandler(w http.ResponseWriter, r *http.Request, exprID string) {
+	var stored []models.StoredTask
+	if h.DB != nil {
+		tasks, err := h.DB.GetTasksByExprID(exprID)
+		if err != nil {
+			log.Printf("ExpressionHandler: Ошибка получения задач выражения %s из БД: %v", exprID, err)
+		}
+		stored = tasks
+	}
+
+	graph, exists := Manager.ExpressionGraph(exprID, stored)
+	if !exists && h.DB != nil {
+		var err error
+		graph, err = h.storedExpressionGraph(exprID, stored)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			log.Printf("ExpressionHandler: Ошибка получения выражения %s из БД: %v", exprID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+			return
+		}
+		exists = err == nil
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Expression not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
+
+// storedExpressionGraph строит граф выражения, которого нет в менеджере задач, по состояниям
+// задач и результатам из БД. После перезапуска менеджер восстанавливает только вычисляемые
+// выражения, поэтому граф завершенных выражений берется из хранилища
+func (h *AdminHandlers) storedExpressionGraph(exprID string, stored []models.StoredTask) (*ExpressionGraph, error) {
+	expr, err := h.DB.GetExpressionByID(exprID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := h.DB.GetResultsByExprID(exprID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &ExpressionGraph{Expression: *expr, Tasks: make([]AdminTask, 0, len(stored))}
+	for _, task := range stored {
+		task.LeaseID = ""
+		node := AdminTask{Task: task.Task, State: AdminTaskCancelled}
+		switch task.State {
+		case models.TaskStatePending:
+			node.State = AdminTaskWaiting
+		case models.TaskStateProcessing:
+			node.State = AdminTaskProcessing
+			node.StartedAt = task.StartedAt
+		case models.TaskStateDone:
+			node.State = AdminTaskDone
+		}
+
+		if result, ok := results[task.ID]; ok {
+			node.State = AdminTaskDone
+			node.Result = &result
+		}
+		graph.Tasks = append(graph.Tasks, node)
+	}
+	return graph, nil
+}
+
+// CancelExpressionHandler отменяет вычисляемое выражение
+func (h *AdminHandlers) CancelExpressionHandler(w http.ResponseWriter, r *http.Request, exprID string) {
+	err := Manager.CancelExpression(exprID, "выражение отменено администратором")
+	switch {
+	case errors.Is(err, ErrExpressionNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrExpressionFinished):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("CancelExpressionHandler: Администратор %s отменил выражение %s", adminLogin(r), exprID)
+		expr, _ := Manager.GetExpression(exprID)
+		writeJSON(w, http.StatusOK, map[string]models.Expression{"expression": *expr})
+	}
+}
+
+// RequeueTaskHandler возвращает зависшую задачу в очередь
+func (h *AdminHandlers) RequeueTaskHandler(w http.ResponseWriter, r *http.Request, rawID string) {
+	taskID, err := strconv.Atoi(rawID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid task ID"})
+		return
+	}
+
+	err = Manager.RequeueTask(taskID)
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrTaskNotProcessing):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		log.Printf("RequeueTaskHandler: Администратор %s вернул задачу #%d в очередь", adminLogin(r), taskID)
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Task requeued"})
+	}
+}
@@ -0,0 +1,222 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/GGmuzem/yandex-project/pkg/operations"
+)
+
+// AgentRegistry реестр агентов: назначает ID при регистрации, отслеживает heartbeat
+// и сохраняет состояние агентов в БД
+type AgentRegistry struct {
+	mu     sync.Mutex
+	agents map[int32]*models.Agent
+	nextID int32
+}
+
+// Agents глобальный реестр агентов
+var Agents = NewAgentRegistry()
+
+// NewAgentRegistry создает пустой реестр агентов
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{agents: make(map[int32]*models.Agent)}
+}
+
+// heartbeatTimeout время без heartbeat, после которого агент считается отключенным
+func heartbeatTimeout() time.Duration {
+	return time.Duration(Config.Scheduler.HeartbeatTimeoutMs) * time.Millisecond
+}
+
+// HeartbeatInterval интервал heartbeat, который оркестратор сообщает агентам
+func HeartbeatInterval() time.Duration {
+	return heartbeatTimeout() / 3
+}
+
+// saveAgent сохраняет агента в БД, если она подключена.
+// Вызывается с захваченным мьютексом реестра.
+func saveAgent(agent *models.Agent) {
+	if DB == nil {
+		return
+	}
+	if err := DB.SaveAgent(agent); err != nil {
+		log.Printf("Ошибка при сохранении агента #%d в БД: %v", agent.ID, err)
+	}
+}
+
+// Load загружает агентов, известных до перезапуска. Все они считаются отключенными,
+// пока не пришлют heartbeat или не зарегистрируются заново.
+func (r *AgentRegistry) Load(db database.Database) error {
+	agents, err := db.GetAgents()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, agent := range agents {
+		agent.Status = models.AgentStatusOffline
+		agent.InFlight = 0
+		r.agents[agent.ID] = agent
+		if agent.ID > r.nextID {
+			r.nextID = agent.ID
+		}
+	}
+	log.Printf("Загружено агентов из БД: %d", len(agents))
+	return nil
+}
+
+// Register регистрирует агента. Агент, уже получавший ID, передает его повторно
+// и сохраняет его, иначе назначается новый ID. ops - операции, которые умеет выполнять агент.
+func (r *AgentRegistry) Register(agentID int32, hostname, version string, capacity int, ops []string) models.Agent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	agent, exists := r.agents[agentID]
+	if agentID <= 0 || !exists {
+		if agentID <= 0 {
+			r.nextID++
+			agentID = r.nextID
+		} else if agentID > r.nextID {
+			r.nextID = agentID
+		}
+		agent = &models.Agent{ID: agentID, RegisteredAt: now}
+		r.agents[agentID] = agent
+	}
+
+	agent.Hostname = hostname
+	agent.Version = version
+	agent.Capacity = capacity
+	agent.Operations = append([]string(nil), ops...)
+	agent.Status = models.AgentStatusOnline
+	agent.LastSeen = now
+	saveAgent(agent)
+
+	log.Printf("Агент #%d зарегистрирован: хост %s, версия %s, емкость %d, операции %v",
+		agentID, hostname, version, capacity, supportedOperations(agent))
+	return *agent
+}
+
+// supportedOperations операции агента. Агенты, не сообщившие список, выполняют только + - * /
+func supportedOperations(agent *models.Agent) []string {
+	if len(agent.Operations) == 0 {
+		return operations.Basic
+	}
+	return agent.Operations
+}
+
+// Capabilities возвращает множество операций, которые можно выдавать агенту.
+// Для неизвестного агента (и HTTP воркеров без ID) возвращает nil - ограничений нет.
+func (r *AgentRegistry) Capabilities(agentID int32) map[string]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, exists := r.agents[agentID]
+	if !exists {
+		return nil
+	}
+	ops := supportedOperations(agent)
+	supported := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		supported[op] = true
+	}
+	return supported
+}
+
+// Heartbeat отмечает, что агент жив. Возвращает false, если агент неизвестен
+// и должен зарегистрироваться заново.
+func (r *AgentRegistry) Heartbeat(agentID int32, inFlight int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, exists := r.agents[agentID]
+	if !exists {
+		return false
+	}
+
+	if agent.Status != models.AgentStatusOnline {
+		log.Printf("Агент #%d снова на связи", agentID)
+	}
+	agent.Status = models.AgentStatusOnline
+	agent.LastSeen = time.Now().UnixMilli()
+	agent.InFlight = inFlight
+	saveAgent(agent)
+	return true
+}
+
+// Touch отмечает активность агента при получении задачи или результата
+func (r *AgentRegistry) Touch(agentID int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if agent, exists := r.agents[agentID]; exists && agent.Status == models.AgentStatusOnline {
+		agent.LastSeen = time.Now().UnixMilli()
+	}
+}
+
+// List возвращает агентов, отсортированных по ID, с количеством выданных им задач
+func (r *AgentRegistry) List() []models.Agent {
+	inFlight := Manager.InFlightByAgent()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agents := make([]models.Agent, 0, len(r.agents))
+	for _, agent := range r.agents {
+		agentCopy := *agent
+		agentCopy.InFlight = inFlight[agent.ID]
+		agents = append(agents, agentCopy)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return agents
+}
+
+// ReleaseSilentAgents переводит в offline агентов, не присылавших heartbeat дольше
+// AGENT_HEARTBEAT_TIMEOUT_MS к моменту now, и возвращает в очередь выданные им задачи.
+// Возвращает количество отключенных агентов.
+func (r *AgentRegistry) ReleaseSilentAgents(now time.Time) int {
+	deadline := now.Add(-heartbeatTimeout()).UnixMilli()
+
+	r.mu.Lock()
+	var silent []int32
+	for _, agent := range r.agents {
+		if agent.Status == models.AgentStatusOnline && agent.LastSeen < deadline {
+			agent.Status = models.AgentStatusOffline
+			agent.InFlight = 0
+			saveAgent(agent)
+			silent = append(silent, agent.ID)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, agentID := range silent {
+		released := Manager.ReleaseAgentLeases(agentID)
+		log.Printf("Агент #%d не присылал heartbeat дольше %v, возвращено задач в очередь: %d",
+			agentID, heartbeatTimeout(), released)
+	}
+	return len(silent)
+}
+
+// StartAgentReaper периодически отключает агентов без heartbeat. Работает до отмены ctx.
+func (r *AgentRegistry) StartAgentReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Запущена проверка heartbeat агентов с интервалом %v", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Проверка heartbeat агентов остановлена")
+			return
+		case now := <-ticker.C:
+			r.ReleaseSilentAgents(now)
+		}
+	}
+}
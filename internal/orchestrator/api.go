@@ -2,13 +2,15 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/GGmuzem/yandex-project/internal/config"
 	"github.com/GGmuzem/yandex-project/internal/database"
 )
 
@@ -25,42 +27,118 @@ const (
 // DB is the database instance for persisting results and expression statuses
 var DB database.Database
 
+// Config настройки оркестратора, загружаются при запуске из файла, окружения и флагов
+var Config = config.Default()
+
 func CalculateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var input struct {
-		Expression string `json:"expression"`
+	// Во время остановки оркестратора новые выражения не принимаются
+	if Manager.Draining() {
+		writeShuttingDown(w)
+		return
 	}
+
+	var input models.CalculateRequest
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid request data", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Получено выражение для вычисления: %s", input.Expression)
-
-	// Генерируем уникальный ID для выражения
-	exprID := GenerateUniqueExpressionID()
+	log.Printf("Получено выражение для вычисления: %s, переменные: %v", input.Expression, input.Variables)
 
 	// Парсим выражение и создаем задачи
-	tasks := ParseExpression(input.Expression)
+	expr, tasks, err := NewExpressionWithVariables(input.Expression, input.Variables)
+	if err != nil {
+		writeParseError(w, err)
+		return
+	}
+	exprID := expr.ID
 	log.Printf("Создано %d задач для выражения %s", len(tasks), exprID)
 
-	// Добавляем задачи в глобальный менеджер
-	log.Printf("Добавление задач в глобальный менеджер")
-	Manager.AddExpression(exprID, tasks)
-	
-	// Обновляем статусы выражений и список готовых задач
-	log.Printf("Вызов apiUpdateExpressions после добавления задач")
-	apiUpdateExpressions()
+	Manager.mu.Lock()
+	Manager.Expressions[exprID] = expr
+	Manager.mu.Unlock()
+
+	if len(tasks) > 0 {
+		// Добавляем задачи в глобальный менеджер
+		log.Printf("Добавление задач в глобальный менеджер")
+		Manager.AddExpression(exprID, tasks)
+
+		// Обновляем статусы выражений и список готовых задач
+		log.Printf("Вызов apiUpdateExpressions после добавления задач")
+		apiUpdateExpressions()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"id": exprID})
 }
 
+// NewExpression разбирает текст выражения и создает модель выражения с новым ID,
+// исходным текстом, канонической записью и списком задач.
+// Выражение без операций (например, "-5") сразу считается вычисленным.
+// При синтаксической ошибке возвращается *ParseError.
+func NewExpression(text string) (*models.Expression, []models.Task, error) {
+	return NewExpressionWithVariables(text, nil)
+}
+
+// NewExpressionWithVariables как NewExpression, но имена в выражении заменяются значениями
+// из variables. Использованные значения сохраняются в выражении, чтобы история показывала,
+// с какими входными данными оно вычислено.
+func NewExpressionWithVariables(text string, variables map[string]float64) (*models.Expression, []models.Task, error) {
+	log.Printf("Начало парсинга выражения: '%s'", text)
+
+	root, err := ParseWithVariables(text, variables)
+	if err != nil {
+		log.Printf("Ошибка парсинга выражения '%s': %v", text, err)
+		return nil, nil, err
+	}
+
+	tasks := BuildTasks(root)
+	expr := &models.Expression{
+		ID:         GenerateUniqueExpressionID(),
+		Status:     "pending",
+		CreatedAt:  time.Now().Unix(),
+		Expression: text,
+		Normalized: FormatNode(root),
+		TaskCount:  len(tasks),
+		Variables:  UsedVariables(root),
+	}
+
+	if value, ok := ConstantValue(root); ok {
+		expr.Status = "completed"
+		expr.Result = value
+		log.Printf("Выражение '%s' не требует вычислений, результат: %v", text, value)
+	}
+
+	return expr, tasks, nil
+}
+
+// writeParseError отвечает кодом 422 и описанием синтаксической ошибки,
+// чтобы клиент мог подсветить место ошибки во введенном выражении
+func writeParseError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		*ParseError
+	}{
+		Error:      parseErr.Error(),
+		ParseError: parseErr,
+	})
+}
+
 func ListExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -170,134 +248,30 @@ func TaskHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		log.Printf("TaskHandler POST: получен результат для задачи #%d: %f", result.ID, result.Result)
-
-		// Используем метод AddResult из Manager для обработки результата
-		success := Manager.AddResult(result)
+		if result.Failed() {
+			log.Printf("TaskHandler POST: задача #%d завершилась ошибкой: %s %s", result.ID, result.ErrorCode, result.Error)
+		} else {
+			log.Printf("TaskHandler POST: получен результат для задачи #%d: %f", result.ID, result.Result)
+		}
 
-		if success {
-			log.Printf("TaskHandler POST: результат задачи #%d успешно обработан", result.ID)
-			
-			// Находим ID выражения для этой задачи
-			exprID := ""
-			for taskID, id := range Manager.TaskToExpr {
-				if taskID == result.ID {
-					exprID = id
-					break
-				}
+		// AddResult сохраняет результат, обновляет очередь и статус выражения
+		if err := Manager.AddResult(result); err != nil {
+			log.Printf("TaskHandler POST: результат задачи #%d отклонен: %v", result.ID, err)
+			status := http.StatusNotFound
+			if errors.Is(err, ErrStaleLease) {
+				status = http.StatusConflict
 			}
-			
-			if exprID != "" {
-				// Сохраняем результат в память
-				Manager.mu.Lock()
-				Manager.Results[result.ID] = result.Result
-				log.Printf("TaskHandler POST: результат задачи #%d сохранен в памяти: %f", result.ID, result.Result)
-				Manager.mu.Unlock()
-				
-				// Проверяем, остались ли задачи для этого выражения
-				tasksRemain := false
-				Manager.mu.Lock()
-				for taskID, id := range Manager.TaskToExpr {
-					if id == exprID {
-						if _, ok := Manager.Tasks[taskID]; ok {
-							tasksRemain = true
-							log.Printf("TaskHandler POST: Для выражения %s осталась невыполненная задача #%d", exprID, taskID)
-							break
-						}
-					}
-				}
-				Manager.mu.Unlock()
-				
-				// Если задач больше нет, обновляем результат выражения в БД
-				if !tasksRemain {
-					log.Printf("TaskHandler POST: Для выражения %s не осталось задач, определяем финальный результат", exprID)
-					
-					// Находим задачу с самым большим ID для этого выражения
-					finalTaskID := 0
-					finalResult := 0.0
-					
-					// Собираем все задачи с результатами для этого выражения
-					type taskWithResult struct {
-						id     int
-						result float64
-					}
-					var tasksWithResults []taskWithResult
-					
-					Manager.mu.Lock()
-					for taskID, id := range Manager.TaskToExpr {
-						if id != exprID {
-							continue
-						}
-						
-						// Проверяем, есть ли результат для этой задачи
-						taskResult, resultExists := Manager.Results[taskID]
-						if !resultExists {
-							log.Printf("TaskHandler POST: Задача #%d не имеет результата", taskID)
-							continue
-						}
-						
-						// Добавляем задачу в список
-						tasksWithResults = append(tasksWithResults, taskWithResult{id: taskID, result: taskResult})
-						log.Printf("TaskHandler POST: Задача #%d имеет результат %f", taskID, taskResult)
-					}
-					Manager.mu.Unlock()
-					
-					// Сортируем задачи по ID в порядке убывания (самый большой ID будет первым)
-					sort.Slice(tasksWithResults, func(i, j int) bool {
-						return tasksWithResults[i].id > tasksWithResults[j].id
-					})
-					
-					// Берем задачу с самым большим ID
-					if len(tasksWithResults) > 0 {
-						finalTaskID = tasksWithResults[0].id
-						finalResult = tasksWithResults[0].result
-						log.Printf("TaskHandler POST: Выбрана задача с самым большим ID #%d с результатом %f для выражения %s", finalTaskID, finalResult, exprID)
-						
-						// Обновляем выражение в памяти
-						Manager.mu.Lock()
-						if expr, ok := Manager.Expressions[exprID]; ok {
-							expr.Status = "completed"
-							expr.Result = finalResult
-							log.Printf("TaskHandler POST: Обновлено выражение %s в памяти: статус=completed, результат=%f", exprID, finalResult)
-						} else {
-							log.Printf("TaskHandler POST: Выражение %s не найдено в памяти", exprID)
-						}
-						Manager.mu.Unlock()
-						
-						// Обновляем выражение в БД
-						if err := DB.UpdateExpressionStatus(exprID, "completed", finalResult); err != nil {
-							log.Printf("TaskHandler POST: Ошибка при обновлении выражения %s в БД: %v", exprID, err)
-						} else {
-							log.Printf("TaskHandler POST: Успешно обновлено выражение %s в БД: статус=completed, результат=%f", exprID, finalResult)
-						}
-					} else {
-						log.Printf("TaskHandler POST: Не найден финальный результат для выражения %s", exprID)
-					}
-				} else {
-					log.Printf("TaskHandler POST: результат задачи #%d сохранен в БД", result.ID)
-				}
-				
-					// Затем обновляем статусы выражений в памяти
-				log.Printf("TaskHandler POST: Вызываем apiUpdateExpressions для обновления статусов выражений")
-				apiUpdateExpressions()
-				
-				// Обновляем список готовых задач
-				Manager.UpdateReadyTasksList()
-				
-				// Проверяем состояние менеджера после обновления
-				log.Printf("TaskHandler POST: Всего задач в системе: %d", len(Manager.Tasks))
-				log.Printf("TaskHandler POST: Всего результатов в системе: %d", len(Manager.Results))
-				log.Printf("TaskHandler POST: Всего готовых задач: %d", len(Manager.ReadyTasks))
-			}
-			
-			// Respond with expression statuses
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string][]models.Expression{"expressions": Manager.GetAllExpressions()})
-		} else {
-			log.Printf("TaskHandler POST: ошибка обработки результата задачи #%d", result.ID)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
 		}
+		log.Printf("TaskHandler POST: результат задачи #%d успешно обработан", result.ID)
+
+		// Respond with expression statuses
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string][]models.Expression{"expressions": Manager.GetAllExpressions()})
 		return
 	}
 
@@ -322,7 +296,7 @@ func processTaskDependencies(taskID int, taskResult float64) {
 	dependentTasks := make(map[int]*models.Task)
 	for id, taskPtr := range Manager.Tasks {
 		task := *taskPtr
-		if task.Arg1 == resultStr || task.Arg2 == resultStr {
+		if task.UsesOperand(resultStr) {
 			dependentTasks[id] = taskPtr
 			log.Printf("Задача #%d зависит от результата задачи #%d", id, taskID)
 		}
@@ -336,15 +310,14 @@ func processTaskDependencies(taskID int, taskResult float64) {
 		log.Printf("Обработка зависимой задачи #%d: %s %s %s", id, task.Arg1, task.Operation, task.Arg2)
 
 		// Заменяем ссылки на результат фактическим значением
-		if task.Arg1 == resultStr {
-			log.Printf("Обновление задачи #%d: arg1 изменен с %s на %f", id, task.Arg1, taskResult)
-			task.Arg1 = strconv.FormatFloat(taskResult, 'f', -1, 64)
-		}
-
-		if task.Arg2 == resultStr {
-			log.Printf("Обновление задачи #%d: arg2 изменен с %s на %f", id, task.Arg2, taskResult)
-			task.Arg2 = strconv.FormatFloat(taskResult, 'f', -1, 64)
-		}
+		value := strconv.FormatFloat(taskResult, 'f', -1, 64)
+		task.MapOperands(func(arg string) string {
+			if arg == resultStr {
+				log.Printf("Обновление задачи #%d: аргумент изменен с %s на %s", id, arg, value)
+				return value
+			}
+			return arg
+		})
 
 		log.Printf("Задача #%d обновлена: %s %s %s", id, task.Arg1, task.Operation, task.Arg2)
 
@@ -400,32 +373,14 @@ func apiIsTaskReady(t models.Task) bool {
 		return false
 	}
 
-	// Если хотя бы один аргумент является ссылкой на результат,
-	// задача не готова
-	if strings.HasPrefix(t.Arg1, "result") || strings.HasPrefix(t.Arg2, "result") {
-		log.Printf("Задача #%d содержит ссылки на результаты", t.ID)
-		return false
-	}
-
-	// Если дошли сюда, значит оба аргумента содержат числовые значения
-	// Проверяем, что они действительно числа
-	_, err1 := strconv.ParseFloat(t.Arg1, 64)
-	if err1 != nil {
-		log.Printf("Задача #%d не готова: arg1='%s' не является числом", t.ID, t.Arg1)
-		return false
-	}
-
-	_, err2 := strconv.ParseFloat(t.Arg2, 64)
-	if err2 != nil {
-		log.Printf("Задача #%d не готова: arg2='%s' не является числом", t.ID, t.Arg2)
-		return false
-	}
-
-	// Проверка на деление на ноль
-	if t.Operation == "/" {
-		arg2, _ := strconv.ParseFloat(t.Arg2, 64)
-		if arg2 == 0 {
-			log.Printf("Задача #%d не готова: попытка деления на ноль", t.ID)
+	// Все аргументы должны быть числами: ссылка на результат означает, что задача не готова
+	for i, arg := range t.Operands() {
+		if strings.HasPrefix(arg, "result") {
+			log.Printf("Задача #%d содержит ссылки на результаты", t.ID)
+			return false
+		}
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			log.Printf("Задача #%d не готова: аргумент %d '%s' не является числом", t.ID, i+1, arg)
 			return false
 		}
 	}
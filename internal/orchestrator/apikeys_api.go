@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// APIKeysHandler разбирает путь /api/v1/api-keys[/{id}] и вызывает нужный обработчик.
+// Ключами управляют только по JWT токену: ключ API не может создавать и отзывать ключи
+func (h *AuthHandlers) APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+		return
+	}
+	if auth.ExtractAPIKeyFromRequest(r) != "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "API keys cannot manage API keys"})
+		return
+	}
+
+	rawID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/api-keys"), "/")
+	switch {
+	case rawID == "" && r.Method == http.MethodGet:
+		h.ListAPIKeysHandler(w, r, user)
+	case rawID == "" && r.Method == http.MethodPost:
+		h.CreateAPIKeyHandler(w, r, user)
+	case rawID != "" && !strings.Contains(rawID, "/") && r.Method == http.MethodDelete:
+		h.RevokeAPIKeyHandler(w, r, user, rawID)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+// ListAPIKeysHandler возвращает ключи API пользователя без самих ключей
+func (h *AuthHandlers) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request, user *models.User) {
+	keys, err := h.DB.GetAPIKeys(user.ID)
+	if err != nil {
+		log.Printf("Error getting API keys: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]*models.APIKey{"api_keys": keys})
+}
+
+// CreateAPIKeyHandler создает ключ API. Ключ есть только в этом ответе
+func (h *AuthHandlers) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ExpiresInMs < 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Invalid request data"})
+		return
+	}
+
+	raw, key, err := auth.CreateAPIKey(h.DB, user, req.Name, time.Duration(req.ExpiresInMs)*time.Millisecond)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKeyName) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Printf("Error creating API key: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+
+	log.Printf("Пользователь %s создал ключ API #%d %q", user.Login, key.ID, key.Name)
+	writeJSON(w, http.StatusCreated, models.CreateAPIKeyResponse{Key: raw, APIKey: *key})
+}
+
+// RevokeAPIKeyHandler отзывает ключ API пользователя
+func (h *AuthHandlers) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request, user *models.User, rawID string) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := h.DB.RevokeAPIKey(id, user.ID, time.Now().UnixMilli()); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "API key not found"})
+			return
+		}
+		log.Printf("Error revoking API key: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+
+	log.Printf("Пользователь %s отозвал ключ API #%d", user.Login, id)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
@@ -0,0 +1,159 @@
+package orchestrator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node узел синтаксического дерева выражения
+type Node interface {
+	// Position возвращает позицию узла в исходном выражении (с 1)
+	Position() int
+}
+
+// NumberNode числовой литерал
+type NumberNode struct {
+	Value float64
+	Pos   int
+}
+
+// VariableNode именованная переменная, значение которой передано вместе с выражением
+type VariableNode struct {
+	Name  string
+	Value float64
+	Pos   int
+}
+
+// UnaryNode унарная операция: -x или +x
+type UnaryNode struct {
+	Op      string
+	Operand Node
+	Pos     int
+}
+
+// BinaryNode бинарная операция: x + y, x * y и т.д.
+type BinaryNode struct {
+	Op    string
+	Left  Node
+	Right Node
+	Pos   int // Позиция оператора
+}
+
+// CallNode вызов встроенной функции: sqrt(x), min(a, b, c) и т.д.
+type CallNode struct {
+	Name string
+	Args []Node
+	Pos  int // Позиция имени функции
+}
+
+// Position возвращает позицию литерала
+func (n *NumberNode) Position() int { return n.Pos }
+
+// Position возвращает позицию имени переменной
+func (n *VariableNode) Position() int { return n.Pos }
+
+// Position возвращает позицию унарного оператора
+func (n *UnaryNode) Position() int { return n.Pos }
+
+// Position возвращает позицию бинарного оператора
+func (n *BinaryNode) Position() int { return n.Pos }
+
+// Position возвращает позицию имени функции
+func (n *CallNode) Position() int { return n.Pos }
+
+// FormatNode возвращает каноническую запись выражения: числа в десятичной форме,
+// пробелы вокруг бинарных операторов и только необходимые скобки
+func FormatNode(node Node) string {
+	switch n := node.(type) {
+	case *NumberNode:
+		return strconv.FormatFloat(n.Value, 'f', -1, 64)
+	case *VariableNode:
+		return n.Name
+	case *UnaryNode:
+		operand := FormatNode(n.Operand)
+		if b, ok := n.Operand.(*BinaryNode); ok {
+			if leftBinding, _ := infixBinding(b.Op); leftBinding <= bindingUnary {
+				operand = "(" + operand + ")"
+			}
+		}
+		return n.Op + operand
+	case *BinaryNode:
+		leftBinding, rightBinding := infixBinding(n.Op)
+
+		left := FormatNode(n.Left)
+		switch l := n.Left.(type) {
+		case *BinaryNode:
+			// Левый операнд без скобок не поглотит наш оператор, только если связывает не слабее
+			if _, childRight := infixBinding(l.Op); leftBinding > childRight {
+				left = "(" + left + ")"
+			}
+		case *UnaryNode:
+			if leftBinding > bindingUnary {
+				left = "(" + left + ")"
+			}
+		}
+
+		right := FormatNode(n.Right)
+		if r, ok := n.Right.(*BinaryNode); ok {
+			if childLeft, _ := infixBinding(r.Op); childLeft <= rightBinding {
+				right = "(" + right + ")"
+			}
+		}
+
+		return left + " " + n.Op + " " + right
+	case *CallNode:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = FormatNode(arg)
+		}
+		return n.Name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
+
+// ConstantValue вычисляет выражение, если оно состоит только из чисел, переменных и унарных операций.
+// Для таких выражений BuildTasks не создает ни одной задачи.
+func ConstantValue(node Node) (float64, bool) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return n.Value, true
+	case *VariableNode:
+		return n.Value, true
+	case *UnaryNode:
+		value, ok := ConstantValue(n.Operand)
+		if !ok {
+			return 0, false
+		}
+		if n.Op == "-" {
+			return -value, true
+		}
+		return value, true
+	}
+	return 0, false
+}
+
+// UsedVariables возвращает значения переменных, которые встречаются в выражении
+func UsedVariables(node Node) map[string]float64 {
+	used := make(map[string]float64)
+	var walk func(Node)
+	walk = func(node Node) {
+		switch n := node.(type) {
+		case *VariableNode:
+			used[n.Name] = n.Value
+		case *UnaryNode:
+			walk(n.Operand)
+		case *BinaryNode:
+			walk(n.Left)
+			walk(n.Right)
+		case *CallNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(node)
+	if len(used) == 0 {
+		return nil
+	}
+	return used
+}
@@ -2,9 +2,12 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/GGmuzem/yandex-project/internal/auth"
@@ -86,6 +89,14 @@ func (h *AuthHandlers) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	err = auth.RegisterUser(h.DB, &req)
 	if err != nil {
 		log.Printf("RegisterHandler: Ошибка при регистрации пользователя: %v", err)
+		var policyErr *auth.PolicyError
+		if errors.As(err, &policyErr) {
+			writeJSON(w, http.StatusUnprocessableEntity, struct {
+				Error string `json:"error"`
+				*auth.PolicyError
+			}{Error: policyErr.Error(), PolicyError: policyErr})
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		if err == auth.ErrUserExists {
 			w.WriteHeader(http.StatusConflict)
@@ -128,8 +139,13 @@ func (h *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Аутентифицируем пользователя
-	token, err := auth.LoginUser(h.DB, &req)
+	resp, err := auth.Login(h.DB, &req, auth.ClientIP(r))
 	if err != nil {
+		var lockout *auth.LockoutError
+		if errors.As(err, &lockout) {
+			writeRetryAfter(w, lockout.RetryAfter, err.Error())
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		if err == auth.ErrInvalidCredentials {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -142,9 +158,65 @@ func (h *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Отправляем токен
+	// Отправляем токены
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.LoginResponse{Token: token})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeRetryAfter отвечает 429 Too Many Requests с заголовком Retry-After в целых секундах
+func writeRetryAfter(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"error": message, "retry_after": seconds})
+}
+
+// RefreshHandler обменивает refresh токен на новую пару access и refresh токенов
+func (h *AuthHandlers) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Invalid request data"})
+		return
+	}
+
+	resp, err := auth.RefreshSession(h.DB, req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrSessionRevoked) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired refresh token"})
+		} else {
+			log.Printf("Error refreshing token: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// LogoutHandler завершает сессию access токена запроса (вызывается через AuthMiddleware)
+func (h *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	// Токены без сессии отозвать нельзя, они истекут сами
+	if sessionID, ok := auth.GetSessionFromContext(r.Context()); ok {
+		if err := auth.RevokeSession(h.DB, sessionID); err != nil {
+			log.Printf("Error revoking session: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
 }
 
 // AuthMiddleware промежуточное ПО для проверки аутентификации
@@ -170,32 +242,73 @@ func (h *AuthHandlers) CalculateWithAuthHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	var input struct {
-		Expression string `json:"expression"`
+	// Во время остановки оркестратора новые выражения не принимаются
+	if Manager.Draining() {
+		writeShuttingDown(w)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Expression == "" {
+
+	var input models.CalculateRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Invalid data", http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Используем функцию из Manager для генерации ID
-	exprID := GenerateUniqueExpressionID()
+	// Разбираем выражение синхронно, чтобы сразу сообщить клиенту о синтаксической ошибке
+	log.Printf("Парсинг выражения: %s для пользователя %s, переменные: %v", input.Expression, user.Login, input.Variables)
+	expr, taskList, err := NewExpressionWithVariables(input.Expression, input.Variables)
+	if err != nil {
+		log.Printf("Выражение пользователя %s отклонено: %v", user.Login, err)
+		writeParseError(w, err)
+		return
+	}
 
-	// Создаем выражение с ID пользователя
-	expr := &models.Expression{
-		ID:        exprID,
-		Status:    "pending",
-		UserID:    user.ID,
-		CreatedAt: time.Now().Unix(),
+	exprID, ok := h.submitExpression(w, user, expr, taskList)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"id": exprID})
+}
+
+// submitExpression проверяет ограничения роли, сохраняет разобранное выражение пользователя
+// и ставит его задачи в очередь. При ошибке отвечает клиенту сам и возвращает false
+func (h *AuthHandlers) submitExpression(w http.ResponseWriter, user *models.User, expr *models.Expression, taskList []models.Task) (string, bool) {
+	// Проверяем ограничения роли до сохранения, чтобы отклоненное выражение не учитывалось.
+	// Проверка и сохранение выполняются под мьютексом пользователя, иначе одновременные
+	// запросы увидят один и тот же счет выражений и вместе превысят ограничение
+	unlock := Quotas.LockUser(user.ID)
+	if err := CheckSubmission(h.DB, user, len(taskList)); err != nil {
+		unlock()
+		var quotaErr *QuotaError
+		switch {
+		case errors.As(err, &quotaErr) && quotaErr.Quota == QuotaTasks:
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "quota": quotaErr.Quota})
+		case errors.As(err, &quotaErr):
+			log.Printf("Выражение пользователя %s отклонено: %v", user.Login, err)
+			writeRetryAfter(w, quotaErr.RetryAfter, err.Error())
+		default:
+			log.Printf("Error checking quotas: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		}
+		return "", false
 	}
 
-	// Сохраняем выражение в БД
-	if err := h.DB.SaveExpression(expr); err != nil {
+	// Привязываем выражение к пользователю
+	exprID := expr.ID
+	expr.UserID = user.ID
+
+	// Сохраняем выражение в БД, после этого его видят проверки следующих запросов
+	err := h.DB.SaveExpression(expr)
+	unlock()
+	if err != nil {
 		log.Printf("Error saving expression: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
-		return
+		return "", false
 	}
 
 	// Используем глобальный менеджер задач
@@ -203,29 +316,40 @@ func (h *AuthHandlers) CalculateWithAuthHandler(w http.ResponseWriter, r *http.R
 	Manager.Expressions[exprID] = expr
 	Manager.mu.Unlock()
 
-	go func() {
-		log.Printf("Парсинг выражения: %s для пользователя %s", input.Expression, user.Login)
-		taskList := ParseExpression(input.Expression)
-
-		log.Printf("Создание задач для выражения %s. Всего задач: %d", exprID, len(taskList))
-
-		// Отображаем все созданные задачи
-		log.Printf("Структура созданных задач для выражения %s:", exprID)
-		for i, t := range taskList {
-			log.Printf("Задача %d: ID=%d, %s %s %s, Готова: %v",
-				i+1, t.ID, t.Arg1, t.Operation, t.Arg2, IsTaskReady(t))
-		}
+	log.Printf("Создание задач для выражения %s. Всего задач: %d", exprID, len(taskList))
 
+	if len(taskList) > 0 {
 		// Добавляем задачи в менеджер
 		Manager.AddExpression(exprID, taskList)
 
 		// Обновляем статус выражения
 		apiUpdateExpressions()
-	}()
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": exprID})
+	return exprID, true
+}
+
+// UsageHandler возвращает ограничения роли пользователя и их текущее использование
+func (h *AuthHandlers) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	usage, err := UserUsage(h.DB, user)
+	if err != nil {
+		log.Printf("Error getting usage: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, usage)
 }
 
 // ListExpressionsWithAuthHandler обработчик списка выражений с аутентификацией
@@ -20,8 +20,8 @@ func NewDBOrchestrator(db database.Database) *DBOrchestrator {
 }
 
 // UpdateExpressionStatusInDB обновляет статус выражения в БД
-func (o *DBOrchestrator) UpdateExpressionStatusInDB(id string, status string, result float64) error {
-	return o.DB.UpdateExpressionStatus(id, status, result)
+func (o *DBOrchestrator) UpdateExpressionStatusInDB(id string, status string, result float64, errMsg string) error {
+	return o.DB.UpdateExpressionStatus(id, status, result, errMsg)
 }
 
 // LoadExpressionsFromDB загружает выражения из БД в память
@@ -76,7 +76,7 @@ func (o *DBOrchestrator) UpdateExpressionsStatusInDB() {
 		log.Println("Обновление статусов выражений в БД...")
 
 		for id, expr := range Manager.Expressions {
-			if err := o.DB.UpdateExpressionStatus(id, expr.Status, expr.Result); err != nil {
+			if err := o.DB.UpdateExpressionStatus(id, expr.Status, expr.Result, expr.Error); err != nil {
 				log.Printf("Ошибка обновления статуса выражения %s в БД: %v", id, err)
 			}
 		}
@@ -0,0 +1,274 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// maxFormulaNameLength наибольшая длина имени формулы в символах
+const maxFormulaNameLength = 100
+
+// FormulasHandler разбирает путь /api/v1/formulas[/{name}[/evaluate]] и вызывает нужный обработчик
+func (h *AuthHandlers) FormulasHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/formulas"), "/")
+	name, action, _ := strings.Cut(rest, "/")
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		h.ListFormulasHandler(w, r, user)
+	case name == "" && r.Method == http.MethodPost:
+		h.CreateFormulaHandler(w, r, user)
+	case name != "" && action == "" && r.Method == http.MethodGet:
+		h.GetFormulaHandler(w, r, user, name)
+	case name != "" && action == "" && r.Method == http.MethodPut:
+		h.UpdateFormulaHandler(w, r, user, name)
+	case name != "" && action == "" && r.Method == http.MethodDelete:
+		h.DeleteFormulaHandler(w, r, user, name)
+	case name != "" && action == "evaluate" && r.Method == http.MethodPost:
+		h.EvaluateFormulaHandler(w, r, user, name)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+// ValidateFormula проверяет имя формулы, ее параметры и выражение. Выражение разбирается
+// с нулевыми значениями параметров, так что имена, не объявленные параметрами, отклоняются.
+// Ошибки выражения и имен параметров возвращаются как *ParseError
+func ValidateFormula(name, expression string, parameters []string) error {
+	if !IsIdentifier(name) || utf8.RuneCountInString(name) > maxFormulaNameLength {
+		return fmt.Errorf("недопустимое имя формулы '%s': ожидается буква или _, затем буквы, цифры и _, не длиннее %d символов",
+			name, maxFormulaNameLength)
+	}
+
+	values := make(map[string]float64, len(parameters))
+	for _, param := range parameters {
+		if _, exists := values[param]; exists {
+			return fmt.Errorf("параметр '%s' объявлен дважды", param)
+		}
+		values[param] = 0
+	}
+	_, err := ParseWithVariables(expression, values)
+	return err
+}
+
+// formulaArguments проверяет, что переданы значения ровно для объявленных параметров формулы
+func formulaArguments(formula *models.Formula, args map[string]float64) error {
+	declared := make(map[string]bool, len(formula.Parameters))
+	var missing, unknown []string
+	for _, param := range formula.Parameters {
+		declared[param] = true
+		if _, ok := args[param]; !ok {
+			missing = append(missing, param)
+		}
+	}
+	for name := range args {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("не переданы значения параметров: %s", strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("у формулы '%s' нет параметров: %s", formula.Name, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// attachLastEvaluation подставляет в формулу состояние ее последнего вычисления.
+// Если выражение уже недоступно, формула выдается без него
+func (h *AuthHandlers) attachLastEvaluation(formula *models.Formula) {
+	if formula.LastExpressionID == "" {
+		return
+	}
+	expr, err := h.DB.GetExpression(formula.LastExpressionID, formula.UserID)
+	if err != nil {
+		log.Printf("Последнее вычисление формулы %s недоступно: %v", formula.Name, err)
+		return
+	}
+	formula.LastEvaluation = expr
+}
+
+// writeFormulaError отвечает на ошибку получения или изменения формулы
+func writeFormulaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Formula not found"})
+		return
+	}
+	log.Printf("Error accessing formula: %v", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+}
+
+// ListFormulasHandler возвращает формулы пользователя вместе с их последними вычислениями
+func (h *AuthHandlers) ListFormulasHandler(w http.ResponseWriter, r *http.Request, user *models.User) {
+	formulas, err := h.DB.GetFormulas(user.ID)
+	if err != nil {
+		log.Printf("Error getting formulas: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	for _, formula := range formulas {
+		h.attachLastEvaluation(formula)
+	}
+	writeJSON(w, http.StatusOK, map[string][]*models.Formula{"formulas": formulas})
+}
+
+// GetFormulaHandler возвращает формулу пользователя по имени
+func (h *AuthHandlers) GetFormulaHandler(w http.ResponseWriter, r *http.Request, user *models.User, name string) {
+	formula, err := h.DB.GetFormula(user.ID, name)
+	if err != nil {
+		writeFormulaError(w, err)
+		return
+	}
+	h.attachLastEvaluation(formula)
+	writeJSON(w, http.StatusOK, map[string]*models.Formula{"formula": formula})
+}
+
+// CreateFormulaHandler сохраняет новую формулу пользователя
+func (h *AuthHandlers) CreateFormulaHandler(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var req models.FormulaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Invalid request data"})
+		return
+	}
+	if err := ValidateFormula(req.Name, req.Expression, req.Parameters); err != nil {
+		writeParseError(w, err)
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	formula := &models.Formula{
+		UserID:     user.ID,
+		Name:       req.Name,
+		Expression: req.Expression,
+		Parameters: req.Parameters,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if formula.Parameters == nil {
+		formula.Parameters = []string{}
+	}
+
+	id, err := h.DB.CreateFormula(formula)
+	if err != nil {
+		if errors.Is(err, database.ErrAlreadyExists) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Formula already exists"})
+			return
+		}
+		log.Printf("Error creating formula: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	formula.ID = id
+
+	log.Printf("Пользователь %s сохранил формулу %s(%s)", user.Login, formula.Name, strings.Join(formula.Parameters, ", "))
+	writeJSON(w, http.StatusCreated, map[string]*models.Formula{"formula": formula})
+}
+
+// UpdateFormulaHandler меняет выражение и параметры формулы. Имя формулы не меняется
+func (h *AuthHandlers) UpdateFormulaHandler(w http.ResponseWriter, r *http.Request, user *models.User, name string) {
+	var req models.FormulaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Name != "" && req.Name != name) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Invalid request data"})
+		return
+	}
+	if err := ValidateFormula(name, req.Expression, req.Parameters); err != nil {
+		writeParseError(w, err)
+		return
+	}
+
+	formula, err := h.DB.GetFormula(user.ID, name)
+	if err != nil {
+		writeFormulaError(w, err)
+		return
+	}
+	formula.Expression = req.Expression
+	formula.Parameters = req.Parameters
+	if formula.Parameters == nil {
+		formula.Parameters = []string{}
+	}
+	formula.UpdatedAt = time.Now().UnixMilli()
+	if err := h.DB.UpdateFormula(formula); err != nil {
+		writeFormulaError(w, err)
+		return
+	}
+
+	log.Printf("Пользователь %s изменил формулу %s", user.Login, name)
+	h.attachLastEvaluation(formula)
+	writeJSON(w, http.StatusOK, map[string]*models.Formula{"formula": formula})
+}
+
+// DeleteFormulaHandler удаляет формулу пользователя. Отправленные ею выражения остаются в истории
+func (h *AuthHandlers) DeleteFormulaHandler(w http.ResponseWriter, r *http.Request, user *models.User, name string) {
+	if err := h.DB.DeleteFormula(user.ID, name); err != nil {
+		writeFormulaError(w, err)
+		return
+	}
+
+	log.Printf("Пользователь %s удалил формулу %s", user.Login, name)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Formula deleted"})
+}
+
+// EvaluateFormulaHandler отправляет на вычисление выражение формулы с переданными значениями параметров.
+// Выражение проходит те же проверки и ограничения роли, что и отправленное через /api/v1/calculate
+func (h *AuthHandlers) EvaluateFormulaHandler(w http.ResponseWriter, r *http.Request, user *models.User, name string) {
+	// Во время остановки оркестратора новые выражения не принимаются
+	if Manager.Draining() {
+		writeShuttingDown(w)
+		return
+	}
+
+	var req models.EvaluateFormulaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "Invalid request data"})
+		return
+	}
+
+	formula, err := h.DB.GetFormula(user.ID, name)
+	if err != nil {
+		writeFormulaError(w, err)
+		return
+	}
+	if err := formulaArguments(formula, req.Arguments); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Вычисление формулы %s для пользователя %s, аргументы: %v", formula.Name, user.Login, req.Arguments)
+	expr, taskList, err := NewExpressionWithVariables(formula.Expression, req.Arguments)
+	if err != nil {
+		log.Printf("Формула %s пользователя %s отклонена: %v", formula.Name, user.Login, err)
+		writeParseError(w, err)
+		return
+	}
+
+	exprID, ok := h.submitExpression(w, user, expr, taskList)
+	if !ok {
+		return
+	}
+
+	// Выражение уже принято, поэтому ошибка сохранения ссылки на него не отменяет вычисление
+	if err := h.DB.SetFormulaLastExpression(formula.ID, exprID); err != nil {
+		log.Printf("Не удалось запомнить вычисление %s формулы %s: %v", exprID, formula.Name, err)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"id": exprID})
+}
@@ -2,21 +2,22 @@ package orchestrator
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/GGmuzem/yandex-project/internal/database"
 	"github.com/GGmuzem/yandex-project/pkg/calculator"
-	"github.com/GGmuzem/yandex-project/pkg/models"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
 // CalculatorServer реализация gRPC сервера оркестратора
 type CalculatorServer struct {
+	calculator.UnimplementedCalculatorServer
+
 	DB         database.Database
 	mutex      *sync.Mutex
 	tasksMutex *sync.Mutex
@@ -31,22 +32,16 @@ func NewCalculatorServer(db database.Database, mutex, tasksMutex *sync.Mutex) *C
 	}
 }
 
-// StartGRPCServer запускает gRPC сервер оркестратора
-func StartGRPCServer(db database.Database, mutex, tasksMutex *sync.Mutex) error {
-	// Получаем порт из переменной окружения
-	port := os.Getenv("GRPC_PORT")
-	if port == "" {
-		port = "50052" // По умолчанию используем порт 50052
-	}
-
-	// Создаем листенер для gRPC сервера
-	lis, err := net.Listen("tcp", ":"+port)
+// StartGRPCServer запускает gRPC сервер оркестратора и возвращает его для остановки через StopGRPCServer
+func StartGRPCServer(db database.Database, mutex, tasksMutex *sync.Mutex) (*grpc.Server, error) {
+	// Создаем листенер для gRPC сервера на порту из настроек
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", Config.GRPC.Port))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Создаем gRPC сервер
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(MetricsServerOptions()...)
 
 	// Регистрируем сервис оркестратора
 	calculatorServer := NewCalculatorServer(db, mutex, tasksMutex)
@@ -54,122 +49,85 @@ func StartGRPCServer(db database.Database, mutex, tasksMutex *sync.Mutex) error
 	// Регистрируем сервер (регистрация должна быть определена в pkg/calculator)
 	calculator.RegisterCalculatorServer(grpcServer, calculatorServer)
 
+	// Стандартная проверка здоровья, по которой агенты ждут готовности оркестратора
+	RegisterHealthService(grpcServer)
+
 	// Включаем рефлексию для отладки
 	reflection.Register(grpcServer)
 
-	// Запускаем сервер в отдельной горутине
+	// Запускаем сервер в отдельной горутине. Остановка сервера не завершает процесс:
+	// /readyz и grpc.health.v1 начинают сообщать о неготовности
 	go func() {
-		log.Printf("gRPC сервер запущен на порту :%s", port)
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("Ошибка при запуске gRPC сервера: %v", err)
+		log.Printf("gRPC сервер запущен на порту :%d", Config.GRPC.Port)
+		if err := ServeGRPC(grpcServer, lis); err != nil {
+			log.Printf("gRPC сервер остановлен с ошибкой: %v", err)
 		}
 	}()
 
-	return nil
+	return grpcServer, nil
+}
+
+// RegisterAgent - регистрация агента, оркестратор назначает ему ID
+func (s *CalculatorServer) RegisterAgent(ctx context.Context, req *calculator.RegisterAgentRequest) (*calculator.RegisterAgentResponse, error) {
+	agent := Agents.Register(req.AgentId, req.Hostname, req.Version, int(req.Capacity), req.Operations)
+	return &calculator.RegisterAgentResponse{
+		AgentId:             agent.ID,
+		HeartbeatIntervalMs: int32(HeartbeatInterval() / time.Millisecond),
+	}, nil
+}
+
+// Heartbeat - сигнал агента о том, что он жив
+func (s *CalculatorServer) Heartbeat(ctx context.Context, req *calculator.HeartbeatRequest) (*calculator.HeartbeatResponse, error) {
+	known := Agents.Heartbeat(req.AgentId, int(req.InFlight))
+	if !known {
+		log.Printf("=== GRPC SERVER: Heartbeat от неизвестного агента #%d, требуется повторная регистрация", req.AgentId)
+	}
+	return &calculator.HeartbeatResponse{Known: known}, nil
 }
 
 // GetTask - получение задачи агентом
 func (s *CalculatorServer) GetTask(ctx context.Context, req *calculator.GetTaskRequest) (*calculator.Task, error) {
-	log.Printf("=== GRPC SERVER: Получен запрос GetTask от агента ID=%d", req.AgentID)
-
-	// Добавляем прямой доступ к менеджеру задач
-	Manager.mu.Lock()
-	defer Manager.mu.Unlock()
+	log.Printf("=== GRPC SERVER: Получен запрос GetTask от агента ID=%d", req.AgentId)
 
-	// Проверяем наличие готовых задач
-	log.Printf("=== GRPC SERVER: Количество задач в системе: %d, в очереди готовых: %d", 
-		len(Manager.Tasks), len(Manager.ReadyTasks))
+	Agents.Touch(req.AgentId)
 
-	// Обновляем список готовых задач перед выдачей
-	log.Printf("=== GRPC SERVER: Вызываем UpdateReadyTasksList() для обновления списка готовых задач")
-	Manager.UpdateReadyTasksList()
-	log.Printf("=== GRPC SERVER: После обновления в очереди готовых: %d", len(Manager.ReadyTasks))
+	// Менеджер обновляет очередь готовых задач и отмечает выданную задачу как обрабатываемую
+	task, found := Manager.GetTaskForAgent(req.AgentId)
 
 	// Если нет готовых задач, возвращаем пустую задачу
-	if len(Manager.ReadyTasks) == 0 {
-		log.Printf("=== GRPC SERVER: Нет готовых задач для агента #%d", req.AgentID)
-		return &calculator.Task{
-			ID:            0,
-			Arg1:          "",
-			Arg2:          "",
-			Operation:     "",
-			OperationTime: 0,
-			ExpressionID:  "",
-		}, nil
+	if !found {
+		log.Printf("=== GRPC SERVER: Нет готовых задач для агента #%d", req.AgentId)
+		return &calculator.Task{}, nil
 	}
 
-	// Берём первую задачу из очереди
-	task := Manager.ReadyTasks[0]
-	log.Printf("=== GRPC SERVER: Выбрана задача #%d для выдачи агенту: %s %s %s", 
-		task.ID, task.Arg1, task.Operation, task.Arg2)
-	
-	// Удаляем её из очереди
-	if len(Manager.ReadyTasks) > 1 {
-		Manager.ReadyTasks = Manager.ReadyTasks[1:]
-	} else {
-		Manager.ReadyTasks = []models.Task{}
-	}
-
-	// Отмечаем задачу как обрабатываемую и сохраняем время начала обработки
-	Manager.ProcessingTasks[task.ID] = true
-	Manager.TaskProcessingStartTime[task.ID] = time.Now()
-
 	log.Printf("=== GRPC SERVER: Возвращаем задачу #%d агенту #%d: %s %s %s, ExprID=%s", 
-		task.ID, req.AgentID, task.Arg1, task.Operation, task.Arg2, task.ExpressionID)
-
-	// Преобразуем в protobuf формат
-	return &calculator.Task{
-		ID:            int32(task.ID),
-		Arg1:          task.Arg1,
-		Arg2:          task.Arg2,
-		Operation:     task.Operation,
-		OperationTime: int32(task.OperationTime),
-		ExpressionID:  task.ExpressionID,
-	}, nil
+		task.ID, req.AgentId, task.Arg1, task.Operation, task.Arg2, task.ExpressionID)
+
+	// Преобразуем в protobuf формат (вместе с арендой задачи)
+	return calculator.ConvertTaskToGRPC(task), nil
 }
 
-// SubmitResult обрабатывает результат задачи от агента
+// SubmitResult обрабатывает результат задачи от агента.
+// Результат с кодом ошибки переводит выражение в статус error.
 func (s *CalculatorServer) SubmitResult(ctx context.Context, result *calculator.TaskResult) (*calculator.SubmitResultResponse, error) {
-	log.Printf("=== GRPC SERVER: Получен результат для задачи #%d: %f, выражение: %s", result.ID, result.Result, result.ExpressionID)
-
-	// Прямое сохранение результата в менеджере задач
-	Manager.mu.Lock()
-	
-	// Сохраняем результат в памяти
-	Manager.Results[int(result.ID)] = result.Result
-	log.Printf("=== GRPC SERVER: Результат задачи #%d сохранен в памяти: %f", result.ID, result.Result)
-	
-	// Удаляем задачу из списка задач в обработке
-	delete(Manager.ProcessingTasks, int(result.ID))
-	delete(Manager.TaskProcessingStartTime, int(result.ID))
-	
-	// Обновляем список готовых задач
-	Manager.UpdateReadyTasksList()
-	
-	// Получаем ID выражения
-	exprID := result.ExpressionID
-	Manager.mu.Unlock()
-
-	if exprID == "" {
-		log.Printf("=== GRPC SERVER: Задача #%d не имеет связанного выражения", result.ID)
-		return &calculator.SubmitResultResponse{
-			Success: true,
-			Message: "результат обработан",
-		}, nil
+	if result.ErrorCode != "" || result.ErrorMessage != "" {
+		log.Printf("=== GRPC SERVER: Задача #%d выражения %s завершилась ошибкой: %s (%s)",
+			result.Id, result.ExpressionId, result.ErrorMessage, result.ErrorCode)
+	} else {
+		log.Printf("=== GRPC SERVER: Получен результат для задачи #%d: %f, выражение: %s", result.Id, result.Result, result.ExpressionId)
 	}
 
-	// Сохраняем результат в БД
-	if err := s.DB.SaveResult(int(result.ID), result.Result, exprID); err != nil {
-		log.Printf("=== GRPC SERVER: Ошибка при сохранении результата задачи #%d в БД: %v", result.ID, err)
-	} else {
-		log.Printf("=== GRPC SERVER: Результат задачи #%d успешно сохранен в БД", result.ID)
+	// Менеджер сохраняет результат (в том числе в БД), обновляет очередь и статус выражения
+	if err := Manager.AddResult(calculator.ConvertGRPCToTaskResult(result)); err != nil {
+		log.Printf("=== GRPC SERVER: Результат задачи #%d (аренда %s) отклонен: %v", result.Id, result.LeaseId, err)
+		return &calculator.SubmitResultResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
 	}
 
-	// Обновляем статусы выражений
-	UpdateExpressions()
+	log.Printf("=== GRPC SERVER: Результат задачи #%d успешно обработан, очередь готовых задач обновлена", result.Id)
 
-	log.Printf("=== GRPC SERVER: Результат задачи #%d успешно обработан, очередь готовых задач обновлена", result.ID)
-	
 	return &calculator.SubmitResultResponse{
 		Success: true,
 		Message: "результат обработан",
@@ -0,0 +1,157 @@
+package orchestrator
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+)
+
+// StreamTasks - двунаправленный поток задач с агентом.
+// Агент сообщает емкость (сколько задач готов принять), оркестратор отправляет задачи
+// сразу по мере готовности, не дожидаясь опроса, а результаты принимает по тому же потоку.
+// Каждый результат может вернуть агенту слот через поле capacity.
+// Если агент отключился, не прислав результаты, выданные ему задачи возвращаются в очередь.
+// При остановке оркестратора поток закрывается после получения результатов всех выданных задач.
+func (s *CalculatorServer) StreamTasks(stream calculator.Calculator_StreamTasksServer) error {
+	ctx := stream.Context()
+	agentID := int32(0)
+
+	// Send потока нельзя вызывать конкурентно: задачи и подтверждения отправляются из разных горутин
+	var sendMu sync.Mutex
+	send := func(msg *calculator.ServerMessage) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(msg)
+	}
+
+	// Задачи, выданные по этому потоку и еще не вернувшиеся с результатом: task_id -> lease_id
+	var inFlightMu sync.Mutex
+	inFlight := make(map[int]string)
+	defer func() {
+		inFlightMu.Lock()
+		defer inFlightMu.Unlock()
+		for taskID, leaseID := range inFlight {
+			if Manager.ReleaseLease(taskID, leaseID) {
+				log.Printf("=== GRPC STREAM: Агент #%d отключился, задача #%d возвращена в очередь", agentID, taskID)
+			}
+		}
+	}()
+
+	capacity := make(chan int32, 1)
+	recvErr := make(chan error, 1)
+	// results будит цикл отправки после каждого результата. При остановке агент возвращает
+	// последние результаты с нулевой емкостью, и без этого сигнала поток не заметил бы,
+	// что выданных задач не осталось
+	results := make(chan struct{}, 1)
+
+	// handle принимает результат задачи и передает объявленную емкость в цикл отправки
+	handle := func(msg *calculator.AgentMessage) error {
+		Agents.Touch(msg.AgentId)
+		if msg.Result != nil {
+			inFlightMu.Lock()
+			delete(inFlight, int(msg.Result.Id))
+			inFlightMu.Unlock()
+
+			resp, _ := s.SubmitResult(ctx, msg.Result)
+			ack := &calculator.ResultAck{TaskId: msg.Result.Id, Success: resp.Success, Message: resp.Message}
+			if err := send(&calculator.ServerMessage{Ack: ack}); err != nil {
+				return err
+			}
+			select {
+			case results <- struct{}{}:
+			default:
+			}
+		}
+
+		if msg.Capacity > 0 {
+			select {
+			case capacity <- msg.Capacity:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	// Первое сообщение представляет агента
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	agentID = first.AgentId
+	log.Printf("=== GRPC STREAM: Агент #%d открыл поток задач, емкость %d", agentID, first.Capacity)
+	if err := handle(first); err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err == nil {
+				err = handle(msg)
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+
+	var credits int32
+	drain := Manager.DrainSignal()
+	draining := false
+	for {
+		// При остановке оркестратора поток закрывается, как только агент вернет все задачи
+		if draining {
+			inFlightMu.Lock()
+			pending := len(inFlight)
+			inFlightMu.Unlock()
+			if pending == 0 {
+				log.Printf("=== GRPC STREAM: Оркестратор останавливается, поток задач агента #%d закрыт", agentID)
+				return nil
+			}
+		}
+
+		// Сигнал берем до попытки получить задачу, чтобы не пропустить появление новой
+		var ready <-chan struct{}
+		if credits > 0 {
+			ready = Manager.ReadySignal()
+			if task, found := Manager.GetTaskForAgent(agentID); found {
+				inFlightMu.Lock()
+				inFlight[task.ID] = task.LeaseID
+				inFlightMu.Unlock()
+
+				log.Printf("=== GRPC STREAM: Отправляем задачу #%d агенту #%d: %s %s %s, ExprID=%s",
+					task.ID, agentID, task.Arg1, task.Operation, task.Arg2, task.ExpressionID)
+				if err := send(&calculator.ServerMessage{Task: calculator.ConvertTaskToGRPC(task)}); err != nil {
+					log.Printf("=== GRPC STREAM: Ошибка отправки задачи #%d агенту #%d: %v", task.ID, agentID, err)
+					return err
+				}
+				credits--
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				log.Printf("=== GRPC STREAM: Агент #%d закрыл поток задач", agentID)
+				return nil
+			}
+			log.Printf("=== GRPC STREAM: Поток задач агента #%d прерван: %v", agentID, err)
+			return err
+		case n := <-capacity:
+			credits += n
+		case <-results:
+		case <-ready:
+		case <-drain:
+			draining = true
+			drain = nil
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	// grpcServing выставляется, пока gRPC сервер принимает соединения
+	grpcServing atomic.Bool
+	// healthServer реализация grpc.health.v1, по которой агенты ждут готовности оркестратора
+	healthServer = health.NewServer()
+)
+
+// Проверки готовности оркестратора
+const (
+	CheckDatabase    = "database"
+	CheckGRPC        = "grpc"
+	CheckTaskManager = "task_manager"
+	CheckShutdown    = "shutdown"
+)
+
+// CheckReadiness проверяет, что БД отвечает, gRPC сервер принимает соединения,
+// менеджер задач восстановил состояние и оркестратор не останавливается.
+// Возвращает состояние каждой проверки ("ok" или описание ошибки) и общий итог.
+func CheckReadiness(db database.Database) (map[string]string, bool) {
+	checks := map[string]string{CheckDatabase: "ok", CheckGRPC: "ok", CheckTaskManager: "ok", CheckShutdown: "ok"}
+	ready := true
+
+	if db == nil {
+		checks[CheckDatabase] = "база данных не подключена"
+		ready = false
+	} else if err := db.Ping(); err != nil {
+		checks[CheckDatabase] = err.Error()
+		ready = false
+	}
+	if !grpcServing.Load() {
+		checks[CheckGRPC] = "gRPC сервер не запущен"
+		ready = false
+	}
+	if !Manager.Initialized() {
+		checks[CheckTaskManager] = "менеджер задач не инициализирован"
+		ready = false
+	}
+	if Manager.Draining() {
+		checks[CheckShutdown] = "оркестратор останавливается"
+		ready = false
+	}
+	return checks, ready
+}
+
+// RegisterHealthService регистрирует grpc.health.v1 на gRPC сервере.
+// До первой проверки готовности сервис сообщает NOT_SERVING.
+func RegisterHealthService(server *grpc.Server) {
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(calculator.Calculator_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+}
+
+// UpdateGRPCHealth выполняет проверки готовности и публикует итог через grpc.health.v1
+func UpdateGRPCHealth(db database.Database) bool {
+	checks, ready := CheckReadiness(db)
+
+	status := healthpb.HealthCheckResponse_SERVING
+	if !ready {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+		log.Printf("Оркестратор не готов: %v", checks)
+	}
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(calculator.Calculator_ServiceDesc.ServiceName, status)
+	return ready
+}
+
+// StartHealthMonitor периодически обновляет статус grpc.health.v1. Работает до отмены ctx.
+func StartHealthMonitor(ctx context.Context, db database.Database, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	UpdateGRPCHealth(db)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			UpdateGRPCHealth(db)
+		}
+	}
+}
+
+// ServeGRPC обслуживает соединения gRPC сервера и отмечает, что сервер работает.
+// После остановки сервера проверка готовности и grpc.health.v1 сообщают о неготовности.
+func ServeGRPC(server *grpc.Server, lis net.Listener) error {
+	grpcServing.Store(true)
+	defer func() {
+		grpcServing.Store(false)
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthServer.SetServingStatus(calculator.Calculator_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	}()
+	return server.Serve(lis)
+}
+
+// HealthzHandler проверка жизнеспособности: процесс запущен и обслуживает HTTP
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadyzHandler проверка готовности: 200, если оркестратор готов принимать выражения
+// и раздавать задачи, иначе 503 с причинами
+func ReadyzHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks, ready := CheckReadiness(db)
+
+		status, code := "ok", http.StatusOK
+		if !ready {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+	}
+}
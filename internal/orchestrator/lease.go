@@ -0,0 +1,155 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+)
+
+// Ошибки приема результата задачи
+var (
+	// ErrTaskNotFound задача неизвестна: уже выполнена или отменена вместе с выражением
+	ErrTaskNotFound = errors.New("задача не найдена или отменена")
+	// ErrStaleLease результат пришел по истекшей аренде, задача возвращена в очередь
+	ErrStaleLease = errors.New("аренда задачи истекла, задача передана другому агенту")
+)
+
+var leaseIDCounter int64
+
+// newLeaseID генерирует уникальный идентификатор аренды задачи
+func newLeaseID(taskID int) string {
+	id := atomic.AddInt64(&leaseIDCounter, 1)
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	return strconv.Itoa(taskID) + "-" + strconv.FormatInt(timestamp, 10) + "-" + strconv.FormatInt(id, 10)
+}
+
+// leaseSlack запас времени сверх OperationTime на доставку задачи и результата
+func leaseSlack() time.Duration {
+	return time.Duration(Config.Scheduler.LeaseSlackMs) * time.Millisecond
+}
+
+// LeaseDeadline возвращает срок аренды задачи, выданной агенту в момент start
+func LeaseDeadline(start time.Time, operationTime int) time.Time {
+	return start.Add(time.Duration(operationTime)*time.Millisecond + leaseSlack())
+}
+
+// releaseTask снимает с задачи отметку об обработке и аренду.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) releaseTask(taskID int) {
+	delete(tm.ProcessingTasks, taskID)
+	delete(tm.TaskProcessingStartTime, taskID)
+	delete(tm.TaskLeases, taskID)
+	delete(tm.TaskAgents, taskID)
+}
+
+// ReleaseLease досрочно возвращает задачу в очередь, если она все еще выдана по аренде leaseID.
+// Используется, когда агент отключился, не прислав результат.
+func (tm *TaskManager) ReleaseLease(taskID int, leaseID string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if current, leased := tm.TaskLeases[taskID]; !leased || current != leaseID {
+		return false
+	}
+
+	log.Printf("ReleaseLease: Аренда %s задачи #%d снята, возвращаем задачу в очередь", leaseID, taskID)
+	tm.releaseTask(taskID)
+	persist("ReleaseLease", func(db database.Database) error {
+		return db.UpdateTaskLease(taskID, "", 0)
+	})
+	tm.updateReadyTasksList()
+	return true
+}
+
+// ReleaseAgentLeases возвращает в очередь все задачи, выданные агенту agentID.
+// Возвращает количество освобожденных задач.
+func (tm *TaskManager) ReleaseAgentLeases(agentID int32) int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	released := 0
+	for taskID, owner := range tm.TaskAgents {
+		if owner != agentID {
+			continue
+		}
+		log.Printf("ReleaseAgentLeases: Агент #%d не отвечает, задача #%d возвращена в очередь", agentID, taskID)
+		tm.releaseTask(taskID)
+		persist("ReleaseAgentLeases", func(db database.Database) error {
+			return db.UpdateTaskLease(taskID, "", 0)
+		})
+		released++
+	}
+
+	if released > 0 {
+		tm.updateReadyTasksList()
+	}
+	return released
+}
+
+// InFlightByAgent возвращает количество задач, выданных каждому агенту
+func (tm *TaskManager) InFlightByAgent() map[int32]int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	inFlight := make(map[int32]int)
+	for _, agentID := range tm.TaskAgents {
+		inFlight[agentID]++
+	}
+	return inFlight
+}
+
+// ReleaseExpiredLeases возвращает в очередь готовых задач задачи,
+// аренда которых истекла к моменту now. Возвращает количество освобожденных задач.
+func (tm *TaskManager) ReleaseExpiredLeases(now time.Time) int {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	released := 0
+	for taskID, startTime := range tm.TaskProcessingStartTime {
+		task, exists := tm.Tasks[taskID]
+		if !exists {
+			tm.releaseTask(taskID)
+			continue
+		}
+
+		if deadline := LeaseDeadline(startTime, task.OperationTime); now.After(deadline) {
+			log.Printf("ReleaseExpiredLeases: Аренда задачи #%d истекла в %s, возвращаем задачу в очередь",
+				taskID, deadline.Format(time.RFC3339))
+			tm.releaseTask(taskID)
+			persist("ReleaseExpiredLeases", func(db database.Database) error {
+				return db.UpdateTaskLease(taskID, "", 0)
+			})
+			released++
+		}
+	}
+
+	if released > 0 {
+		tm.updateReadyTasksList()
+	}
+	return released
+}
+
+// StartLeaseReaper периодически освобождает задачи с истекшей арендой,
+// например если агент аварийно завершился во время вычисления. Работает до отмены ctx.
+func (tm *TaskManager) StartLeaseReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Запущена проверка аренды задач с интервалом %v", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Проверка аренды задач остановлена")
+			return
+		case now := <-ticker.C:
+			if released := tm.ReleaseExpiredLeases(now); released > 0 {
+				log.Printf("Возвращено в очередь задач с истекшей арендой: %d", released)
+			}
+		}
+	}
+}
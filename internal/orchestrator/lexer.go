@@ -0,0 +1,219 @@
+package orchestrator
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/GGmuzem/yandex-project/pkg/operations"
+)
+
+// TokenKind тип лексемы арифметического выражения
+type TokenKind int
+
+const (
+	TokenEOF      TokenKind = iota // Конец выражения
+	TokenNumber                    // Числовой литерал
+	TokenOperator                  // Оператор: + - * / // % ^
+	TokenLParen                    // Открывающая скобка
+	TokenRParen                    // Закрывающая скобка
+	TokenIdent                     // Имя функции
+	TokenComma                     // Разделитель аргументов функции: , или ;
+)
+
+// String возвращает читаемое название типа лексемы
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "конец выражения"
+	case TokenNumber:
+		return "число"
+	case TokenOperator:
+		return "оператор"
+	case TokenLParen:
+		return "("
+	case TokenRParen:
+		return ")"
+	case TokenIdent:
+		return "имя"
+	case TokenComma:
+		return ","
+	}
+	return "неизвестная лексема"
+}
+
+// Token лексема выражения с позицией в исходной строке
+type Token struct {
+	Kind  TokenKind
+	Text  string  // Текст лексемы в нормализованном виде (например, "−" превращается в "-")
+	Value float64 // Значение для числовых литералов
+	Pos   int     // Номер символа начала лексемы (с 1)
+	Len   int     // Длина лексемы в исходной строке в символах
+}
+
+// String возвращает текст лексемы для логов и сообщений об ошибках
+func (t Token) String() string {
+	if t.Kind == TokenEOF {
+		return t.Kind.String()
+	}
+	return t.Text
+}
+
+// operatorAliases сопоставляет типографские символы операторов с ASCII-вариантами из реестра pkg/operations
+var operatorAliases = map[rune]string{
+	'−': "-", // U+2212 MINUS SIGN
+	'–': "-", // U+2013 EN DASH
+	'×': "*",
+	'·': "*",
+	'÷': "/",
+}
+
+// matchOperator ищет оператор из реестра, начинающийся с позиции i, и возвращает его символ
+// и длину в исходной строке. Из нескольких подходящих выбирается самый длинный ("//", а не "/").
+func matchOperator(runes []rune, i int) (string, int, bool) {
+	for _, op := range operations.Operators() {
+		symbol := []rune(op.Symbol)
+		if i+len(symbol) <= len(runes) && string(runes[i:i+len(symbol)]) == op.Symbol {
+			return op.Symbol, len(symbol), true
+		}
+	}
+	if op, ok := operatorAliases[runes[i]]; ok {
+		return op, 1, true
+	}
+	return "", 0, false
+}
+
+// Tokenize разбивает выражение на лексемы.
+// Позиции считаются в символах (рунах), а не в байтах, начиная с 1.
+// Внутри скобок вызова функции запятая разделяет аргументы, поэтому десятичная
+// запятая там не распознается: min(1,5) - это два аргумента, min((1,5)) - один.
+// Ошибки возвращаются в виде *ParseError.
+func Tokenize(expr string) ([]Token, error) {
+	runes := []rune(expr)
+	tokens := []Token{}
+	// Для каждой открытой скобки: открывает ли она аргументы функции
+	var calls []bool
+	inCall := func() bool {
+		return len(calls) > 0 && calls[len(calls)-1]
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			calls = append(calls, len(tokens) > 0 && tokens[len(tokens)-1].Kind == TokenIdent)
+			tokens = append(tokens, Token{Kind: TokenLParen, Text: "(", Pos: i + 1, Len: 1})
+			i++
+		case r == ')':
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+			tokens = append(tokens, Token{Kind: TokenRParen, Text: ")", Pos: i + 1, Len: 1})
+			i++
+		case (r == ',' || r == ';') && inCall():
+			tokens = append(tokens, Token{Kind: TokenComma, Text: ",", Pos: i + 1, Len: 1})
+			i++
+		case isIdentStart(r):
+			start := i
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenIdent, Text: string(runes[start:i]), Pos: start + 1, Len: i - start})
+		case isDigit(r) || (r == '.' && i+1 < len(runes) && isDigit(runes[i+1])):
+			tok, next, err := lexNumber(runes, i, !inCall())
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		default:
+			op, n, ok := matchOperator(runes, i)
+			if !ok {
+				tok := Token{Text: string(r), Pos: i + 1, Len: 1}
+				return nil, newParseError(ErrKindInvalidCharacter, tok, "недопустимый символ '%c'", r)
+			}
+			tokens = append(tokens, Token{Kind: TokenOperator, Text: op, Pos: i + 1, Len: n})
+			i += n
+		}
+	}
+
+	tokens = append(tokens, Token{Kind: TokenEOF, Pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// lexNumber читает числовой литерал, начиная с позиции start.
+// Поддерживаются десятичная точка, десятичная запятая (если decimalComma) и
+// экспоненциальная запись (1e-3, 2.5E+10).
+func lexNumber(runes []rune, start int, decimalComma bool) (Token, int, error) {
+	var sb strings.Builder
+	i := start
+
+	for i < len(runes) && isDigit(runes[i]) {
+		sb.WriteRune(runes[i])
+		i++
+	}
+
+	// Дробная часть: точка или десятичная запятая, за которой следует цифра
+	if i < len(runes) && (runes[i] == '.' || (decimalComma && runes[i] == ',')) && i+1 < len(runes) && isDigit(runes[i+1]) {
+		sb.WriteRune('.')
+		i++
+		for i < len(runes) && isDigit(runes[i]) {
+			sb.WriteRune(runes[i])
+			i++
+		}
+	}
+
+	// Экспонента
+	if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+		j := i + 1
+		if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+			j++
+		}
+		if j >= len(runes) || !isDigit(runes[j]) {
+			tok := Token{Text: string(runes[start:j]), Pos: start + 1, Len: j - start}
+			return Token{}, 0, newParseError(ErrKindInvalidNumber, tok, "неполная экспонента в числе '%s'", tok.Text)
+		}
+		sb.WriteRune('e')
+		sb.WriteString(string(runes[i+1 : j]))
+		i = j
+		for i < len(runes) && isDigit(runes[i]) {
+			sb.WriteRune(runes[i])
+			i++
+		}
+	}
+
+	tok := Token{Kind: TokenNumber, Text: sb.String(), Pos: start + 1, Len: i - start}
+	value, err := strconv.ParseFloat(tok.Text, 64)
+	if err != nil {
+		return Token{}, 0, newParseError(ErrKindInvalidNumber, tok, "некорректное число '%s'", string(runes[start:i]))
+	}
+	tok.Value = value
+
+	return tok, i, nil
+}
+
+// isIdentStart сообщает, может ли символ начинать имя функции или переменной
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// isIdentPart сообщает, может ли символ продолжать имя функции или переменной
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+// IsIdentifier сообщает, является ли строка допустимым именем: буква или _, затем буквы, цифры и _
+func IsIdentifier(name string) bool {
+	for i, r := range []rune(name) {
+		if !isIdentPart(r) || (i == 0 && !isIdentStart(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -9,31 +9,33 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/GGmuzem/yandex-project/internal/database"
 	"github.com/GGmuzem/yandex-project/pkg/models"
 )
 
 var exprIDCounter int64
 
-// InitTaskManager инициализирует или сбрасывает глобальный менеджер задач
+// InitTaskManager инициализирует или сбрасывает глобальный менеджер задач.
+// Если подключена БД, состояние восстанавливается из нее: незавершенные
+// выражения и их задачи возвращаются в очередь.
 func InitTaskManager() {
 	log.Println("Инициализация менеджера задач")
 	// Глобальный экземпляр уже инициализирован при определении,
 	// эта функция может использоваться для сброса или дополнительной настройки
 	Manager.mu.Lock()
 
-	// Сохраняем текущие результаты
-	results := Manager.Results
-	
 	// Сбрасываем структуры данных
 	Manager.Expressions = make(map[string]*models.Expression)
 	Manager.Tasks = make(map[int]*models.Task)
+	Manager.Results = make(map[int]float64)
 	Manager.ReadyTasks = []models.Task{}
 	Manager.ProcessingTasks = make(map[int]bool)
 	Manager.TaskToExpr = make(map[int]string)
 	Manager.TaskProcessingStartTime = make(map[int]time.Time)
-	
-	// Восстанавливаем результаты
-	Manager.Results = results
+	Manager.TaskLeases = make(map[int]string)
+	Manager.TaskAgents = make(map[int]int32)
+	Manager.draining = false
+	Manager.drainCh = nil
 
 	// Сбрасываем счетчики при необходимости
 	Manager.taskCounter = 0
@@ -42,25 +44,27 @@ func InitTaskManager() {
 	// Сбрасываем атомарный счетчик ID выражений
 	atomic.StoreInt64(&exprIDCounter, 0)
 
-	log.Printf("Менеджер задач инициализирован, сохранено %d результатов", len(Manager.Results))
-	
-	// Выводим сохраненные результаты для отладки
-	for taskID, result := range Manager.Results {
-		log.Printf("  Сохраненный результат задачи #%d: %f", taskID, result)
-	}
-	
 	Manager.mu.Unlock()
-	
-	// Создаем тестовые задачи для отладки
-	log.Println("Создание тестовых задач для отладки")
-	
-	// Создаем несколько тестовых задач
-	for i := 0; i < 3; i++ {
-		Manager.CreateTestTask()
-		time.Sleep(100 * time.Millisecond) // Небольшая пауза между созданием задач
+
+	// Готовность выставляется только после восстановления очереди из БД
+	Manager.initialized.Store(false)
+	defer Manager.initialized.Store(true)
+
+	if DB == nil {
+		log.Println("Менеджер задач инициализирован без БД, восстановление состояния пропущено")
+		return
+	}
+
+	if err := Manager.Restore(DB); err != nil {
+		log.Printf("Ошибка восстановления состояния менеджера задач из БД: %v", err)
 	}
 }
 
+// Initialized сообщает, что менеджер задач инициализирован и восстановил состояние из БД
+func (tm *TaskManager) Initialized() bool {
+	return tm.initialized.Load()
+}
+
 // GenerateUniqueExpressionID генерирует уникальный ID для выражения с использованием временной метки
 func GenerateUniqueExpressionID() string {
 	// Атомарно увеличиваем счетчик
@@ -87,7 +91,13 @@ type TaskManager struct {
 	ReadyTasks             []models.Task                 // Очередь готовых к выполнению задач
 	ProcessingTasks        map[int]bool                  // Карта задач в обработке: task_id -> true
 	TaskToExpr             map[int]string                // Связь задачи с выражением
-	TaskProcessingStartTime map[int]time.Time            // Время начала обработки задачи
+	TaskProcessingStartTime map[int]time.Time            // Время начала обработки задачи (начало аренды)
+	TaskLeases             map[int]string                // Идентификатор текущей аренды задачи
+	TaskAgents             map[int]int32                 // Агент, которому выдана задача (0, если агент не зарегистрирован)
+	readyCh                chan struct{}                 // Закрывается, когда в очереди появляются готовые задачи
+	initialized            atomic.Bool                   // InitTaskManager завершен, состояние восстановлено из БД
+	draining               bool                          // Оркестратор останавливается, новые задачи не выдаются
+	drainCh                chan struct{}                 // Закрывается при переходе в режим остановки
 	mu                     sync.Mutex
 	taskCounter            int
 	exprCounter            int
@@ -103,6 +113,8 @@ func NewTaskManager() *TaskManager {
 		Results:                make(map[int]float64),
 		ProcessingTasks:        make(map[int]bool),
 		TaskProcessingStartTime: make(map[int]time.Time),
+		TaskLeases:             make(map[int]string),
+		TaskAgents:             make(map[int]int32),
 		ReadyTasks:             []models.Task{},
 		taskCounter:            0,
 	}
@@ -156,6 +168,8 @@ var Manager = TaskManager{
 	ProcessingTasks:        make(map[int]bool),
 	TaskToExpr:             make(map[int]string),
 	TaskProcessingStartTime: make(map[int]time.Time),
+	TaskLeases:             make(map[int]string),
+	TaskAgents:             make(map[int]int32),
 }
 
 // глобальный мьютекс для синхронизации доступа к общим ресурсам
@@ -261,7 +275,7 @@ func UpdateExpressions() {
 				
 				Manager.mu.Lock()
 				for tid, task := range Manager.Tasks {
-					if task.Arg1 == resultRef || task.Arg2 == resultRef {
+					if task.UsesOperand(resultRef) {
 						isUsedAsArg = true
 						log.Printf("=== ОТЛАДКА UpdateExpressions: Задача #%d используется как аргумент в задаче #%d", taskID, tid)
 						break
@@ -322,7 +336,7 @@ func UpdateExpressions() {
 
 				// Сохраняем результат в БД
 				if DB != nil {
-					err := DB.UpdateExpressionStatus(exprID, "completed", finalResult)
+					err := DB.UpdateExpressionStatus(exprID, "completed", finalResult, "")
 					if err != nil {
 						log.Printf("UpdateExpressions: Ошибка при обновлении статуса выражения %s в БД: %v", exprID, err)
 					} else {
@@ -333,10 +347,11 @@ func UpdateExpressions() {
 			} else {
 				log.Printf("UpdateExpressions: Ошибка: не найдены результаты для выражения %s", exprID)
 				expr.Status = "error"
+				expr.Error = "не найден результат вычисления"
 
 				// Обновляем статус в БД
 				if DB != nil {
-					err := DB.UpdateExpressionStatus(exprID, "error", 0)
+					err := DB.UpdateExpressionStatus(exprID, "error", 0, expr.Error)
 					if err != nil {
 						log.Printf("UpdateExpressions: Ошибка при обновлении статуса выражения %s в БД: %v", exprID, err)
 					}
@@ -363,9 +378,18 @@ func (tm *TaskManager) AddExpression(exprID string, tasks []models.Task) {
 		log.Printf("AddExpression: Выражение %s уже существует", exprID)
 	}
 
-	for i, t := range tasks {
+	// Номера задач в выражении локальные (с 1), назначаем глобальные ID
+	// и переписываем ссылки "resultN" на результаты зависимых задач
+	globalIDs := make(map[int]int, len(tasks))
+	added := make([]models.Task, 0, len(tasks))
+	for _, t := range tasks {
 		tm.taskCounter++
-		t.ID = tm.taskCounter
+		globalIDs[t.ID] = tm.taskCounter
+	}
+
+	for i, t := range tasks {
+		t.ID = globalIDs[t.ID]
+		t.MapOperands(func(arg string) string { return remapResultRef(arg, globalIDs) })
 		// Явно устанавливаем ID выражения для каждой задачи
 		t.ExpressionID = exprID
 
@@ -379,6 +403,7 @@ func (tm *TaskManager) AddExpression(exprID string, tasks []models.Task) {
 
 		tm.TaskToExpr[t.ID] = exprID // Сохраняем связь задачи с выражением
 		log.Printf("AddExpression: Связь задачи #%d с выражением %s сохранена", t.ID, exprID)
+		added = append(added, t)
 
 		// Проверка готовности задачи и добавление в очередь
 		if isTaskReady(t) {
@@ -397,6 +422,11 @@ func (tm *TaskManager) AddExpression(exprID string, tasks []models.Task) {
 		}
 	}
 
+	// Сохраняем граф задач, чтобы восстановить его после перезапуска
+	persist("AddExpression", func(db database.Database) error {
+		return db.SaveTasks(added)
+	})
+
 	// Проверяем содержимое менеджера после добавления
 	log.Printf("AddExpression: Состояние менеджера:")
 	log.Printf("AddExpression: Всего выражений: %d", len(tm.Expressions))
@@ -411,6 +441,22 @@ func (tm *TaskManager) AddExpression(exprID string, tasks []models.Task) {
 
 	log.Printf("AddExpression: Добавлено выражение %s, всего задач: %d, в очереди готовых: %d",
 		exprID, len(tasks), len(tm.ReadyTasks))
+	tm.notifyReady()
+}
+
+// remapResultRef заменяет в ссылке "resultN" локальный номер задачи на глобальный ID
+func remapResultRef(arg string, globalIDs map[int]int) string {
+	if !isResultRef(arg) {
+		return arg
+	}
+	localID, err := strconv.Atoi(strings.TrimPrefix(arg, "result"))
+	if err != nil {
+		return arg
+	}
+	if globalID, ok := globalIDs[localID]; ok {
+		return "result" + strconv.Itoa(globalID)
+	}
+	return arg
 }
 
 // GenerateExpressionID создает новый ID для выражения
@@ -426,14 +472,29 @@ func (tm *TaskManager) GenerateExpressionID() string {
 
 // GetTask возвращает задачу для выполнения агентом
 func (tm *TaskManager) GetTask() (models.Task, bool) {
+	return tm.GetTaskForAgent(0)
+}
+
+// GetTaskForAgent возвращает задачу для выполнения и запоминает агента, которому она выдана,
+// чтобы вернуть задачу в очередь, если агент перестанет отправлять heartbeat.
+// Агенту выдаются только задачи с операциями, о поддержке которых он сообщил при регистрации.
+func (tm *TaskManager) GetTaskForAgent(agentID int32) (models.Task, bool) {
+	supported := Agents.Capabilities(agentID)
+
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	// При остановке оркестратора задачи остаются в очереди до перезапуска
+	if tm.draining {
+		log.Printf("GetTask: Оркестратор останавливается, задачи не выдаются")
+		return models.Task{}, false
+	}
+
 	log.Printf("GetTask: Проверка наличия готовых задач, всего задач: %d, готовых: %d", 
 		len(tm.Tasks), len(tm.ReadyTasks))
 
-	// Обновляем список готовых задач
-	tm.UpdateReadyTasksList()
+	// Обновляем список готовых задач (мьютекс уже захвачен)
+	tm.updateReadyTasksList()
 
 	// Проверяем, есть ли готовые задачи
 	if len(tm.ReadyTasks) == 0 {
@@ -441,124 +502,215 @@ func (tm *TaskManager) GetTask() (models.Task, bool) {
 		return models.Task{}, false
 	}
 
-	// Берем первую задачу из очереди
-	task := tm.ReadyTasks[0]
-	if len(tm.ReadyTasks) > 1 {
-		tm.ReadyTasks = tm.ReadyTasks[1:]
-	} else {
-		tm.ReadyTasks = []models.Task{}
+	// Берем первую задачу из очереди, которую умеет выполнять агент
+	index := -1
+	for i, ready := range tm.ReadyTasks {
+		if supported == nil || supported[ready.Operation] {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		log.Printf("GetTask: Нет готовых задач с операциями, которые поддерживает агент #%d", agentID)
+		return models.Task{}, false
 	}
+	task := tm.ReadyTasks[index]
+	tm.ReadyTasks = append(tm.ReadyTasks[:index:index], tm.ReadyTasks[index+1:]...)
 
-	// Отмечаем задачу как обрабатываемую и сохраняем время начала обработки
+	// Отмечаем задачу как обрабатываемую и выдаем аренду: если результат не придет
+	// до LeaseDeadline, задача вернется в очередь и будет выдана другому агенту
+	startTime := time.Now()
+	task.LeaseID = newLeaseID(task.ID)
 	tm.ProcessingTasks[task.ID] = true
-	tm.TaskProcessingStartTime[task.ID] = time.Now()
+	tm.TaskProcessingStartTime[task.ID] = startTime
+	tm.TaskLeases[task.ID] = task.LeaseID
+	if agentID != 0 {
+		tm.TaskAgents[task.ID] = agentID
+	}
+	persist("GetTask", func(db database.Database) error {
+		return db.UpdateTaskLease(task.ID, task.LeaseID, startTime.UnixMilli())
+	})
 
-	log.Printf("GetTask: Возвращаем задачу #%d для выполнения", task.ID)
+	log.Printf("GetTask: Возвращаем задачу #%d для выполнения, аренда %s до %s",
+		task.ID, task.LeaseID, LeaseDeadline(startTime, task.OperationTime).Format(time.RFC3339))
 	return task, true
 }
 
-// UpdateReadyTasksList обновляет список готовых задач
-func (tm *TaskManager) UpdateReadyTasksList() {
+// ReadySignal возвращает канал, который закроется, когда в очереди появятся готовые задачи.
+// Канал нужно получить до попытки взять задачу через GetTask, чтобы не пропустить сигнал.
+func (tm *TaskManager) ReadySignal() <-chan struct{} {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	// Очищаем список готовых задач
-	tm.ReadyTasks = []models.Task{}
-	log.Printf("UpdateReadyTasksList: Список готовых задач очищен")
+	if tm.readyCh == nil {
+		tm.readyCh = make(chan struct{})
+	}
+	return tm.readyCh
+}
 
-	// Проверяем все задачи на готовность
-	for taskID, taskPtr := range tm.Tasks {
-		// Пропускаем задачи, которые уже в обработке
-		if tm.ProcessingTasks[taskID] {
-			log.Printf("UpdateReadyTasksList: Задача #%d уже в обработке, пропускаем", taskID)
-			continue
-		}
-		
-		task := *taskPtr
-		
-		// Проверяем аргументы на зависимости от результатов
-		arg1Ready := true
-		arg2Ready := true
-		
-		// Проверяем первый аргумент
-		if strings.HasPrefix(task.Arg1, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg1, "result"))
-			if err != nil {
-				log.Printf("UpdateReadyTasksList: Ошибка при извлечении ID задачи из аргумента %s", task.Arg1)
-				arg1Ready = false
-			} else {
-				// Проверяем, есть ли результат для этой задачи
-				if result, exists := tm.Results[sourceTaskID]; exists {
-					// Заменяем ссылку на результат на фактическое значение
-					task.Arg1 = strconv.FormatFloat(result, 'f', -1, 64)
-					log.Printf("UpdateReadyTasksList: Обновление задачи #%d: arg1 изменен с %s на %s",
-						taskID, "result"+strconv.Itoa(sourceTaskID), task.Arg1)
-					// Обновляем задачу в карте
-					*taskPtr = task
-				} else {
-					log.Printf("UpdateReadyTasksList: Задача #%d не готова, поскольку результат задачи #%d еще не получен",
-						taskID, sourceTaskID)
-					arg1Ready = false
-				}
-			}
-		}
-		
-		// Проверяем второй аргумент
-		if strings.HasPrefix(task.Arg2, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-			if err != nil {
-				log.Printf("UpdateReadyTasksList: Ошибка при извлечении ID задачи из аргумента %s", task.Arg2)
-				arg2Ready = false
-			} else {
-				// Проверяем, есть ли результат для этой задачи
-				if result, exists := tm.Results[sourceTaskID]; exists {
-					// Заменяем ссылку на результат на фактическое значение
-					task.Arg2 = strconv.FormatFloat(result, 'f', -1, 64)
-					log.Printf("UpdateReadyTasksList: Обновление задачи #%d: arg2 изменен с %s на %s",
-						taskID, "result"+strconv.Itoa(sourceTaskID), task.Arg2)
-					// Обновляем задачу в карте
-					*taskPtr = task
-				} else {
-					log.Printf("UpdateReadyTasksList: Задача #%d не готова, поскольку результат задачи #%d еще не получен",
-						taskID, sourceTaskID)
-					arg2Ready = false
-				}
-			}
-		}
-		
-		// Если оба аргумента готовы, добавляем задачу в список готовых
-		if arg1Ready && arg2Ready {
-			tm.ReadyTasks = append(tm.ReadyTasks, task)
-			log.Printf("UpdateReadyTasksList: Задача #%d добавлена в очередь готовых задач", taskID)
-		}
+// notifyReady будит ожидающие потоки StreamTasks, если есть готовые задачи.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) notifyReady() {
+	if len(tm.ReadyTasks) == 0 || tm.readyCh == nil {
+		return
 	}
+	close(tm.readyCh)
+	tm.readyCh = nil
 }
 
-// AddResult добавляет результат задачи
-func (tm *TaskManager) AddResult(result models.TaskResult) bool {
+// UpdateReadyTasksList обновляет список готовых задач
+func (tm *TaskManager) UpdateReadyTasksList() {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	tm.updateReadyTasksList()
+}
+
+// AddResult добавляет результат задачи.
+// Если агент сообщил об ошибке вычисления, выражение переводится в статус error
+// с причиной ошибки, а его оставшиеся задачи отменяются.
+// Возвращает ErrTaskNotFound, если задача неизвестна (например, уже отменена),
+// и ErrStaleLease, если результат пришел не по текущей аренде задачи.
+func (tm *TaskManager) AddResult(result models.TaskResult) error {
+	tm.mu.Lock()
+
 	// Проверяем, что задача существует
 	if _, exists := tm.Tasks[result.ID]; !exists {
+		tm.mu.Unlock()
 		log.Printf("AddResult: Задача #%d не найдена", result.ID)
-		return false
+		return ErrTaskNotFound
 	}
 
-	// Сохраняем результат в памяти
-	tm.Results[result.ID] = result.Result
-	log.Printf("AddResult: Результат задачи #%d сохранен: %f", result.ID, result.Result)
+	// Принимаем результат только по действующей аренде
+	if leaseID, leased := tm.TaskLeases[result.ID]; !leased || leaseID != result.LeaseID {
+		tm.mu.Unlock()
+		log.Printf("AddResult: Результат задачи #%d отклонен: аренда %q не действует (текущая %q)",
+			result.ID, result.LeaseID, leaseID)
+		return ErrStaleLease
+	}
+
+	exprID := tm.TaskToExpr[result.ID]
+	observeTaskResult(tm.Tasks[result.ID].Operation, tm.TaskProcessingStartTime[result.ID], result.Failed())
 
 	// Удаляем задачу из списка задач в обработке
-	delete(tm.ProcessingTasks, result.ID)
-	delete(tm.TaskProcessingStartTime, result.ID)
+	tm.releaseTask(result.ID)
 	log.Printf("AddResult: Задача #%d удалена из списка задач в обработке", result.ID)
 
-	// Обновляем список готовых задач
-	tm.UpdateReadyTasksList()
-	log.Printf("AddResult: Список готовых задач обновлен, всего готовых: %d", len(tm.ReadyTasks))
+	var finished *models.Expression
+	if result.Failed() {
+		reason := taskErrorReason(result)
+		log.Printf("AddResult: Задача #%d выражения %s завершилась ошибкой: %s", result.ID, exprID, reason)
+		finished = tm.failExpression(exprID, reason)
+	} else {
+		// Сохраняем результат в памяти, выполненная задача больше не нужна
+		tm.Results[result.ID] = result.Result
+		delete(tm.Tasks, result.ID)
+		persist("AddResult", func(db database.Database) error {
+			return db.SaveResult(result.ID, result.Result, exprID)
+		})
+		log.Printf("AddResult: Результат задачи #%d сохранен: %f", result.ID, result.Result)
+
+		// Задачи строятся обходом дерева в обратном порядке, поэтому последней
+		// выполняется корневая задача и ее результат - результат выражения
+		if !tm.hasTasks(exprID) {
+			finished = tm.completeExpression(exprID, result.Result)
+		}
 
-	return true
+		tm.updateReadyTasksList()
+		log.Printf("AddResult: Список готовых задач обновлен, всего готовых: %d", len(tm.ReadyTasks))
+	}
+
+	// Копируем состояние, чтобы сохранить его в БД без удержания мьютекса
+	var snapshot models.Expression
+	if finished != nil {
+		snapshot = *finished
+	}
+	tm.mu.Unlock()
+
+	if finished != nil && DB != nil {
+		if err := DB.UpdateExpressionStatus(snapshot.ID, snapshot.Status, snapshot.Result, snapshot.Error); err != nil {
+			log.Printf("AddResult: Ошибка при обновлении статуса выражения %s в БД: %v", snapshot.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// taskErrorReason формирует причину ошибки выражения по результату задачи
+func taskErrorReason(result models.TaskResult) string {
+	switch {
+	case result.Error != "":
+		return result.Error
+	case result.ErrorCode == models.TaskErrorDivisionByZero:
+		return "деление на ноль"
+	default:
+		return "ошибка вычисления: " + result.ErrorCode
+	}
+}
+
+// hasTasks проверяет, остались ли у выражения невыполненные задачи.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) hasTasks(exprID string) bool {
+	for taskID := range tm.Tasks {
+		if tm.TaskToExpr[taskID] == exprID {
+			return true
+		}
+	}
+	return false
+}
+
+// completeExpression переводит выражение в статус completed.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) completeExpression(exprID string, value float64) *models.Expression {
+	expr, exists := tm.Expressions[exprID]
+	if !exists {
+		log.Printf("completeExpression: Выражение %s не найдено", exprID)
+		return nil
+	}
+
+	expr.Status = "completed"
+	expr.Result = value
+	log.Printf("completeExpression: Выражение %s вычислено, результат: %f", exprID, value)
+	return expr
+}
+
+// failExpression переводит выражение в статус error и отменяет его оставшиеся задачи.
+// Вызывается с захваченным мьютексом.
+func (tm *TaskManager) failExpression(exprID string, reason string) *models.Expression {
+	cancelled := 0
+	for taskID, id := range tm.TaskToExpr {
+		if id != exprID {
+			continue
+		}
+		if _, exists := tm.Tasks[taskID]; exists {
+			delete(tm.Tasks, taskID)
+			cancelled++
+		}
+		tm.releaseTask(taskID)
+	}
+
+	readyTasks := tm.ReadyTasks[:0]
+	for _, task := range tm.ReadyTasks {
+		if tm.TaskToExpr[task.ID] != exprID {
+			readyTasks = append(readyTasks, task)
+		}
+	}
+	tm.ReadyTasks = readyTasks
+	persist("failExpression", func(db database.Database) error {
+		return db.CancelTasks(exprID)
+	})
+	log.Printf("failExpression: Для выражения %s отменено задач: %d", exprID, cancelled)
+
+	expr, exists := tm.Expressions[exprID]
+	if !exists {
+		log.Printf("failExpression: Выражение %s не найдено", exprID)
+		return nil
+	}
+
+	expr.Status = "error"
+	expr.Error = reason
+	expr.Result = 0
+	return expr
 }
 
 // GetExpression возвращает выражение по его ID
@@ -602,68 +754,27 @@ func isResultRef(arg string) bool {
 func isTaskReady(task models.Task) bool {
 	log.Printf("IsTaskReady: Проверка готовности задачи #%d: %s %s %s", task.ID, task.Arg1, task.Operation, task.Arg2)
 	
-	// Проверяем первый аргумент
-	if strings.HasPrefix(task.Arg1, "result") {
-		id, err := strconv.Atoi(strings.TrimPrefix(task.Arg1, "result"))
-		if err != nil {
-			log.Printf("IsTaskReady: неверный ID результата в Arg1 задачи #%d: %v", task.ID, err)
-			return false
-		}
-		if _, exists := Manager.Results[id]; !exists {
-			log.Printf("IsTaskReady: результат задачи #%d не найден для Arg1 задачи #%d", id, task.ID)
-			return false
-		} else {
-			log.Printf("IsTaskReady: результат задачи #%d найден для Arg1 задачи #%d: %f", id, task.ID, Manager.Results[id])
-		}
-	} else {
-		if _, err := strconv.ParseFloat(task.Arg1, 64); err != nil {
-			log.Printf("IsTaskReady: Arg1 задачи #%d не является числом: %s", task.ID, task.Arg1)
-			return false
-		}
-	}
-	
-	// Проверяем второй аргумент
-	if strings.HasPrefix(task.Arg2, "result") {
-		id, err := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-		if err != nil {
-			log.Printf("IsTaskReady: неверный ID результата в Arg2 задачи #%d: %v", task.ID, err)
-			return false
-		}
-		if _, exists := Manager.Results[id]; !exists {
-			log.Printf("IsTaskReady: результат задачи #%d не найден для Arg2 задачи #%d", id, task.ID)
-			return false
-		} else {
-			log.Printf("IsTaskReady: результат задачи #%d найден для Arg2 задачи #%d: %f", id, task.ID, Manager.Results[id])
-		}
-	} else {
-		if _, err := strconv.ParseFloat(task.Arg2, 64); err != nil {
-			log.Printf("IsTaskReady: Arg2 задачи #%d не является числом: %s", task.ID, task.Arg2)
-			return false
-		}
-	}
-	
-	// Проверка деления на ноль
-	if task.Operation == "/" {
-		var val2 float64
-		var err error
-		
-		if strings.HasPrefix(task.Arg2, "result") {
-			id, _ := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-			val2 = Manager.Results[id]
-		} else {
-			val2, err = strconv.ParseFloat(task.Arg2, 64)
+	// Каждый аргумент - число или ссылка на уже полученный результат
+	for i, arg := range task.Operands() {
+		if strings.HasPrefix(arg, "result") {
+			id, err := strconv.Atoi(strings.TrimPrefix(arg, "result"))
 			if err != nil {
-				log.Printf("IsTaskReady: ошибка при преобразовании Arg2 в число: %v", err)
+				log.Printf("IsTaskReady: неверный ID результата в аргументе %d задачи #%d: %v", i+1, task.ID, err)
 				return false
 			}
-		}
-		
-		if val2 == 0 {
-			log.Printf("IsTaskReady: ошибка - деление на ноль в задаче #%d", task.ID)
+			if _, exists := Manager.Results[id]; !exists {
+				log.Printf("IsTaskReady: результат задачи #%d не найден для аргумента %d задачи #%d", id, i+1, task.ID)
+				return false
+			}
+			log.Printf("IsTaskReady: результат задачи #%d найден для аргумента %d задачи #%d: %f", id, i+1, task.ID, Manager.Results[id])
+		} else if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			log.Printf("IsTaskReady: аргумент %d задачи #%d не является числом: %s", i+1, task.ID, arg)
 			return false
 		}
 	}
-	
+
+	// Деление на ноль не проверяем: агент вернет ошибку, и выражение получит статус error
+
 	log.Printf("IsTaskReady: задача #%d готова к выполнению", task.ID)
 	return true
 }
@@ -680,15 +791,7 @@ func (tm *TaskManager) ContainsTask(exprID string, taskID int) bool {
 
 // updateReadyTasksList обновляет список готовых задач
 func (tm *TaskManager) updateReadyTasksList() {
-	// Проверяем задачи, которые долго находятся в обработке
-	now := time.Now()
-	for taskID, startTime := range tm.TaskProcessingStartTime {
-		if now.Sub(startTime) > 5*time.Minute {
-			log.Printf("updateReadyTasksList: Задача #%d находится в обработке более 5 минут, освобождаем", taskID)
-			delete(tm.ProcessingTasks, taskID)
-			delete(tm.TaskProcessingStartTime, taskID)
-		}
-	}
+	// Задачи с истекшей арендой возвращает в очередь ReleaseExpiredLeases
 
 	// Создаем новый список готовых задач
 	readyTasks := []models.Task{}
@@ -703,40 +806,31 @@ func (tm *TaskManager) updateReadyTasksList() {
 		
 		task := *taskPtr
 		
-		// Проверяем аргументы на зависимости от результатов
-		arg1Updated := false
-		arg2Updated := false
-		
-		if strings.HasPrefix(task.Arg1, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg1, "result"))
-			if err == nil {
-				if result, exists := tm.Results[sourceTaskID]; exists {
-					// Заменяем ссылку на результат на фактическое значение
-					task.Arg1 = strconv.FormatFloat(result, 'f', -1, 64)
-					log.Printf("updateReadyTasksList: Обновление задачи #%d: arg1 изменен с %s на %s",
-						taskID, "result"+strconv.Itoa(sourceTaskID), task.Arg1)
-					arg1Updated = true
-				}
+		// Заменяем ссылки на полученные результаты фактическими значениями
+		updated := false
+		task.MapOperands(func(arg string) string {
+			if !strings.HasPrefix(arg, "result") {
+				return arg
 			}
-		}
-		if strings.HasPrefix(task.Arg2, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-			if err == nil {
-				if result, exists := tm.Results[sourceTaskID]; exists {
-					// Заменяем ссылку на результат на фактическое значение
-					task.Arg2 = strconv.FormatFloat(result, 'f', -1, 64)
-					log.Printf("updateReadyTasksList: Обновление задачи #%d: arg2 изменен с %s на %s",
-						taskID, "result"+strconv.Itoa(sourceTaskID), task.Arg2)
-					arg2Updated = true
-				}
+			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(arg, "result"))
+			if err != nil {
+				return arg
 			}
-		}
-		
+			result, exists := tm.Results[sourceTaskID]
+			if !exists {
+				return arg
+			}
+			value := strconv.FormatFloat(result, 'f', -1, 64)
+			log.Printf("updateReadyTasksList: Обновление задачи #%d: аргумент изменен с %s на %s", taskID, arg, value)
+			updated = true
+			return value
+		})
+
 		// Если аргументы были обновлены, обновляем задачу в карте
-		if arg1Updated || arg2Updated {
+		if updated {
 			*taskPtr = task
 		}
-		
+
 		// Проверяем готовность задачи
 		if IsTaskReady(task) {
 			log.Printf("updateReadyTasksList: Задача #%d готова к выполнению, добавляем в очередь", taskID)
@@ -746,8 +840,20 @@ func (tm *TaskManager) updateReadyTasksList() {
 		}
 	}
 	
-	// Обновляем список готовых задач
+	// Обновляем список готовых задач. Потоки будим, только если в очереди появились
+	// новые задачи: иначе агент, которому не подходит ни одна задача в очереди,
+	// просыпался бы от собственного запроса
+	queued := make(map[int]bool, len(tm.ReadyTasks))
+	for _, task := range tm.ReadyTasks {
+		queued[task.ID] = true
+	}
 	tm.ReadyTasks = readyTasks
+	for _, task := range readyTasks {
+		if !queued[task.ID] {
+			tm.notifyReady()
+			break
+		}
+	}
 	
 	log.Printf("updateReadyTasksList: Обновлено готовых задач: %d", len(tm.ReadyTasks))
 
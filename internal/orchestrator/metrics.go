@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Метрики оркестратора, которые отдаются на /metrics
+var (
+	taskDuration = metrics.NewHistogramVec("calculator_task_duration_seconds",
+		"Время от выдачи задачи агенту до получения результата", metrics.DurationBuckets, "operation")
+	taskResults = metrics.NewCounterVec("calculator_task_results_total",
+		"Принятые результаты задач по операциям и исходу (ok или error)", "operation", "outcome")
+	grpcRequests = metrics.NewCounterVec("calculator_grpc_requests_total",
+		"Вызовы gRPC методов оркестратора по коду ответа", "method", "code")
+	grpcErrors = metrics.NewCounterVec("calculator_grpc_errors_total",
+		"Вызовы gRPC методов оркестратора, завершившиеся ошибкой", "method")
+)
+
+func init() {
+	metrics.NewGaugeFunc("calculator_ready_tasks", "Задачи в очереди готовых к выполнению", func() float64 {
+		Manager.mu.Lock()
+		defer Manager.mu.Unlock()
+		return float64(len(Manager.ReadyTasks))
+	})
+	metrics.NewGaugeFunc("calculator_inflight_tasks", "Задачи, выданные агентам и ожидающие результата", func() float64 {
+		Manager.mu.Lock()
+		defer Manager.mu.Unlock()
+		return float64(len(Manager.ProcessingTasks))
+	})
+	metrics.NewGaugeVecFunc("calculator_expressions", "Выражения в памяти оркестратора по статусам", "status", func() map[string]float64 {
+		Manager.mu.Lock()
+		defer Manager.mu.Unlock()
+		byStatus := map[string]float64{"pending": 0, "completed": 0, "error": 0}
+		for _, expr := range Manager.Expressions {
+			byStatus[expr.Status]++
+		}
+		return byStatus
+	})
+	metrics.NewGaugeVecFunc("calculator_agents", "Зарегистрированные агенты по статусам", "status", func() map[string]float64 {
+		Agents.mu.Lock()
+		defer Agents.mu.Unlock()
+		byStatus := map[string]float64{}
+		for _, agent := range Agents.agents {
+			byStatus[agent.Status]++
+		}
+		return byStatus
+	})
+}
+
+// observeTaskResult учитывает принятый результат задачи в метриках.
+// start - начало аренды, по которой агент выполнял задачу.
+func observeTaskResult(operation string, start time.Time, failed bool) {
+	outcome := "ok"
+	if failed {
+		outcome = "error"
+	}
+	taskResults.Inc(operation, outcome)
+	if !start.IsZero() {
+		taskDuration.Observe(time.Since(start).Seconds(), operation)
+	}
+}
+
+// observeGRPC учитывает вызов gRPC метода fullMethod в метриках
+func observeGRPC(fullMethod string, err error) {
+	method := path.Base(fullMethod)
+	code := status.Code(err)
+	grpcRequests.Inc(method, code.String())
+	if err != nil {
+		grpcErrors.Inc(method)
+	}
+}
+
+// metricsUnaryInterceptor считает вызовы и ошибки unary методов
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	observeGRPC(info.FullMethod, err)
+	return resp, err
+}
+
+// metricsStreamInterceptor считает завершенные потоки и их ошибки
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	observeGRPC(info.FullMethod, err)
+	return err
+}
+
+// MetricsServerOptions возвращает опции gRPC сервера, собирающие метрики вызовов
+func MetricsServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(metricsUnaryInterceptor),
+		grpc.ChainStreamInterceptor(metricsStreamInterceptor),
+	}
+}
@@ -0,0 +1,49 @@
+package orchestrator
+
+import "fmt"
+
+// ParseErrorKind вид ошибки разбора выражения
+type ParseErrorKind string
+
+const (
+	ErrKindEmptyExpression       ParseErrorKind = "empty_expression"       // Пустое выражение
+	ErrKindInvalidCharacter      ParseErrorKind = "invalid_character"      // Недопустимый символ
+	ErrKindInvalidNumber         ParseErrorKind = "invalid_number"         // Некорректный числовой литерал
+	ErrKindUnexpectedToken       ParseErrorKind = "unexpected_token"       // Лексема не на своем месте
+	ErrKindUnexpectedEnd         ParseErrorKind = "unexpected_end"         // Выражение оборвалось
+	ErrKindUnbalancedParenthesis ParseErrorKind = "unbalanced_parenthesis" // Непарная скобка
+	ErrKindUnknownIdentifier     ParseErrorKind = "unknown_identifier"     // Имя, которое не является ни функцией, ни переданной переменной
+	ErrKindUnknownFunction       ParseErrorKind = "unknown_function"       // Вызов неизвестной функции
+	ErrKindArgumentCount         ParseErrorKind = "argument_count"         // Неверное число аргументов функции
+	ErrKindInvalidVariable       ParseErrorKind = "invalid_variable"       // Недопустимое имя переданной переменной
+)
+
+// ParseError ошибка разбора выражения с указанием места в исходной строке.
+// Position и Length считаются в символах, Position начинается с 1.
+// У ошибок в переданных переменных места в выражении нет, Position равна 0.
+type ParseError struct {
+	Kind     ParseErrorKind `json:"kind"`
+	Message  string         `json:"message"`
+	Token    string         `json:"token,omitempty"`
+	Position int            `json:"position"`
+	Length   int            `json:"length"`
+}
+
+// Error реализует интерфейс error
+func (e *ParseError) Error() string {
+	if e.Position == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (позиция %d)", e.Message, e.Position)
+}
+
+// newParseError создает ошибку, указывающую на лексему tok
+func newParseError(kind ParseErrorKind, tok Token, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+		Token:    tok.Text,
+		Position: tok.Pos,
+		Length:   tok.Len,
+	}
+}
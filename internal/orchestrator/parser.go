@@ -3,270 +3,339 @@ package orchestrator
 import (
 	"fmt"
 	"log"
-	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/GGmuzem/yandex-project/pkg/operations"
 )
 
-// ParseExpression разбирает строку с арифметическим выражением и создает список задач
-func ParseExpression(expr string) []models.Task {
-	// Подробное логирование входного выражения
+// bindingUnary сила связывания унарных - и + для парсера Пратта. Сила бинарных операторов
+// берется из приоритета в реестре pkg/operations: унарный минус связывает сильнее
+// мультипликативных операторов, но слабее степени: -2^2 = -(2^2).
+const bindingUnary = 30
+
+// ParseExpression разбирает строку с арифметическим выражением и создает список задач.
+// При синтаксической ошибке возвращается *ParseError.
+func ParseExpression(expr string) ([]models.Task, error) {
 	log.Printf("Начало парсинга выражения: '%s'", expr)
 
-	// Предварительная обработка выражения
-	expr = strings.ReplaceAll(expr, "(", " ( ")
-	expr = strings.ReplaceAll(expr, ")", " ) ")
-	expr = strings.ReplaceAll(expr, "+", " + ")
-	expr = strings.ReplaceAll(expr, "-", " - ")
-	expr = strings.ReplaceAll(expr, "*", " * ")
-	expr = strings.ReplaceAll(expr, "/", " / ")
+	root, err := Parse(expr)
+	if err != nil {
+		log.Printf("Ошибка парсинга выражения '%s': %v", expr, err)
+		return nil, err
+	}
 
-	// Логируем обработанное выражение
-	log.Printf("После форматирования: '%s'", expr)
+	tasks := BuildTasks(root)
+	log.Printf("Создано %d задач для выражения", len(tasks))
+	return tasks, nil
+}
 
-	tokens := strings.Fields(expr)
+// Parse строит синтаксическое дерево выражения.
+// При синтаксической ошибке возвращается *ParseError.
+func Parse(expr string) (Node, error) {
+	return ParseWithVariables(expr, nil)
+}
+
+// ParseWithVariables строит синтаксическое дерево выражения, в котором имена
+// из variables заменяются переданными значениями. Имя, которого нет ни среди переменных,
+// ни среди функций, дает ошибку unknown_identifier.
+// При синтаксической ошибке возвращается *ParseError.
+func ParseWithVariables(expr string, variables map[string]float64) (Node, error) {
+	if err := ValidateVariables(variables); err != nil {
+		return nil, err
+	}
+
+	tokens, err := Tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
 	log.Printf("Токены: %v", tokens)
 
-	output := []string{}    // Выходная очередь (постфиксная запись)
-	operators := []string{} // Стек операторов
-
-	// Алгоритм сортировочной станции (Shunting yard)
-	for i, token := range tokens {
-		log.Printf("Обработка токена %d: '%s'", i, token)
-		if token == "(" {
-			log.Printf("Добавление '(' в стек операторов")
-			operators = append(operators, token)
-		} else if token == ")" {
-			log.Printf("Найдена закрывающая скобка, извлекаем операторы до открывающей скобки")
-			for len(operators) > 0 && operators[len(operators)-1] != "(" {
-				popped := operators[len(operators)-1]
-				output = append(output, popped)
-				operators = operators[:len(operators)-1]
-				log.Printf("  Извлекаем оператор '%s' в выходную очередь", popped)
-			}
-			if len(operators) > 0 && operators[len(operators)-1] == "(" {
-				log.Printf("  Удаляем открывающую скобку из стека")
-				operators = operators[:len(operators)-1] // Удаляем левую скобку
-			} else {
-				log.Printf("  ВНИМАНИЕ: Не найдена соответствующая открывающая скобка")
-			}
-		} else if isOperator(token) {
-			log.Printf("Найден оператор '%s'", token)
-			for len(operators) > 0 && precedence(operators[len(operators)-1]) >= precedence(token) {
-				popped := operators[len(operators)-1]
-				output = append(output, popped)
-				operators = operators[:len(operators)-1]
-				log.Printf("  Извлекаем оператор '%s' с более высоким приоритетом", popped)
-			}
-			log.Printf("  Добавляем оператор '%s' в стек", token)
-			operators = append(operators, token)
-		} else {
-			// Числа добавляем прямо в выходную очередь
-			log.Printf("Добавление числа '%s' в выходную очередь", token)
-			output = append(output, token)
-		}
-		log.Printf("Текущее состояние: стек операторов=%v, выходная очередь=%v", operators, output)
+	if tokens[0].Kind == TokenEOF {
+		return nil, newParseError(ErrKindEmptyExpression, tokens[0], "пустое выражение")
 	}
 
-	// Перемещаем оставшиеся операторы в выходную очередь
-	log.Printf("Извлечение оставшихся операторов из стека")
-	for len(operators) > 0 {
-		popped := operators[len(operators)-1]
-		output = append(output, popped)
-		operators = operators[:len(operators)-1]
-		log.Printf("  Извлекаем оператор '%s' в выходную очередь", popped)
+	p := &parser{tokens: tokens, variables: variables}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("Итоговая постфиксная запись: %v", output)
+	if tok := p.peek(); tok.Kind != TokenEOF {
+		if tok.Kind == TokenRParen {
+			return nil, newParseError(ErrKindUnbalancedParenthesis, tok, "лишняя закрывающая скобка")
+		}
+		return nil, newParseError(ErrKindUnexpectedToken, tok, "неожиданная лексема '%s'", tok.Text)
+	}
 
-	// Преобразуем постфиксную запись в список задач
-	tasks := createTasksFromPostfix(output)
-	log.Printf("Создано %d задач для выражения", len(tasks))
-	return tasks
+	return root, nil
 }
 
-// createTasksFromPostfix создает задачи из массива токенов в постфиксной записи
-func createTasksFromPostfix(tokens []string) []models.Task {
-	log.Printf("Начало создания задач из постфиксной записи. Токены: %v", tokens)
-
-	// Стек для результатов операций
-	stack := []string{}
-	var tasks []models.Task
+// ValidateVariables проверяет имена переменных: каждое должно быть допустимым именем
+// и не совпадать с именем встроенной функции. Ошибка возвращается как *ParseError
+// с видом invalid_variable.
+func ValidateVariables(variables map[string]float64) error {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	log.Printf("Инициализирован пустой стек и список задач")
+	for _, name := range names {
+		if !IsIdentifier(name) {
+			return &ParseError{Kind: ErrKindInvalidVariable, Token: name,
+				Message: fmt.Sprintf("недопустимое имя переменной '%s': ожидается буква или _, затем буквы, цифры и _", name)}
+		}
+		if _, ok := operations.Lookup(name); ok {
+			return &ParseError{Kind: ErrKindInvalidVariable, Token: name,
+				Message: fmt.Sprintf("имя переменной '%s' совпадает с именем функции", name)}
+		}
+	}
+	return nil
+}
 
-	for i, token := range tokens {
-		log.Printf("Обработка токена %d: '%s'", i, token)
+// parser рекурсивный нисходящий парсер (Пратт) над списком лексем
+type parser struct {
+	tokens    []Token
+	pos       int
+	variables map[string]float64
+}
 
-		if isOperator(token) {
-			log.Printf("Токен '%s' - это оператор", token)
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
 
-			if len(stack) < 2 {
-				log.Printf("ОШИБКА: Недостаточно операндов для операции %s. Текущий стек: %v", token, stack)
-				continue
-			}
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
 
-			// Получаем два последних операнда со стека
-			operand2 := stack[len(stack)-1]
-			operand1 := stack[len(stack)-2]
-			stack = stack[:len(stack)-2] // Удаляем операнды
+// parseExpr разбирает выражение, в котором операторы связывают сильнее minBinding
+func (p *parser) parseExpr(minBinding int) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
 
-			log.Printf("Получены операнды: arg1='%s', arg2='%s'", operand1, operand2)
+	for {
+		tok := p.peek()
+		if tok.Kind != TokenOperator {
+			break
+		}
 
-			// Создаем новую задачу
-			taskID := len(tasks) + 1 // ID задачи (начиная с 1)
-			resultID := fmt.Sprintf("result%d", taskID)
+		leftBinding, rightBinding := infixBinding(tok.Text)
+		if leftBinding <= minBinding {
+			break
+		}
+		p.next()
 
-			log.Printf("Создание задачи #%d: %s %s %s -> %s",
-				taskID, operand1, token, operand2, resultID)
+		right, err := p.parseExpr(rightBinding)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: tok.Text, Left: left, Right: right, Pos: tok.Pos}
+	}
 
-			task := models.Task{
-				ID:            taskID,
-				Arg1:          operand1,
-				Arg2:          operand2,
-				Operation:     token,
-				OperationTime: getOperationTime(token),
-			}
+	return left, nil
+}
 
-			// Дополнительная проверка и преобразование аргументов задачи
-			// Попытаемся преобразовать операнды в числа, если они не ссылки на другие результаты
-			if !strings.HasPrefix(operand1, "result") {
-				_, err := strconv.ParseFloat(operand1, 64)
-				if err != nil {
-					log.Printf("ПРЕДУПРЕЖДЕНИЕ: Операнд '%s' не является ни числом, ни ссылкой на результат", operand1)
-				}
-			}
-			if !strings.HasPrefix(operand2, "result") {
-				_, err := strconv.ParseFloat(operand2, 64)
-				if err != nil {
-					log.Printf("ПРЕДУПРЕЖДЕНИЕ: Операнд '%s' не является ни числом, ни ссылкой на результат", operand2)
-				}
+// parsePrefix разбирает операнд: число, выражение в скобках или унарную операцию
+func (p *parser) parsePrefix() (Node, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case TokenNumber:
+		return &NumberNode{Value: tok.Value, Pos: tok.Pos}, nil
+	case TokenLParen:
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing.Kind == TokenEOF {
+			return nil, newParseError(ErrKindUnbalancedParenthesis, tok, "не закрыта скобка")
+		}
+		if closing.Kind != TokenRParen {
+			return nil, newParseError(ErrKindUnexpectedToken, closing, "ожидалась ')', получено '%s'", closing.Text)
+		}
+		p.next()
+		return inner, nil
+	case TokenOperator:
+		if tok.Text == "-" || tok.Text == "+" {
+			operand, err := p.parseExpr(bindingUnary)
+			if err != nil {
+				return nil, err
 			}
-
-			tasks = append(tasks, task)
-			log.Printf("Задача #%d добавлена в список задач", taskID)
-
-			// Результат этой операции становится доступным для последующих операций
-			stack = append(stack, resultID)
-			log.Printf("Результат '%s' добавлен на стек. Текущий стек: %v", resultID, stack)
-		} else {
-			// Если число - просто добавляем на стек
-			stack = append(stack, token)
-			log.Printf("Число '%s' добавлено на стек. Текущий стек: %v", token, stack)
+			return &UnaryNode{Op: tok.Text, Operand: operand, Pos: tok.Pos}, nil
 		}
+	case TokenIdent:
+		return p.parseIdent(tok)
+	case TokenEOF:
+		return nil, newParseError(ErrKindUnexpectedEnd, tok, "неожиданный конец выражения, ожидался операнд")
+	case TokenRParen:
+		return nil, newParseError(ErrKindUnexpectedToken, tok, "ожидался операнд перед ')'")
 	}
+	return nil, newParseError(ErrKindUnexpectedToken, tok, "неожиданная лексема '%s', ожидался операнд", tok.Text)
+}
 
-	// Проверяем, что в стеке остался только один элемент
-	if len(stack) != 1 {
-		log.Printf("ПРЕДУПРЕЖДЕНИЕ: После обработки всех токенов в стеке осталось %d элементов: %v", len(stack), stack)
-	} else {
-		log.Printf("Успешное завершение. В стеке остался один элемент: %s", stack[0])
+// parseIdent разбирает имя: вызов функции, если за ним следует '(', иначе переменную
+func (p *parser) parseIdent(name Token) (Node, error) {
+	if p.peek().Kind == TokenLParen {
+		return p.parseCall(name)
+	}
+	if value, ok := p.variables[name.Text]; ok {
+		return &VariableNode{Name: name.Text, Value: value, Pos: name.Pos}, nil
+	}
+	if f, known := operations.Lookup(name.Text); known && f.Kind == operations.Function {
+		return nil, newParseError(ErrKindUnexpectedToken, p.peek(), "ожидалась '(' после имени функции %s", name.Text)
+	}
+	return nil, newParseError(ErrKindUnknownIdentifier, name, "неизвестное имя '%s': значение переменной не передано", name.Text)
+}
+
+// parseCall разбирает вызов функции name(arg1, arg2, ...) и проверяет число аргументов
+func (p *parser) parseCall(name Token) (Node, error) {
+	f, known := operations.Lookup(name.Text)
+	if !known || f.Kind != operations.Function {
+		return nil, newParseError(ErrKindUnknownFunction, name, "неизвестная функция '%s'", name.Text)
 	}
+	open := p.next()
 
-	// Проверяем зависимости задач
-	log.Printf("Проверка зависимостей между задачами:")
-	dependencyMap := make(map[string][]int) // Карта зависимостей: ключ - resultX, значение - список ID задач
-
-	for i, task := range tasks {
-		taskID := i + 1
-		log.Printf("Задача #%d (%s %s %s):", taskID, task.Arg1, task.Operation, task.Arg2)
-
-		// Проверяем зависимость по Arg1
-		if strings.HasPrefix(task.Arg1, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg1, "result"))
-			if err == nil {
-				log.Printf("  - зависит от результата задачи #%d по аргументу 1", sourceTaskID)
-				dependencyMap[task.Arg1] = append(dependencyMap[task.Arg1], taskID)
-			} else {
-				log.Printf("  - ОШИБКА при разборе ID задачи из %s", task.Arg1)
+	call := &CallNode{Name: name.Text, Pos: name.Pos}
+	if p.peek().Kind == TokenRParen {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			log.Printf("  - аргумент 1 (%s) не зависит от других задач", task.Arg1)
-		}
+			call.Args = append(call.Args, arg)
 
-		// Проверяем зависимость по Arg2
-		if strings.HasPrefix(task.Arg2, "result") {
-			sourceTaskID, err := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-			if err == nil {
-				log.Printf("  - зависит от результата задачи #%d по аргументу 2", sourceTaskID)
-				dependencyMap[task.Arg2] = append(dependencyMap[task.Arg2], taskID)
-			} else {
-				log.Printf("  - ОШИБКА при разборе ID задачи из %s", task.Arg2)
+			tok := p.next()
+			if tok.Kind == TokenRParen {
+				break
+			}
+			if tok.Kind == TokenEOF {
+				return nil, newParseError(ErrKindUnbalancedParenthesis, open, "не закрыта скобка")
+			}
+			if tok.Kind != TokenComma {
+				return nil, newParseError(ErrKindUnexpectedToken, tok, "ожидалась ',' или ')', получено '%s'", tok.Text)
 			}
-		} else {
-			log.Printf("  - аргумент 2 (%s) не зависит от других задач", task.Arg2)
 		}
 	}
 
-	// Логируем зависимости
-	for resultID, dependentTasks := range dependencyMap {
-		taskIDs := make([]string, len(dependentTasks))
-		for i, id := range dependentTasks {
-			taskIDs[i] = strconv.Itoa(id)
-		}
-		log.Printf("Результат %s нужен для задач: %s", resultID, strings.Join(taskIDs, ", "))
+	if !f.Accepts(len(call.Args)) {
+		return nil, newParseError(ErrKindArgumentCount, name, "функция %s принимает аргументов: %s, передано %d",
+			name.Text, f.Arity(), len(call.Args))
 	}
+	return call, nil
+}
 
-	// Проверка на циклические зависимости
-	for i, task := range tasks {
-		taskID := i + 1
-		log.Printf("Проверка циклических зависимостей для задачи #%d...", taskID)
-
-		// Если оба аргумента - результаты других задач
-		if strings.HasPrefix(task.Arg1, "result") && strings.HasPrefix(task.Arg2, "result") {
-			sourceTaskID1, err1 := strconv.Atoi(strings.TrimPrefix(task.Arg1, "result"))
-			sourceTaskID2, err2 := strconv.Atoi(strings.TrimPrefix(task.Arg2, "result"))
-
-			if err1 == nil && err2 == nil {
-				log.Printf("  Задача #%d зависит от результатов задач #%d и #%d", taskID, sourceTaskID1, sourceTaskID2)
-				// Проверяем, что эти задачи существуют и имеют правильные ID
-				if sourceTaskID1 > len(tasks) || sourceTaskID2 > len(tasks) {
-					log.Printf("  ПРЕДУПРЕЖДЕНИЕ: Задача #%d ссылается на несуществующие задачи!", taskID)
-				}
-			}
-		}
+// infixBinding возвращает левую и правую силу связывания бинарного оператора.
+// Для левоассоциативных операторов правая сила больше левой, для правоассоциативных - меньше.
+func infixBinding(op string) (int, int) {
+	o, ok := operations.Lookup(op)
+	if !ok || o.Kind != operations.Binary {
+		return 0, 0
 	}
-
-	log.Printf("Итоговые задачи: %+v", tasks)
-	return tasks
+	if o.Associativity == operations.Right {
+		return o.Precedence, o.Precedence - 1
+	}
+	return o.Precedence, o.Precedence + 1
 }
 
-func isOperator(token string) bool {
-	return token == "+" || token == "-" || token == "*" || token == "/"
+// operand аргумент задачи: либо константа, либо ссылка на результат другой задачи
+type operand struct {
+	ref     string
+	value   float64
+	isConst bool
 }
 
-func precedence(op string) int {
-	if op == "(" || op == ")" {
-		return 0
+func (o operand) String() string {
+	if o.isConst {
+		return strconv.FormatFloat(o.value, 'f', -1, 64)
 	}
-	if op == "+" || op == "-" {
-		return 1
+	return o.ref
+}
+
+// BuildTasks обходит дерево в обратном порядке и создает задачи.
+// Ссылки на результаты задач имеют вид "resultN", где N - номер задачи в списке (с 1).
+func BuildTasks(root Node) []models.Task {
+	b := &taskBuilder{}
+	b.emit(root)
+	return b.tasks
+}
+
+type taskBuilder struct {
+	tasks []models.Task
+}
+
+func (b *taskBuilder) emit(node Node) operand {
+	switch n := node.(type) {
+	case *NumberNode:
+		return operand{value: n.Value, isConst: true}
+	case *VariableNode:
+		return operand{value: n.Value, isConst: true}
+	case *UnaryNode:
+		inner := b.emit(n.Operand)
+		if n.Op == "+" {
+			return inner
+		}
+		// Отрицание константы сворачиваем сразу, для подвыражения создаем задачу 0 - x
+		if inner.isConst {
+			return operand{value: -inner.value, isConst: true}
+		}
+		return b.addTask(operand{value: 0, isConst: true}, "-", inner)
+	case *BinaryNode:
+		left := b.emit(n.Left)
+		right := b.emit(n.Right)
+		return b.addTask(left, n.Op, right)
+	case *CallNode:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = b.emit(arg).String()
+		}
+		return b.addCall(n.Name, args)
 	}
-	if op == "*" || op == "/" {
-		return 2
+	return operand{}
+}
+
+func (b *taskBuilder) addTask(arg1 operand, op string, arg2 operand) operand {
+	taskID := len(b.tasks) + 1
+	task := models.Task{
+		ID:            taskID,
+		Arg1:          arg1.String(),
+		Arg2:          arg2.String(),
+		Operation:     op,
+		OperationTime: getOperationTime(op),
 	}
-	return 0
+	b.tasks = append(b.tasks, task)
+	log.Printf("Создание задачи #%d: %s %s %s -> result%d", taskID, task.Arg1, op, task.Arg2, taskID)
+	return operand{ref: fmt.Sprintf("result%d", taskID)}
 }
 
-func getOperationTime(op string) int {
-	switch op {
-	case "+":
-		return getEnvInt("TIME_ADDITION_MS", 100)
-	case "-":
-		return getEnvInt("TIME_SUBTRACTION_MS", 100)
-	case "*":
-		return getEnvInt("TIME_MULTIPLICATIONS_MS", 200)
-	case "/":
-		return getEnvInt("TIME_DIVISIONS_MS", 200)
+// addCall создает задачу вызова функции, аргументы передаются в Args
+func (b *taskBuilder) addCall(name string, args []string) operand {
+	taskID := len(b.tasks) + 1
+	task := models.Task{
+		ID:            taskID,
+		Operation:     name,
+		Args:          args,
+		OperationTime: getOperationTime(name),
 	}
-	return 100
+	b.tasks = append(b.tasks, task)
+	log.Printf("Создание задачи #%d: %s(%s) -> result%d", taskID, name, strings.Join(args, ", "), taskID)
+	return operand{ref: fmt.Sprintf("result%d", taskID)}
 }
 
-func getEnvInt(key string, defaultVal int) int {
-	if val, err := strconv.Atoi(os.Getenv(key)); err == nil {
-		return val
+// getOperationTime возвращает время операции по ее классу стоимости в реестре
+func getOperationTime(op string) int {
+	if o, ok := operations.Lookup(op); ok {
+		return Config.Operations.CostMs(o.Cost)
 	}
-	return defaultVal
+	return 100
 }
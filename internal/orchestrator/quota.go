@@ -0,0 +1,257 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// Ограничения, которые может превысить пользователь
+const (
+	QuotaRate    = "rate"    // Частота отправки выражений
+	QuotaPending = "pending" // Число одновременно вычисляемых выражений
+	QuotaDaily   = "daily"   // Число выражений за сутки
+	QuotaTasks   = "tasks"   // Число задач в одном выражении
+)
+
+const (
+	// pendingRetryAfter через сколько предлагать повторить запрос, когда занято место в очереди
+	pendingRetryAfter = 5 * time.Second
+	// bucketPruneThreshold с какого числа ведер начинается удаление наполнившихся
+	bucketPruneThreshold = 1024
+)
+
+// QuotaError выражение отклонено из-за ограничений роли пользователя
+type QuotaError struct {
+	Quota      string        // Какое ограничение превышено
+	Limit      int           // Значение ограничения
+	RetryAfter time.Duration // Когда имеет смысл повторить, 0 для QuotaTasks
+}
+
+func (e *QuotaError) Error() string {
+	switch e.Quota {
+	case QuotaRate:
+		return fmt.Sprintf("превышена частота отправки: не больше %d выражений в минуту", e.Limit)
+	case QuotaPending:
+		return fmt.Sprintf("одновременно может вычисляться не больше %d выражений", e.Limit)
+	case QuotaDaily:
+		return fmt.Sprintf("превышен суточный лимит: не больше %d выражений", e.Limit)
+	default:
+		return fmt.Sprintf("выражение слишком большое: не больше %d задач", e.Limit)
+	}
+}
+
+// tokenBucket маркерное ведро одного пользователя. Скорость и емкость запоминаются
+// по роли пользователя при последнем пополнении
+type tokenBucket struct {
+	tokens   float64
+	updated  time.Time
+	rate     float64 // Маркеров в минуту
+	capacity float64
+}
+
+// full сообщает, что к моменту now ведро наполнилось и не отличается от нового
+func (b *tokenBucket) full(now time.Time) bool {
+	missing := b.capacity - b.tokens
+	return missing <= 0 || now.Sub(b.updated).Minutes()*b.rate >= missing
+}
+
+// userLock мьютекс отправки выражений одного пользователя
+type userLock struct {
+	mu   sync.Mutex
+	refs int // Сколько запросов держат или ждут мьютекс
+}
+
+// QuotaTracker хранит маркерные ведра пользователей в памяти оркестратора.
+// Остальные ограничения считаются по выражениям в БД
+type QuotaTracker struct {
+	mu      sync.Mutex
+	buckets map[int]*tokenBucket
+	locks   map[int]*userLock
+	now     func() time.Time
+}
+
+// NewQuotaTracker создает пустой учет частоты отправки
+func NewQuotaTracker() *QuotaTracker {
+	return &QuotaTracker{
+		buckets: make(map[int]*tokenBucket),
+		locks:   make(map[int]*userLock),
+		now:     time.Now,
+	}
+}
+
+// Quotas глобальный учет частоты отправки выражений
+var Quotas = NewQuotaTracker()
+
+// SetClock задает источник времени (для тестов)
+func (q *QuotaTracker) SetClock(now func() time.Time) {
+	q.mu.Lock()
+	q.now = now
+	q.mu.Unlock()
+}
+
+func (q *QuotaTracker) clock() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.now()
+}
+
+// LockUser захватывает мьютекс отправки выражений пользователя и возвращает функцию освобождения.
+// Проверка ограничений и сохранение выражения выполняются под ним, чтобы одновременные запросы
+// одного пользователя не прошли проверку max_pending и max_daily по одному и тому же счету
+func (q *QuotaTracker) LockUser(userID int) (unlock func()) {
+	q.mu.Lock()
+	l, ok := q.locks[userID]
+	if !ok {
+		l = &userLock{}
+		q.locks[userID] = l
+	}
+	l.refs++
+	q.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		q.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(q.locks, userID)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Take забирает маркер пользователя. Если маркеров нет, возвращает время до появления следующего
+func (q *QuotaTracker) Take(userID int, limits config.RoleLimits) time.Duration {
+	if limits.RatePerMinute <= 0 {
+		return 0
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	q.prune(now)
+	b := q.refill(userID, limits, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	perToken := time.Minute / time.Duration(limits.RatePerMinute)
+	return time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// Remaining возвращает число маркеров пользователя, доступных прямо сейчас
+func (q *QuotaTracker) Remaining(userID int, limits config.RoleLimits) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(math.Floor(q.refill(userID, limits, q.now()).tokens))
+}
+
+// refill пополняет ведро пользователя за прошедшее время. Вызывается с захваченным мьютексом
+func (q *QuotaTracker) refill(userID int, limits config.RoleLimits, now time.Time) *tokenBucket {
+	capacity := float64(limits.Burst)
+	rate := float64(limits.RatePerMinute)
+	b, ok := q.buckets[userID]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, updated: now, rate: rate, capacity: capacity}
+		q.buckets[userID] = b
+		return b
+	}
+	elapsed := now.Sub(b.updated).Minutes()
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+	// Ведро могло остаться от роли с большим burst
+	b.tokens = math.Min(capacity, b.tokens)
+	b.rate, b.capacity = rate, capacity
+	return b
+}
+
+// prune удаляет ведра, которые уже наполнились: они не отличаются от новых.
+// Каждое ведро проверяется по скорости и емкости роли его владельца.
+// Вызывается с захваченным мьютексом
+func (q *QuotaTracker) prune(now time.Time) {
+	if len(q.buckets) < bucketPruneThreshold {
+		return
+	}
+	for id, b := range q.buckets {
+		if b.full(now) {
+			delete(q.buckets, id)
+		}
+	}
+}
+
+// dayStart возвращает начало текущих суток UTC, от которого считается суточный лимит
+func dayStart(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// Usage текущее использование ограничений пользователем
+type Usage struct {
+	Role           string            `json:"role"`
+	Limits         config.RoleLimits `json:"limits"`
+	Pending        int               `json:"pending"`
+	SubmittedToday int               `json:"submitted_today"`
+	RateRemaining  *int              `json:"rate_remaining,omitempty"` // Нет, если частота не ограничена
+	DailyResetAt   int64             `json:"daily_reset_at"`           // Сброс суточного лимита в миллисекундах Unix
+}
+
+// UserUsage собирает использование ограничений пользователем по настройкам Config.Limits
+func UserUsage(db database.Database, user *models.User) (*Usage, error) {
+	limits := Config.Limits.ForRole(user.Role)
+	start := dayStart(Quotas.clock())
+	pending, submitted, err := db.CountUserExpressions(user.ID, start.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{
+		Role:           user.Role,
+		Limits:         limits,
+		Pending:        pending,
+		SubmittedToday: submitted,
+		DailyResetAt:   start.Add(24 * time.Hour).UnixMilli(),
+	}
+	if limits.RatePerMinute > 0 {
+		remaining := Quotas.Remaining(user.ID, limits)
+		usage.RateRemaining = &remaining
+	}
+	return usage, nil
+}
+
+// CheckSubmission проверяет ограничения роли пользователя перед постановкой выражения
+// из taskCount задач в очередь. Маркер частоты отправки забирается до остальных проверок.
+// Вызывающий держит Quotas.LockUser, пока выражение не сохранено в БД
+func CheckSubmission(db database.Database, user *models.User, taskCount int) error {
+	limits := Config.Limits.ForRole(user.Role)
+	if wait := Quotas.Take(user.ID, limits); wait > 0 {
+		return &QuotaError{Quota: QuotaRate, Limit: limits.RatePerMinute, RetryAfter: wait}
+	}
+	if limits.MaxTasks > 0 && taskCount > limits.MaxTasks {
+		return &QuotaError{Quota: QuotaTasks, Limit: limits.MaxTasks}
+	}
+	if limits.MaxPending == 0 && limits.MaxDaily == 0 {
+		return nil
+	}
+
+	now := Quotas.clock()
+	start := dayStart(now)
+	pending, submitted, err := db.CountUserExpressions(user.ID, start.Unix())
+	if err != nil {
+		return err
+	}
+	if limits.MaxPending > 0 && pending >= limits.MaxPending {
+		return &QuotaError{Quota: QuotaPending, Limit: limits.MaxPending, RetryAfter: pendingRetryAfter}
+	}
+	if limits.MaxDaily > 0 && submitted >= limits.MaxDaily {
+		return &QuotaError{Quota: QuotaDaily, Limit: limits.MaxDaily, RetryAfter: start.Add(24 * time.Hour).Sub(now)}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package orchestrator
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// persist записывает изменение состояния задач в БД, если она подключена.
+// Вызывается с захваченным мьютексом, чтобы записи шли в том же порядке,
+// что и изменения в памяти. Ошибка записи не прерывает вычисление, а только логируется.
+func persist(action string, write func(db database.Database) error) {
+	if DB == nil {
+		return
+	}
+	if err := write(DB); err != nil {
+		log.Printf("%s: Ошибка при сохранении состояния задач в БД: %v", action, err)
+	}
+}
+
+// Restore восстанавливает состояние менеджера из БД после перезапуска оркестратора:
+// незавершенные выражения, их задачи, полученные результаты и действующие аренды.
+// Задачи, выданные агентам до перезапуска, остаются в аренде до LeaseDeadline,
+// после чего ReleaseExpiredLeases вернет их в очередь.
+func (tm *TaskManager) Restore(db database.Database) error {
+	expressions, err := db.GetPendingExpressions()
+	if err != nil {
+		return fmt.Errorf("не удалось загрузить незавершенные выражения: %w", err)
+	}
+	tasks, err := db.GetUnfinishedTasks()
+	if err != nil {
+		return fmt.Errorf("не удалось загрузить незавершенные задачи: %w", err)
+	}
+	maxTaskID, err := db.GetMaxTaskID()
+	if err != nil {
+		return fmt.Errorf("не удалось получить последний ID задачи: %w", err)
+	}
+
+	results := make(map[string]map[int]float64, len(expressions))
+	for _, expr := range expressions {
+		exprResults, err := db.GetResultsByExprID(expr.ID)
+		if err != nil {
+			return fmt.Errorf("не удалось загрузить результаты выражения %s: %w", expr.ID, err)
+		}
+		results[expr.ID] = exprResults
+	}
+
+	tm.mu.Lock()
+
+	// Продолжаем нумерацию задач, чтобы не пересечься со ссылками "resultN" в БД
+	if maxTaskID > tm.taskCounter {
+		tm.taskCounter = maxTaskID
+	}
+
+	for _, expr := range expressions {
+		tm.Expressions[expr.ID] = expr
+		for taskID, value := range results[expr.ID] {
+			tm.Results[taskID] = value
+			tm.TaskToExpr[taskID] = expr.ID
+		}
+	}
+
+	leased := 0
+	for _, stored := range tasks {
+		if _, exists := tm.Expressions[stored.ExpressionID]; !exists {
+			log.Printf("Restore: Задача #%d относится к неизвестному выражению %s, пропускаем",
+				stored.ID, stored.ExpressionID)
+			continue
+		}
+
+		task := stored.Task
+		task.LeaseID = ""
+		tm.Tasks[task.ID] = &task
+		tm.TaskToExpr[task.ID] = task.ExpressionID
+
+		if stored.State == models.TaskStateProcessing && stored.LeaseID != "" {
+			tm.ProcessingTasks[task.ID] = true
+			tm.TaskProcessingStartTime[task.ID] = time.UnixMilli(stored.StartedAt)
+			tm.TaskLeases[task.ID] = stored.LeaseID
+			leased++
+		}
+	}
+
+	// Выражения без оставшихся задач могли не успеть обновить статус до остановки
+	var finished []models.Expression
+	for _, expr := range expressions {
+		if tm.hasTasks(expr.ID) {
+			continue
+		}
+
+		rootID := 0
+		for taskID := range results[expr.ID] {
+			if taskID > rootID {
+				rootID = taskID
+			}
+		}
+
+		var updated *models.Expression
+		if rootID > 0 {
+			updated = tm.completeExpression(expr.ID, results[expr.ID][rootID])
+		} else {
+			updated = tm.failExpression(expr.ID, "задачи выражения не найдены при восстановлении")
+		}
+		if updated != nil {
+			finished = append(finished, *updated)
+		}
+	}
+
+	tm.updateReadyTasksList()
+	log.Printf("Restore: Восстановлено выражений: %d, задач: %d (в аренде: %d), готовых к выполнению: %d",
+		len(expressions), len(tm.Tasks), leased, len(tm.ReadyTasks))
+	tm.mu.Unlock()
+
+	for _, expr := range finished {
+		if err := db.UpdateExpressionStatus(expr.ID, expr.Status, expr.Result, expr.Error); err != nil {
+			log.Printf("Restore: Ошибка при обновлении статуса выражения %s в БД: %v", expr.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DrainTimeout время, которое оркестратор ждет завершения выданных задач при остановке
+func DrainTimeout() time.Duration {
+	return time.Duration(Config.Shutdown.TimeoutMs) * time.Millisecond
+}
+
+// ServerShutdownGrace время, которое HTTP и gRPC серверы получают на завершение запросов
+// после ожидания задач. Отдельный срок нужен, чтобы результаты, отправленные в последний момент
+// ожидания, не терялись из-за уже истекшего контекста
+func ServerShutdownGrace() time.Duration {
+	return time.Duration(Config.Shutdown.ServerGraceMs) * time.Millisecond
+}
+
+// Drain переводит менеджер в режим остановки: задачи больше не выдаются агентам,
+// а результаты уже выданных задач по-прежнему принимаются
+func (tm *TaskManager) Drain() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.draining {
+		return
+	}
+	tm.draining = true
+	if tm.drainCh == nil {
+		tm.drainCh = make(chan struct{})
+	}
+	close(tm.drainCh)
+	log.Printf("Drain: Выдача задач остановлена, задач в обработке: %d", len(tm.ProcessingTasks))
+}
+
+// Draining сообщает, что оркестратор останавливается
+func (tm *TaskManager) Draining() bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.draining
+}
+
+// DrainSignal возвращает канал, который закроется при переходе в режим остановки
+func (tm *TaskManager) DrainSignal() <-chan struct{} {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.drainCh == nil {
+		tm.drainCh = make(chan struct{})
+	}
+	return tm.drainCh
+}
+
+// WaitIdle ждет, пока агенты вернут результаты всех выданных задач.
+// Возвращает ошибку ctx, если задачи не завершились до его отмены.
+func (tm *TaskManager) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		tm.mu.Lock()
+		processing := len(tm.ProcessingTasks)
+		tm.mu.Unlock()
+		if processing == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("WaitIdle: Не дождались результатов %d задач, они будут восстановлены после перезапуска", processing)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// BeginShutdown начинает остановку оркестратора: новые выражения отклоняются с кодом 503,
+// задачи больше не выдаются, а /readyz и grpc.health.v1 сообщают о неготовности,
+// чтобы агенты и балансировщик перестали направлять запросы на этот экземпляр
+func BeginShutdown() {
+	Manager.Drain()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(calculator.Calculator_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// StopGRPCServer останавливает gRPC сервер, дожидаясь завершения текущих вызовов и потоков.
+// Если они не завершились до отмены ctx, соединения закрываются принудительно.
+func StopGRPCServer(ctx context.Context, server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("gRPC сервер остановлен")
+	case <-ctx.Done():
+		log.Println("gRPC сервер не остановился за отведенное время, соединения закрыты принудительно")
+		server.Stop()
+	}
+}
+
+// writeShuttingDown отвечает кодом 503: оркестратор останавливается и не принимает новые выражения
+func writeShuttingDown(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Server is shutting down"})
+}
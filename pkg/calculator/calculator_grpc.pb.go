@@ -0,0 +1,306 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: calculator.proto
+
+package calculator
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Calculator_RegisterAgent_FullMethodName = "/calculator.Calculator/RegisterAgent"
+	Calculator_Heartbeat_FullMethodName     = "/calculator.Calculator/Heartbeat"
+	Calculator_GetTask_FullMethodName       = "/calculator.Calculator/GetTask"
+	Calculator_SubmitResult_FullMethodName  = "/calculator.Calculator/SubmitResult"
+	Calculator_StreamTasks_FullMethodName   = "/calculator.Calculator/StreamTasks"
+)
+
+// CalculatorClient is the client API for Calculator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CalculatorClient interface {
+	// Регистрация агента: оркестратор назначает ID, под которым агент
+	// запрашивает задачи и отправляет heartbeat
+	RegisterAgent(ctx context.Context, in *RegisterAgentRequest, opts ...grpc.CallOption) (*RegisterAgentResponse, error)
+	// Периодический сигнал агента о том, что он жив
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	// Получение задачи от оркестратора
+	GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// Отправка результата задачи в оркестратор
+	SubmitResult(ctx context.Context, in *TaskResult, opts ...grpc.CallOption) (*SubmitResultResponse, error)
+	// Двунаправленный поток задач: агент сообщает, сколько задач готов принять,
+	// оркестратор отправляет задачи по мере их готовности, а результаты
+	// возвращаются по тому же потоку
+	StreamTasks(ctx context.Context, opts ...grpc.CallOption) (Calculator_StreamTasksClient, error)
+}
+
+type calculatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCalculatorClient(cc grpc.ClientConnInterface) CalculatorClient {
+	return &calculatorClient{cc}
+}
+
+func (c *calculatorClient) RegisterAgent(ctx context.Context, in *RegisterAgentRequest, opts ...grpc.CallOption) (*RegisterAgentResponse, error) {
+	out := new(RegisterAgentResponse)
+	err := c.cc.Invoke(ctx, Calculator_RegisterAgent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, Calculator_Heartbeat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	out := new(Task)
+	err := c.cc.Invoke(ctx, Calculator_GetTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) SubmitResult(ctx context.Context, in *TaskResult, opts ...grpc.CallOption) (*SubmitResultResponse, error) {
+	out := new(SubmitResultResponse)
+	err := c.cc.Invoke(ctx, Calculator_SubmitResult_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) StreamTasks(ctx context.Context, opts ...grpc.CallOption) (Calculator_StreamTasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Calculator_ServiceDesc.Streams[0], Calculator_StreamTasks_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &calculatorStreamTasksClient{stream}
+	return x, nil
+}
+
+type Calculator_StreamTasksClient interface {
+	Send(*AgentMessage) error
+	Recv() (*ServerMessage, error)
+	grpc.ClientStream
+}
+
+type calculatorStreamTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *calculatorStreamTasksClient) Send(m *AgentMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *calculatorStreamTasksClient) Recv() (*ServerMessage, error) {
+	m := new(ServerMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CalculatorServer is the server API for Calculator service.
+// All implementations must embed UnimplementedCalculatorServer
+// for forward compatibility
+type CalculatorServer interface {
+	// Регистрация агента: оркестратор назначает ID, под которым агент
+	// запрашивает задачи и отправляет heartbeat
+	RegisterAgent(context.Context, *RegisterAgentRequest) (*RegisterAgentResponse, error)
+	// Периодический сигнал агента о том, что он жив
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	// Получение задачи от оркестратора
+	GetTask(context.Context, *GetTaskRequest) (*Task, error)
+	// Отправка результата задачи в оркестратор
+	SubmitResult(context.Context, *TaskResult) (*SubmitResultResponse, error)
+	// Двунаправленный поток задач: агент сообщает, сколько задач готов принять,
+	// оркестратор отправляет задачи по мере их готовности, а результаты
+	// возвращаются по тому же потоку
+	StreamTasks(Calculator_StreamTasksServer) error
+	mustEmbedUnimplementedCalculatorServer()
+}
+
+// UnimplementedCalculatorServer must be embedded to have forward compatible implementations.
+type UnimplementedCalculatorServer struct {
+}
+
+func (UnimplementedCalculatorServer) RegisterAgent(context.Context, *RegisterAgentRequest) (*RegisterAgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAgent not implemented")
+}
+func (UnimplementedCalculatorServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedCalculatorServer) GetTask(context.Context, *GetTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTask not implemented")
+}
+func (UnimplementedCalculatorServer) SubmitResult(context.Context, *TaskResult) (*SubmitResultResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitResult not implemented")
+}
+func (UnimplementedCalculatorServer) StreamTasks(Calculator_StreamTasksServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTasks not implemented")
+}
+func (UnimplementedCalculatorServer) mustEmbedUnimplementedCalculatorServer() {}
+
+// UnsafeCalculatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CalculatorServer will
+// result in compilation errors.
+type UnsafeCalculatorServer interface {
+	mustEmbedUnimplementedCalculatorServer()
+}
+
+func RegisterCalculatorServer(s grpc.ServiceRegistrar, srv CalculatorServer) {
+	s.RegisterService(&Calculator_ServiceDesc, srv)
+}
+
+func _Calculator_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterAgentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_RegisterAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).RegisterAgent(ctx, req.(*RegisterAgentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_GetTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).GetTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_GetTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).GetTask(ctx, req.(*GetTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_SubmitResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskResult)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).SubmitResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_SubmitResult_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).SubmitResult(ctx, req.(*TaskResult))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_StreamTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CalculatorServer).StreamTasks(&calculatorStreamTasksServer{stream})
+}
+
+type Calculator_StreamTasksServer interface {
+	Send(*ServerMessage) error
+	Recv() (*AgentMessage, error)
+	grpc.ServerStream
+}
+
+type calculatorStreamTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *calculatorStreamTasksServer) Send(m *ServerMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *calculatorStreamTasksServer) Recv() (*AgentMessage, error) {
+	m := new(AgentMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Calculator_ServiceDesc is the grpc.ServiceDesc for Calculator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Calculator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "calculator.Calculator",
+	HandlerType: (*CalculatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterAgent",
+			Handler:    _Calculator_RegisterAgent_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Calculator_Heartbeat_Handler,
+		},
+		{
+			MethodName: "GetTask",
+			Handler:    _Calculator_GetTask_Handler,
+		},
+		{
+			MethodName: "SubmitResult",
+			Handler:    _Calculator_SubmitResult_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTasks",
+			Handler:       _Calculator_StreamTasks_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "calculator.proto",
+}
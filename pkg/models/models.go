@@ -1,11 +1,17 @@
 package models
 
 type Expression struct {
-	ID        string  `json:"id"`
-	Status    string  `json:"status"`
-	Result    float64 `json:"result,omitempty"`
-	UserID    int     `json:"user_id,omitempty"`
-	CreatedAt int64   `json:"created_at,omitempty"`
+	ID         string  `json:"id"`
+	Status     string  `json:"status"`
+	Result     float64 `json:"result,omitempty"`
+	UserID     int     `json:"user_id,omitempty"`
+	CreatedAt  int64   `json:"created_at,omitempty"`
+	Expression string  `json:"expression,omitempty"` // Исходный текст выражения
+	Normalized string  `json:"normalized,omitempty"` // Каноническая запись выражения
+	TaskCount  int     `json:"task_count"`           // Количество задач, на которые разбито выражение
+	Error      string  `json:"error,omitempty"`      // Причина ошибки для выражений в статусе error
+	// Variables значения переменных, подставленные в выражение
+	Variables map[string]float64 `json:"variables,omitempty"`
 }
 
 type Task struct {
@@ -15,18 +21,124 @@ type Task struct {
 	Operation     string `json:"operation"`
 	OperationTime int    `json:"operation_time"`
 	ExpressionID  string `json:"expression_id,omitempty"`
+	LeaseID       string `json:"lease_id,omitempty"` // Аренда, выданная агенту вместе с задачей
+	// Args аргументы вызова функции (sqrt, min и т.д.). У бинарных операций пусто, аргументы в Arg1 и Arg2
+	Args []string `json:"args,omitempty"`
+}
+
+// IsFunction сообщает, является ли задача вызовом функции с аргументами в Args
+func (t Task) IsFunction() bool {
+	return len(t.Args) > 0
+}
+
+// Operands возвращает аргументы задачи: Args для функций, Arg1 и Arg2 для бинарных операций
+func (t Task) Operands() []string {
+	if t.IsFunction() {
+		return t.Args
+	}
+	return []string{t.Arg1, t.Arg2}
+}
+
+// UsesOperand сообщает, передается ли arg (например, ссылка "result3") в задачу аргументом
+func (t Task) UsesOperand(arg string) bool {
+	for _, operand := range t.Operands() {
+		if operand == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// MapOperands заменяет каждый аргумент задачи результатом f. Args копируется,
+// поэтому копии задачи, разделяющие срез, не меняются
+func (t *Task) MapOperands(f func(string) string) {
+	if t.IsFunction() {
+		args := make([]string, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = f(arg)
+		}
+		t.Args = args
+		return
+	}
+	t.Arg1 = f(t.Arg1)
+	t.Arg2 = f(t.Arg2)
+}
+
+// Состояния задачи в хранилище
+const (
+	TaskStatePending    = "pending"    // Ожидает зависимостей или выдачи агенту
+	TaskStateProcessing = "processing" // Выдана агенту по аренде
+	TaskStateDone       = "done"       // Результат получен
+	TaskStateCancelled  = "cancelled"  // Отменена вместе с выражением
+)
+
+// StoredTask задача в хранилище вместе с состоянием выполнения,
+// по которому оркестратор восстанавливает очередь после перезапуска
+type StoredTask struct {
+	Task
+	State     string `json:"state"`
+	StartedAt int64  `json:"started_at,omitempty"` // Начало аренды в миллисекундах Unix, 0 если задача не выдана
 }
 
 type TaskResult struct {
-	ID     int     `json:"id"`
-	Result float64 `json:"result"`
+	ID        int     `json:"id"`
+	Result    float64 `json:"result"`
+	LeaseID   string  `json:"lease_id,omitempty"`   // Аренда, по которой агент выполнял задачу
+	ErrorCode string  `json:"error_code,omitempty"` // Код ошибки вычисления, пустой при успехе
+	Error     string  `json:"error,omitempty"`      // Описание ошибки вычисления
 }
 
+// Коды ошибок вычисления задачи, которые агент передает оркестратору
+const (
+	TaskErrorDivisionByZero   = "division_by_zero"
+	TaskErrorInvalidArgument  = "invalid_argument"
+	TaskErrorUnknownOperation = "unknown_operation"
+	TaskErrorDomain           = "domain_error" // Операция не определена для аргументов
+)
+
+// Failed сообщает, завершилась ли задача ошибкой
+func (r TaskResult) Failed() bool {
+	return r.ErrorCode != "" || r.Error != ""
+}
+
+// Agent зарегистрированный агент-вычислитель
+type Agent struct {
+	ID           int32    `json:"id"`
+	Hostname     string   `json:"hostname"`
+	Version      string   `json:"version"`
+	Capacity     int      `json:"capacity"`             // Сколько задач агент выполняет одновременно
+	InFlight     int      `json:"in_flight"`            // Задачи, выданные агенту и еще не вернувшиеся
+	Status       string   `json:"status"`               // online или offline
+	RegisteredAt int64    `json:"registered_at"`        // Миллисекунды Unix
+	LastSeen     int64    `json:"last_seen"`            // Последний heartbeat или запрос агента, миллисекунды Unix
+	Operations   []string `json:"operations,omitempty"` // Поддерживаемые операции, пусто - только + - * /
+}
+
+// Состояния агента
+const (
+	AgentStatusOnline  = "online"
+	AgentStatusOffline = "offline"
+)
+
 // User представляет пользователя системы
 type User struct {
 	ID       int    `json:"id"`
 	Login    string `json:"login"`
-	Password string `json:"-"` // Не сериализуем пароль в JSON
+	Password string `json:"-"`    // Не сериализуем пароль в JSON
+	Role     string `json:"role"` // RoleUser или RoleAdmin
+}
+
+// Роли пользователей
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// CalculateRequest запрос на вычисление выражения. Имена в выражении заменяются
+// значениями из Variables: {"expression": "a*x + b", "variables": {"a": 2, "x": 3.5, "b": 1}}
+type CalculateRequest struct {
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
 }
 
 // LoginRequest используется для запроса на вход
@@ -35,11 +147,108 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// LoginResponse ответ на успешный вход
+// LoginResponse ответ на успешный вход и обновление токенов
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"` // Одноразовый, при обновлении выдается новый
+	ExpiresIn    int    `json:"expires_in,omitempty"`    // Время жизни access токена в секундах
 }
 
+// RefreshRequest запрос на обновление токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Session сессия пользователя, созданная при входе. Access токены сессии содержат ее ID
+// и перестают приниматься после выхода
+type Session struct {
+	ID        string `json:"id"`
+	UserID    int    `json:"user_id"`
+	CreatedAt int64  `json:"created_at"`           // Миллисекунды Unix
+	ExpiresAt int64  `json:"expires_at"`           // Срок действия последнего refresh токена
+	RevokedAt int64  `json:"revoked_at,omitempty"` // Момент выхода, 0 для активной сессии
+}
+
+// RefreshToken refresh токен сессии. Хранится только хеш, сам токен отдается клиенту один раз
+type RefreshToken struct {
+	Hash      string `json:"-"`
+	SessionID string `json:"session_id"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedAt    int64  `json:"used_at,omitempty"` // Момент обмена на новый токен, 0 если не использован
+}
+
+// APIKey именованный ключ API пользователя для машинных клиентов. Хранится только хеш ключа,
+// сам ключ отдается клиенту один раз при создании
+type APIKey struct {
+	ID         int    `json:"id"`
+	UserID     int    `json:"user_id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"` // Начало ключа, по которому его можно узнать в списке
+	Hash       string `json:"-"`
+	CreatedAt  int64  `json:"created_at"`             // Миллисекунды Unix
+	ExpiresAt  int64  `json:"expires_at,omitempty"`   // 0 для бессрочного ключа
+	LastUsedAt int64  `json:"last_used_at,omitempty"` // 0, если ключ еще не использовался
+	RevokedAt  int64  `json:"revoked_at,omitempty"`   // 0 для действующего ключа
+}
+
+// CreateAPIKeyRequest запрос на создание ключа API
+type CreateAPIKeyRequest struct {
+	Name        string `json:"name"`
+	ExpiresInMs int64  `json:"expires_in_ms,omitempty"` // 0 для бессрочного ключа
+}
+
+// CreateAPIKeyResponse созданный ключ API вместе с самим ключом, который больше не будет показан
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+// Formula сохраненная формула пользователя: выражение с объявленными параметрами,
+// которое вычисляется с разными значениями параметров. Имя уникально среди формул пользователя
+type Formula struct {
+	ID         int      `json:"id"`
+	UserID     int      `json:"user_id"`
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Parameters []string `json:"parameters"`
+	CreatedAt  int64    `json:"created_at"` // Миллисекунды Unix
+	UpdatedAt  int64    `json:"updated_at"` // Миллисекунды Unix
+	// LastExpressionID выражение, отправленное последним вычислением формулы, пусто до первого вычисления
+	LastExpressionID string `json:"last_expression_id,omitempty"`
+	// LastEvaluation состояние последнего вычисления, заполняется при выдаче списка формул
+	LastEvaluation *Expression `json:"last_evaluation,omitempty"`
+}
+
+// FormulaRequest запрос на создание или изменение формулы. При изменении имя берется из пути
+type FormulaRequest struct {
+	Name       string   `json:"name,omitempty"`
+	Expression string   `json:"expression"`
+	Parameters []string `json:"parameters"`
+}
+
+// EvaluateFormulaRequest значения параметров формулы: {"arguments": {"price": 100, "rate": 0.2}}
+type EvaluateFormulaRequest struct {
+	Arguments map[string]float64 `json:"arguments"`
+}
+
+// AuditEntry запись журнала событий безопасности
+type AuditEntry struct {
+	ID     int    `json:"id"`
+	Time   int64  `json:"time"`  // Миллисекунды Unix
+	Event  string `json:"event"` // Одно из Audit*
+	Login  string `json:"login,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// События журнала безопасности
+const (
+	AuditLoginFailed = "login_failed" // Неверный логин или пароль
+	AuditLoginLocked = "login_locked" // Попытка входа во время блокировки
+	AuditLockout     = "lockout"      // Превышено число неудачных попыток, вход заблокирован
+)
+
 // RegisterRequest используется для регистрации
 type RegisterRequest struct {
 	Login    string `json:"login"`
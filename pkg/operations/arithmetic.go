@@ -0,0 +1,81 @@
+package operations
+
+import (
+	"math"
+
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func init() {
+	register(
+		binary("+", PrecedenceAdditive, Left, CostAddition, func(a, b float64) (float64, error) { return a + b, nil }),
+		binary("-", PrecedenceAdditive, Left, CostSubtraction, func(a, b float64) (float64, error) { return a - b, nil }),
+		binary("*", PrecedenceMultiplicative, Left, CostMultiplication, func(a, b float64) (float64, error) { return a * b, nil }),
+		binary("/", PrecedenceMultiplicative, Left, CostDivision, divide),
+		binary("//", PrecedenceMultiplicative, Left, CostIntDivision, intDivide),
+		binary("%", PrecedenceMultiplicative, Left, CostModulo, modulo),
+		binary("^", PrecedencePower, Right, CostExponentiation, power),
+	)
+}
+
+// binary описывает бинарный оператор
+func binary(symbol string, precedence int, assoc Associativity, cost Cost, eval func(a, b float64) (float64, error)) Operation {
+	return Operation{
+		Symbol:        symbol,
+		Kind:          Binary,
+		MinArgs:       2,
+		MaxArgs:       2,
+		Associativity: assoc,
+		Precedence:    precedence,
+		Cost:          cost,
+		Eval: func(args []float64) (float64, error) {
+			return eval(args[0], args[1])
+		},
+	}
+}
+
+func divisionByZero(message string) *Error {
+	return &Error{Code: models.TaskErrorDivisionByZero, Message: message}
+}
+
+func divide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, divisionByZero("деление на ноль")
+	}
+	return a / b, nil
+}
+
+// intDivide целочисленное деление с округлением частного вниз: -7 // 2 = -4
+func intDivide(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, divisionByZero("деление на ноль")
+	}
+	return math.Floor(a / b), nil
+}
+
+// modulo остаток со знаком делителя (-7 % 2 = 1), так что a = b*(a//b) + a%b
+// и для дробных операндов (5.5 % 2 = 1.5)
+func modulo(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, divisionByZero("остаток от деления на ноль")
+	}
+	r := math.Mod(a, b)
+	if r != 0 && (r < 0) != (b < 0) {
+		r += b
+	}
+	return r, nil
+}
+
+func power(a, b float64) (float64, error) {
+	if a == 0 && b < 0 {
+		return 0, divisionByZero("возведение нуля в отрицательную степень")
+	}
+	if a < 0 && b != math.Trunc(b) {
+		return 0, domainError("возведение отрицательного числа в дробную степень")
+	}
+	value := math.Pow(a, b)
+	if math.IsInf(value, 0) {
+		return 0, domainError("результат возведения в степень слишком велик")
+	}
+	return value, nil
+}
@@ -0,0 +1,82 @@
+package operations
+
+import "math"
+
+// maxRoundDigits наибольшее число знаков после запятой в round
+const maxRoundDigits = 15
+
+func init() {
+	register(
+		function("sqrt", 1, 1, sqrt),
+		function("abs", 1, 1, unary(math.Abs)),
+		function("sin", 1, 1, unary(math.Sin)),
+		function("cos", 1, 1, unary(math.Cos)),
+		function("log", 1, 2, logarithm),
+		function("min", 1, Variadic, extremum(math.Min)),
+		function("max", 1, Variadic, extremum(math.Max)),
+		function("round", 1, 2, round),
+	)
+}
+
+// function описывает встроенную функцию
+func function(name string, minArgs, maxArgs int, eval func(args []float64) (float64, error)) Operation {
+	return Operation{
+		Symbol:  name,
+		Kind:    Function,
+		MinArgs: minArgs,
+		MaxArgs: maxArgs,
+		Cost:    CostFunction,
+		Eval:    eval,
+	}
+}
+
+func unary(f func(float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return f(args[0]), nil
+	}
+}
+
+func extremum(pick func(a, b float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		value := args[0]
+		for _, arg := range args[1:] {
+			value = pick(value, arg)
+		}
+		return value, nil
+	}
+}
+
+func sqrt(args []float64) (float64, error) {
+	if args[0] < 0 {
+		return 0, domainError("sqrt: корень из отрицательного числа")
+	}
+	return math.Sqrt(args[0]), nil
+}
+
+// logarithm натуральный логарифм log(x) или логарифм по основанию log(x, base)
+func logarithm(args []float64) (float64, error) {
+	if args[0] <= 0 {
+		return 0, domainError("log: логарифм неположительного числа")
+	}
+	if len(args) == 1 {
+		return math.Log(args[0]), nil
+	}
+	base := args[1]
+	if base <= 0 || base == 1 {
+		return 0, domainError("log: основание логарифма должно быть положительным и не равным 1")
+	}
+	return math.Log(args[0]) / math.Log(base), nil
+}
+
+// round округляет до целого или до digits знаков после запятой, половины - от нуля
+func round(args []float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Round(args[0]), nil
+	}
+	digits := args[1]
+	if digits != math.Trunc(digits) || digits < 0 || digits > maxRoundDigits {
+		return 0, domainError("round: число знаков должно быть целым от 0 до %d", maxRoundDigits)
+	}
+	scale := math.Pow(10, digits)
+	return math.Round(args[0]*scale) / scale, nil
+}
@@ -0,0 +1,159 @@
+// Package operations общий реестр операций выражений: бинарных операторов и встроенных функций.
+// Парсер оркестратора берет из реестра символы, приоритет и ассоциативность операторов
+// и число аргументов функций, планировщик - стоимость, агенты - вычисление.
+package operations
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// Kind вид операции
+type Kind int
+
+const (
+	Binary   Kind = iota // Инфиксный оператор: a + b
+	Function             // Вызов функции: name(a, b, ...)
+)
+
+// Associativity ассоциативность бинарного оператора
+type Associativity int
+
+const (
+	Left  Associativity = iota // a - b - c = (a - b) - c
+	Right                      // a ^ b ^ c = a ^ (b ^ c)
+)
+
+// Приоритет бинарных операторов: чем больше, тем сильнее связывает.
+// Унарные + и - парсер ставит между мультипликативными операторами и степенью,
+// так что -2^2 = -(2^2)
+const (
+	PrecedenceAdditive       = 10 // + -
+	PrecedenceMultiplicative = 20 // * / // %
+	PrecedencePower          = 40 // ^
+)
+
+// Cost класс стоимости операции. Длительность каждого класса задается
+// в настройках оркестратора (раздел operations)
+type Cost string
+
+const (
+	CostAddition       Cost = "addition"
+	CostSubtraction    Cost = "subtraction"
+	CostMultiplication Cost = "multiplication"
+	CostDivision       Cost = "division"
+	CostIntDivision    Cost = "int_division"
+	CostModulo         Cost = "modulo"
+	CostExponentiation Cost = "exponentiation"
+	CostFunction       Cost = "function"
+)
+
+// Variadic в MaxArgs означает, что число аргументов не ограничено сверху
+const Variadic = -1
+
+// Operation описание операции в реестре
+type Operation struct {
+	Symbol        string // Символ оператора или имя функции
+	Kind          Kind
+	MinArgs       int
+	MaxArgs       int           // Variadic, если аргументов может быть сколько угодно
+	Associativity Associativity // Только для Binary
+	Precedence    int           // Только для Binary
+	Cost          Cost
+	Eval          func(args []float64) (float64, error)
+}
+
+// Error операция не определена для переданных аргументов.
+// Code - код ошибки задачи (models.TaskErrorDivisionByZero, models.TaskErrorDomain)
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Accepts сообщает, можно ли выполнить операцию с n аргументами
+func (o Operation) Accepts(n int) bool {
+	return n >= o.MinArgs && (o.MaxArgs == Variadic || n <= o.MaxArgs)
+}
+
+// Arity описывает допустимое число аргументов для сообщений об ошибках
+func (o Operation) Arity() string {
+	switch {
+	case o.MaxArgs == Variadic:
+		return fmt.Sprintf("не меньше %d", o.MinArgs)
+	case o.MinArgs == o.MaxArgs:
+		return fmt.Sprintf("%d", o.MinArgs)
+	default:
+		return fmt.Sprintf("от %d до %d", o.MinArgs, o.MaxArgs)
+	}
+}
+
+// Call проверяет число аргументов и вычисляет операцию.
+// Ошибки области определения возвращаются как *Error
+func (o Operation) Call(args []float64) (float64, error) {
+	if !o.Accepts(len(args)) {
+		return 0, fmt.Errorf("%s: ожидается аргументов: %s, передано %d", o.Symbol, o.Arity(), len(args))
+	}
+	return o.Eval(args)
+}
+
+// Basic операции, которые выполняют агенты, не сообщающие список поддерживаемых операций
+var Basic = []string{"+", "-", "*", "/"}
+
+var (
+	registry  = map[string]Operation{}
+	operators []Operation // Бинарные операторы в порядке сопоставления лексером
+)
+
+// register добавляет операции в реестр
+func register(ops ...Operation) {
+	for _, op := range ops {
+		if _, exists := registry[op.Symbol]; exists {
+			panic("operations: операция " + op.Symbol + " зарегистрирована дважды")
+		}
+		registry[op.Symbol] = op
+		if op.Kind == Binary {
+			operators = append(operators, op)
+		}
+	}
+	sort.Slice(operators, func(i, j int) bool {
+		li, lj := utf8.RuneCountInString(operators[i].Symbol), utf8.RuneCountInString(operators[j].Symbol)
+		if li != lj {
+			return li > lj
+		}
+		return operators[i].Symbol < operators[j].Symbol
+	})
+}
+
+// Lookup ищет операцию по символу или имени функции
+func Lookup(symbol string) (Operation, bool) {
+	op, ok := registry[symbol]
+	return op, ok
+}
+
+// Symbols возвращает символы всех операций в алфавитном порядке
+func Symbols() []string {
+	symbols := make([]string, 0, len(registry))
+	for symbol := range registry {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Operators возвращает бинарные операторы, более длинные символы первыми,
+// чтобы лексер выбирал самое длинное совпадение ("//" раньше "/"). Срез нельзя изменять
+func Operators() []Operation {
+	return operators
+}
+
+// domainError ошибка области определения
+func domainError(format string, args ...any) *Error {
+	return &Error{Code: models.TaskErrorDomain, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func TestAdminAPI(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	admin := orchestrator.NewAdminHandlers(db)
+	handler := admin.AdminOnly(admin.Handler)
+	adminToken := loginToken(t, db, "root")
+	userToken := loginToken(t, db, "user")
+	if err := auth.BootstrapAdmins(db, config.Auth{AdminLogins: []string{"root"}}); err != nil {
+		t.Fatalf("Не удалось назначить администратора: %v", err)
+	}
+
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/queue", userToken, nil, nil); code != http.StatusForbidden {
+		t.Errorf("Обычный пользователь: ожидался код 403, получен %d", code)
+	}
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/queue", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Без токена: ожидался код 401, получен %d", code)
+	}
+
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+	task := takeTask(t, exprID)
+
+	var queue struct {
+		Ready      []models.Task            `json:"ready"`
+		Processing []orchestrator.AdminTask `json:"processing"`
+	}
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/queue", adminToken, nil, &queue); code != http.StatusOK {
+		t.Fatalf("Очередь: ожидался код 200, получен %d", code)
+	}
+	if len(queue.Ready) != 1 || len(queue.Processing) != 1 || queue.Processing[0].ID != task.ID ||
+		queue.Processing[0].StartedAt == 0 || queue.Processing[0].LeaseID != task.LeaseID {
+		t.Fatalf("Неожиданное состояние очереди: %+v", queue)
+	}
+
+	// Зависшая задача возвращается в очередь, результат по старой аренде отклоняется
+	requeuePath := "/api/v1/admin/tasks/" + strconv.Itoa(task.ID) + "/requeue"
+	if code := apiRequest(t, handler, http.MethodPost, requeuePath, adminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("Возврат задачи: ожидался код 200, получен %d", code)
+	}
+	if code := apiRequest(t, handler, http.MethodPost, requeuePath, adminToken, nil, nil); code != http.StatusConflict {
+		t.Errorf("Повторный возврат задачи: ожидался код 409, получен %d", code)
+	}
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID, Result: 3, LeaseID: task.LeaseID}); err == nil {
+		t.Error("Результат по снятой аренде должен быть отклонен")
+	}
+
+	var graph orchestrator.ExpressionGraph
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/expressions/"+exprID, adminToken, nil, &graph); code != http.StatusOK {
+		t.Fatalf("Граф выражения: ожидался код 200, получен %d", code)
+	}
+	states := map[string]int{}
+	for _, node := range graph.Tasks {
+		states[node.State]++
+	}
+	if len(graph.Tasks) != 3 || states[orchestrator.AdminTaskReady] != 2 || states[orchestrator.AdminTaskWaiting] != 1 {
+		t.Errorf("Неожиданный граф выражения: %+v", graph.Tasks)
+	}
+
+	cancelPath := "/api/v1/admin/expressions/" + exprID + "/cancel"
+	if code := apiRequest(t, handler, http.MethodPost, cancelPath, adminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("Отмена выражения: ожидался код 200, получен %d", code)
+	}
+	if code := apiRequest(t, handler, http.MethodPost, cancelPath, adminToken, nil, nil); code != http.StatusConflict {
+		t.Errorf("Повторная отмена: ожидался код 409, получен %d", code)
+	}
+	if expr, _ := db.GetExpression(exprID, 0); expr == nil || expr.Status != "error" {
+		t.Errorf("Отмененное выражение должно быть в статусе error в БД, получено %+v", expr)
+	}
+	if ready, processing := orchestrator.Manager.QueueSnapshot(); len(ready) != 0 || len(processing) != 0 {
+		t.Errorf("После отмены очередь должна быть пуста: %d готовых, %d в обработке", len(ready), len(processing))
+	}
+}
+
+func TestAdminExpressionGraphAfterRestart(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "admin.sqlite"))
+	if err != nil {
+		t.Fatalf("Не удалось создать базу данных: %v", err)
+	}
+	defer db.Close()
+	if err := db.MigrateDB(); err != nil {
+		t.Fatalf("Не удалось выполнить миграции: %v", err)
+	}
+
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() {
+		orchestrator.DB = prevDB
+		orchestrator.InitTaskManager()
+	}()
+	orchestrator.InitTaskManager()
+
+	admin := orchestrator.NewAdminHandlers(db)
+	handler := admin.AdminOnly(admin.Handler)
+	adminToken := loginToken(t, db, "root")
+	if err := auth.BootstrapAdmins(db, config.Auth{AdminLogins: []string{"root"}}); err != nil {
+		t.Fatalf("Не удалось назначить администратора: %v", err)
+	}
+
+	exprID := addTestExpression(t, db, "(1 + 2) * 4")
+	for _, value := range []float64{3, 12} {
+		task := takeTask(t, exprID)
+		if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID, Result: value, LeaseID: task.LeaseID}); err != nil {
+			t.Fatalf("Результат задачи #%d не принят: %v", task.ID, err)
+		}
+	}
+
+	// После перезапуска завершенное выражение не восстанавливается в менеджер, граф берется из БД
+	orchestrator.InitTaskManager()
+	if _, exists := orchestrator.Manager.GetExpression(exprID); exists {
+		t.Fatal("Завершенное выражение не должно восстанавливаться в менеджер")
+	}
+
+	var graph orchestrator.ExpressionGraph
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/expressions/"+exprID, adminToken, nil, &graph); code != http.StatusOK {
+		t.Fatalf("Граф выражения: ожидался код 200, получен %d", code)
+	}
+	if graph.Expression.Status != "completed" || graph.Expression.Result != 12 || len(graph.Tasks) != 2 {
+		t.Fatalf("Неожиданный граф выражения: %+v", graph)
+	}
+	for _, node := range graph.Tasks {
+		if node.State != orchestrator.AdminTaskDone || node.Result == nil {
+			t.Errorf("Задача #%d: ожидалось состояние done с результатом, получено %s %v", node.ID, node.State, node.Result)
+		}
+	}
+
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/admin/expressions/missing", adminToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Неизвестное выражение: ожидался код 404, получен %d", code)
+	}
+}
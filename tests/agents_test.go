@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// findAgent ищет агента в реестре по ID
+func findAgent(id int32) (models.Agent, bool) {
+	for _, agent := range orchestrator.Agents.List() {
+		if agent.ID == id {
+			return agent, true
+		}
+	}
+	return models.Agent{}, false
+}
+
+func TestAgentRegistrationAndHeartbeat(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	client := startBufconnServer(t, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Два контейнера агентов получают разные ID
+	first, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{Hostname: "agent-a", Version: "1.0", Capacity: 4})
+	if err != nil {
+		t.Fatalf("RegisterAgent завершился ошибкой: %v", err)
+	}
+	second, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{Hostname: "agent-b", Version: "1.0", Capacity: 2})
+	if err != nil {
+		t.Fatalf("RegisterAgent завершился ошибкой: %v", err)
+	}
+	if first.AgentId == 0 || first.AgentId == second.AgentId {
+		t.Fatalf("Ожидались разные ненулевые ID, получено %d и %d", first.AgentId, second.AgentId)
+	}
+	if first.HeartbeatIntervalMs <= 0 {
+		t.Errorf("Ожидался положительный интервал heartbeat, получено %d", first.HeartbeatIntervalMs)
+	}
+
+	// Повторная регистрация сохраняет ID
+	again, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{AgentId: first.AgentId, Hostname: "agent-a", Version: "1.1", Capacity: 4})
+	if err != nil || again.AgentId != first.AgentId {
+		t.Fatalf("Повторная регистрация должна сохранить ID %d, получено %d (%v)", first.AgentId, again.GetAgentId(), err)
+	}
+
+	hb, err := client.Heartbeat(ctx, &calculator.HeartbeatRequest{AgentId: first.AgentId})
+	if err != nil || !hb.Known {
+		t.Fatalf("Heartbeat зарегистрированного агента должен быть принят: %v, %v", hb, err)
+	}
+	hb, err = client.Heartbeat(ctx, &calculator.HeartbeatRequest{AgentId: 1 << 30})
+	if err != nil || hb.Known {
+		t.Fatalf("Heartbeat неизвестного агента должен требовать регистрации: %v, %v", hb, err)
+	}
+
+	agent, ok := findAgent(first.AgentId)
+	if !ok || agent.Hostname != "agent-a" || agent.Version != "1.1" || agent.Capacity != 4 || agent.Status != models.AgentStatusOnline {
+		t.Errorf("Неожиданная запись агента в реестре: %+v", agent)
+	}
+
+	saved, err := db.GetAgents()
+	if err != nil || len(saved) != 2 {
+		t.Errorf("В БД ожидалось 2 агента, получено %d (%v)", len(saved), err)
+	}
+}
+
+func TestSilentAgentLeasesReleased(t *testing.T) {
+	prevTimeout := orchestrator.Config.Scheduler.HeartbeatTimeoutMs
+	orchestrator.Config.Scheduler.HeartbeatTimeoutMs = 1000
+	defer func() { orchestrator.Config.Scheduler.HeartbeatTimeoutMs = prevTimeout }()
+
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	client := startBufconnServer(t, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reg, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{Hostname: "agent-c", Capacity: 1})
+	if err != nil {
+		t.Fatalf("RegisterAgent завершился ошибкой: %v", err)
+	}
+
+	exprID := addTestExpression(t, db, "6 * 7")
+	task, err := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: reg.AgentId})
+	if err != nil || task.GetExpressionId() != exprID {
+		t.Fatalf("Агент должен получить задачу выражения %s: %v, %v", exprID, task, err)
+	}
+	if agent, _ := findAgent(reg.AgentId); agent.InFlight != 1 {
+		t.Errorf("Ожидалась одна задача в работе у агента, получено %d", agent.InFlight)
+	}
+
+	// Агент перестал присылать heartbeat: он отключается, а задача возвращается в очередь
+	if silent := orchestrator.Agents.ReleaseSilentAgents(time.Now().Add(2 * time.Second)); silent == 0 {
+		t.Fatal("Агент без heartbeat не отключен")
+	}
+	if agent, _ := findAgent(reg.AgentId); agent.Status != models.AgentStatusOffline || agent.InFlight != 0 {
+		t.Errorf("Ожидался offline агент без задач, получено %+v", agent)
+	}
+
+	fresh := takeTask(t, exprID)
+	if fresh.ID != int(task.GetId()) || fresh.LeaseID == task.GetLeaseId() {
+		t.Errorf("Ожидалась повторная выдача задачи #%d с новой арендой, получено #%d", task.GetId(), fresh.ID)
+	}
+}
+
+func TestAgentCapabilities(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	// Отдельный реестр, чтобы агенты с ограниченными операциями не достались другим тестам
+	prevAgents := orchestrator.Agents
+	orchestrator.Agents = orchestrator.NewAgentRegistry()
+	defer func() { orchestrator.Agents = prevAgents }()
+
+	client := startBufconnServer(t, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Агент без списка операций выполняет только + - * /
+	basic, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{Hostname: "agent-basic", Capacity: 1})
+	if err != nil {
+		t.Fatalf("RegisterAgent завершился ошибкой: %v", err)
+	}
+	power, err := client.RegisterAgent(ctx, &calculator.RegisterAgentRequest{
+		Hostname: "agent-power", Capacity: 1, Operations: []string{"^", "sqrt"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterAgent завершился ошибкой: %v", err)
+	}
+
+	exprID := addTestExpression(t, db, "2 ^ 3")
+	task, err := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: basic.AgentId})
+	if err != nil || task.GetId() != 0 {
+		t.Fatalf("Агенту без поддержки ^ не должна выдаваться задача: %v, %v", task, err)
+	}
+	task, err = client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: power.AgentId})
+	if err != nil || task.GetExpressionId() != exprID || task.GetOperation() != "^" {
+		t.Fatalf("Агент с поддержкой ^ должен получить задачу выражения %s: %v, %v", exprID, task, err)
+	}
+
+	// Задачи остальных агентов ему не выдаются
+	addTestExpression(t, db, "2 + 3")
+	if task, _ := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: power.AgentId}); task.GetId() != 0 {
+		t.Errorf("Агенту без поддержки + выдана задача %v", task)
+	}
+	if task, _ := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: basic.AgentId}); task.GetOperation() != "+" {
+		t.Errorf("Агент без списка операций должен получить задачу +, получено %v", task)
+	}
+
+	saved, err := db.GetAgents()
+	if err != nil || len(saved) != 2 || saved[0].Operations != nil || len(saved[1].Operations) != 2 {
+		t.Errorf("Операции агентов не сохранились в БД: %+v (%v)", saved, err)
+	}
+}
@@ -38,6 +38,28 @@ func TestCalculateHandler(t *testing.T) {
     if status := rr.Code; status != http.StatusUnprocessableEntity {
         t.Errorf("Expected status %v, got %v", http.StatusUnprocessableEntity, status)
     }
+
+    // Тест синтаксической ошибки с указанием позиции
+    reqBody = `{"expression": "2 + * 3"}`
+    req, _ = http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer([]byte(reqBody)))
+    req.Header.Set("Content-Type", "application/json")
+    rr = httptest.NewRecorder()
+    handler.ServeHTTP(rr, req)
+
+    if status := rr.Code; status != http.StatusUnprocessableEntity {
+        t.Errorf("Expected status %v, got %v", http.StatusUnprocessableEntity, status)
+    }
+
+    var parseErr struct {
+        Error    string `json:"error"`
+        Kind     string `json:"kind"`
+        Token    string `json:"token"`
+        Position int    `json:"position"`
+    }
+    json.Unmarshal(rr.Body.Bytes(), &parseErr)
+    if parseErr.Kind != "unexpected_token" || parseErr.Token != "*" || parseErr.Position != 5 {
+        t.Errorf("Unexpected parse error body: %v", rr.Body.String())
+    }
 }
 
 func TestListExpressionsHandler(t *testing.T) {
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func testAPIKeys(t *testing.T, db database.Database) {
+	if err := auth.RegisterUser(db, &models.RegisterRequest{Login: "robot", Password: "password123"}); err != nil {
+		t.Fatalf("Не удалось зарегистрировать пользователя: %v", err)
+	}
+	user, err := db.GetUserByLogin("robot")
+	if err != nil {
+		t.Fatalf("Пользователь не найден: %v", err)
+	}
+
+	raw, key, err := auth.CreateAPIKey(db, user, "batch", 0)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ API: %v", err)
+	}
+	if !strings.HasPrefix(raw, key.Prefix) || key.Hash == raw {
+		t.Errorf("Ключ %q должен начинаться с префикса %q и храниться хешем", raw, key.Prefix)
+	}
+
+	owner, err := auth.AuthenticateAPIKey(db, raw)
+	if err != nil || owner.ID != user.ID {
+		t.Fatalf("Ключ API не принят: %v", err)
+	}
+	keys, err := db.GetAPIKeys(user.ID)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == 0 {
+		t.Fatalf("Ожидался один ключ с временем использования, получено %+v (%v)", keys, err)
+	}
+
+	if err := db.RevokeAPIKey(key.ID, user.ID+1, time.Now().UnixMilli()); err != database.ErrNotFound {
+		t.Errorf("Чужой ключ нельзя отозвать, получено %v", err)
+	}
+	if err := db.RevokeAPIKey(key.ID, user.ID, time.Now().UnixMilli()); err != nil {
+		t.Fatalf("Не удалось отозвать ключ: %v", err)
+	}
+	if _, err := auth.AuthenticateAPIKey(db, raw); err != auth.ErrInvalidAPIKey {
+		t.Errorf("Отозванный ключ должен отклоняться, получено %v", err)
+	}
+
+	expired, _, err := auth.CreateAPIKey(db, user, "short", time.Millisecond)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ API: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := auth.AuthenticateAPIKey(db, expired); err != auth.ErrInvalidAPIKey {
+		t.Errorf("Истекший ключ должен отклоняться, получено %v", err)
+	}
+
+	if _, _, err := auth.CreateAPIKey(db, user, "  ", 0); err != auth.ErrInvalidAPIKeyName {
+		t.Errorf("Ожидалась ошибка %v для пустого имени, получено %v", auth.ErrInvalidAPIKeyName, err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachDB(t, testAPIKeys)
+}
+
+func TestAPIKeysHandler(t *testing.T) {
+	db := database.NewMemoryDB()
+	handlers := orchestrator.NewAuthHandlers(db)
+	handler := handlers.AuthMiddleware(handlers.APIKeysHandler)
+	token := loginToken(t, db, "scripts")
+
+	do := func(method, path string, header, value string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/api/v1/api-keys", "Authorization", "Bearer "+token, models.CreateAPIKeyRequest{Name: "nightly"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Ожидался код 201 при создании ключа, получено %d", rr.Code)
+	}
+	var created models.CreateAPIKeyResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created.Key == "" {
+		t.Fatalf("Ответ должен содержать ключ: %v", err)
+	}
+
+	// Ключ API принимается для обычных запросов, но не для управления ключами
+	if rr := do(http.MethodGet, "/api/v1/api-keys", "X-API-Key", created.Key, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Ключ API не должен управлять ключами, получено %d", rr.Code)
+	}
+
+	rr = do(http.MethodGet, "/api/v1/api-keys", "Authorization", "Bearer "+token, nil)
+	var list map[string][]models.APIKey
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list["api_keys"]) != 1 {
+		t.Fatalf("Ожидался один ключ в списке: %v", err)
+	}
+	if strings.Contains(rr.Body.String(), created.Key) {
+		t.Error("Список не должен содержать сам ключ")
+	}
+
+	path := "/api/v1/api-keys/" + strconv.Itoa(created.APIKey.ID)
+	if rr := do(http.MethodDelete, path, "Authorization", "Bearer "+token, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Ожидался код 200 при отзыве ключа, получено %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/api/v1/api-keys", "X-API-Key", created.Key, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Отозванный ключ должен отклоняться, получено %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/api/v1/api-keys/999", "Authorization", "Bearer "+token, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код 404 для несуществующего ключа, получено %d", rr.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/config"
+)
+
+// writeConfigFile создает файл конфигурации во временном каталоге теста
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Не удалось записать файл конфигурации: %v", err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+http:
+  port: 9000
+grpc:
+  port: 9001
+database:
+  path: /var/lib/calculator.db
+operations:
+  addition_ms: 5
+`)
+	t.Setenv("GRPC_PORT", "9101")
+	t.Setenv("TIME_ADDITION_MS", "7")
+	t.Setenv("ADMIN_LOGINS", "root, admin")
+
+	cfg, err := config.Load([]string{"--config", path, "--time-addition-ms", "9", "--port", "9200"})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+
+	// Флаги важнее окружения, окружение важнее файла, файл важнее значений по умолчанию
+	checks := []struct {
+		key    string
+		got    int
+		want   int
+		source string
+	}{
+		{"http.port", cfg.HTTP.Port, 9200, "flag:--port"},
+		{"grpc.port", cfg.GRPC.Port, 9101, "env:GRPC_PORT"},
+		{"operations.addition_ms", cfg.Operations.AdditionMs, 9, "flag:--time-addition-ms"},
+		{"operations.division_ms", cfg.Operations.DivisionMs, 200, "default"},
+		{"shutdown.server_grace_ms", cfg.Shutdown.ServerGraceMs, 5000, "default"},
+	}
+	for _, c := range checks {
+		if c.got != c.want || cfg.Source(c.key) != c.source {
+			t.Errorf("%s: ожидалось %d (%s), получено %d (%s)", c.key, c.want, c.source, c.got, cfg.Source(c.key))
+		}
+	}
+	if cfg.Database.Path != "/var/lib/calculator.db" || cfg.Source("database.path") != "file" {
+		t.Errorf("Путь к БД должен браться из файла, получено %s (%s)", cfg.Database.Path, cfg.Source("database.path"))
+	}
+	if strings.Join(cfg.Auth.AdminLogins, ",") != "root,admin" {
+		t.Errorf("Ожидались администраторы root,admin, получено %v", cfg.Auth.AdminLogins)
+	}
+	if cfg.AgentServer() != "localhost:9101" {
+		t.Errorf("Адрес оркестратора для агента должен строиться по grpc.port, получено %s", cfg.AgentServer())
+	}
+}
+
+func TestConfigTOMLAndValidation(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[auth]
+jwt_secret = "toml-secret"
+
+[agent]
+computing_power = 8
+use_http = true
+`)
+	cfg, err := config.Load([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки TOML: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "toml-secret" || cfg.Agent.ComputingPower != 8 || !cfg.Agent.UseHTTP {
+		t.Errorf("Значения из TOML не применены: %+v %+v", cfg.Auth, cfg.Agent)
+	}
+
+	// Секреты не попадают в вывод --print-config, источник указан в комментарии
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Ошибка вывода конфигурации: %v", err)
+	}
+	if strings.Contains(out.String(), "toml-secret") || !strings.Contains(out.String(), "computing_power: 8 # file") {
+		t.Errorf("Неожиданный вывод конфигурации:\n%s", out.String())
+	}
+
+	invalid := []struct {
+		name string
+		args []string
+		file string
+	}{
+		{"неверный порт", []string{"--grpc-port", "70000"}, ""},
+		{"отрицательное время", []string{"--time-divisions-ms", "-1"}, ""},
+		{"нулевой срок остановки серверов", []string{"--shutdown-server-grace-ms", "0"}, ""},
+		{"не число", []string{"--http-port", "abc"}, ""},
+		{"пустой секрет", []string{"--jwt-secret", " "}, ""},
+		{"неизвестный ключ", nil, writeConfigFile(t, "typo.yaml", "grpc:\n  prot: 1\n")},
+		{"неизвестный формат", nil, writeConfigFile(t, "config.json", "{}")},
+	}
+	for _, tc := range invalid {
+		args := tc.args
+		if tc.file != "" {
+			args = append(args, "--config", tc.file)
+		}
+		if _, err := config.Load(args); err == nil {
+			t.Errorf("%s: ожидалась ошибка конфигурации", tc.name)
+		}
+	}
+}
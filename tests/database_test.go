@@ -84,9 +84,12 @@ func TestDatabaseOperations(t *testing.T) {
 	// Тестируем сохранение выражения
 	t.Run("SaveExpression", func(t *testing.T) {
 		expr := &models.Expression{
-			ID:     "test_expr_1",
-			Status: "pending",
-			UserID: 1,
+			ID:         "test_expr_1",
+			Status:     "pending",
+			UserID:     1,
+			Expression: "2+2*2",
+			Normalized: "2 + 2 * 2",
+			TaskCount:  2,
 		}
 
 		err := db.SaveExpression(expr)
@@ -109,11 +112,16 @@ func TestDatabaseOperations(t *testing.T) {
 		if expr.Status != "pending" {
 			t.Errorf("Неверный статус выражения: %s", expr.Status)
 		}
+
+		if expr.Expression != "2+2*2" || expr.Normalized != "2 + 2 * 2" || expr.TaskCount != 2 {
+			t.Errorf("Неверные данные выражения: expression=%q normalized=%q task_count=%d",
+				expr.Expression, expr.Normalized, expr.TaskCount)
+		}
 	})
 
 	// Тестируем обновление статуса выражения
 	t.Run("UpdateExpressionStatus", func(t *testing.T) {
-		err := db.UpdateExpressionStatus("test_expr_1", "completed", 42.0)
+		err := db.UpdateExpressionStatus("test_expr_1", "completed", 42.0, "")
 		if err != nil {
 			t.Fatalf("Не удалось обновить статус выражения: %v", err)
 		}
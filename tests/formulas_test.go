@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func TestValidateFormula(t *testing.T) {
+	if err := orchestrator.ValidateFormula("net_price", "price * (1 - discount) + max(fee, 0)", []string{"price", "discount", "fee"}); err != nil {
+		t.Errorf("Неожиданная ошибка проверки формулы: %v", err)
+	}
+	// Нулевые значения параметров не мешают сохранить формулу с делением на параметр
+	if err := orchestrator.ValidateFormula("share", "part / total", []string{"part", "total"}); err != nil {
+		t.Errorf("Неожиданная ошибка проверки формулы: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		expression string
+		parameters []string
+		kind       orchestrator.ParseErrorKind // Пусто для ошибок имени формулы и списка параметров
+	}{
+		{"1st", "x + 1", []string{"x"}, ""},
+		{"dup", "x + 1", []string{"x", "x"}, ""},
+		{"undeclared", "x + y", []string{"x"}, orchestrator.ErrKindUnknownIdentifier},
+		{"reserved", "sqrt + 1", []string{"sqrt"}, orchestrator.ErrKindInvalidVariable},
+		{"broken", "x +", []string{"x"}, orchestrator.ErrKindUnexpectedEnd},
+	}
+	for _, c := range cases {
+		err := orchestrator.ValidateFormula(c.name, c.expression, c.parameters)
+		var parseErr *orchestrator.ParseError
+		if err == nil || errors.As(err, &parseErr) != (c.kind != "") || (parseErr != nil && parseErr.Kind != c.kind) {
+			t.Errorf("%s = %q %v: ожидалась ошибка %q, получено %v", c.name, c.expression, c.parameters, c.kind, err)
+		}
+	}
+}
+
+func testFormulas(t *testing.T, db database.Database) {
+	orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	handlers := orchestrator.NewAuthHandlers(db)
+	handler := handlers.AuthMiddleware(handlers.FormulasHandler)
+	token := loginToken(t, db, "analyst")
+	other := loginToken(t, db, "intern")
+
+	create := models.FormulaRequest{Name: "net_price", Expression: "price * (1 - discount) + fee", Parameters: []string{"price", "discount", "fee"}}
+	var created struct {
+		Formula models.Formula `json:"formula"`
+	}
+	if code := apiRequest(t, handler, http.MethodPost, "/api/v1/formulas", token, create, &created); code != http.StatusCreated {
+		t.Fatalf("Формула должна быть сохранена, получено %d", code)
+	}
+	if created.Formula.ID == 0 || !reflect.DeepEqual(created.Formula.Parameters, create.Parameters) {
+		t.Errorf("Неожиданная сохраненная формула: %+v", created.Formula)
+	}
+	if code := apiRequest(t, handler, http.MethodPost, "/api/v1/formulas", token, create, nil); code != http.StatusConflict {
+		t.Errorf("Ожидался код 409 для повторного имени, получено %d", code)
+	}
+	// Имена формул у разных пользователей не пересекаются
+	if code := apiRequest(t, handler, http.MethodPost, "/api/v1/formulas", other, create, nil); code != http.StatusCreated {
+		t.Errorf("Другой пользователь должен сохранить формулу с тем же именем, получено %d", code)
+	}
+	invalid := models.FormulaRequest{Name: "tax", Expression: "price * rate", Parameters: []string{"price"}}
+	if code := apiRequest(t, handler, http.MethodPost, "/api/v1/formulas", token, invalid, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался код 422 для необъявленного параметра, получено %d", code)
+	}
+
+	// Вычисление отправляет выражение формулы со значениями параметров
+	args := map[string]float64{"price": 200, "discount": 0.25, "fee": 5}
+	var submitted map[string]string
+	code := apiRequest(t, handler, http.MethodPost, "/api/v1/formulas/net_price/evaluate", token,
+		models.EvaluateFormulaRequest{Arguments: args}, &submitted)
+	if code != http.StatusCreated || submitted["id"] == "" {
+		t.Fatalf("Формула должна быть отправлена на вычисление, получено %d %v", code, submitted)
+	}
+	expr, err := db.GetExpression(submitted["id"], created.Formula.UserID)
+	if err != nil || expr.Expression != create.Expression || !reflect.DeepEqual(expr.Variables, args) {
+		t.Errorf("Неожиданное выражение вычисления формулы: %+v (%v)", expr, err)
+	}
+
+	failures := []struct {
+		path string
+		args map[string]float64
+		code int
+	}{
+		{"/api/v1/formulas/net_price/evaluate", map[string]float64{"price": 200, "discount": 0.25}, http.StatusUnprocessableEntity},
+		{"/api/v1/formulas/net_price/evaluate", map[string]float64{"price": 200, "discount": 0.25, "fee": 5, "tax": 1}, http.StatusUnprocessableEntity},
+		{"/api/v1/formulas/missing/evaluate", nil, http.StatusNotFound},
+	}
+	for _, c := range failures {
+		if code := apiRequest(t, handler, http.MethodPost, c.path, token, models.EvaluateFormulaRequest{Arguments: c.args}, nil); code != c.code {
+			t.Errorf("%s %v: ожидался код %d, получено %d", c.path, c.args, c.code, code)
+		}
+	}
+
+	// Список показывает последнее вычисление каждой формулы
+	var list struct {
+		Formulas []models.Formula `json:"formulas"`
+	}
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/formulas", token, nil, &list); code != http.StatusOK || len(list.Formulas) != 1 {
+		t.Fatalf("Ожидалась одна формула в списке, получено %d %+v", code, list)
+	}
+	last := list.Formulas[0].LastEvaluation
+	if list.Formulas[0].LastExpressionID != submitted["id"] || last == nil || last.ID != submitted["id"] || last.Status != "pending" {
+		t.Errorf("Неожиданное последнее вычисление: %+v", list.Formulas[0])
+	}
+
+	// Изменение формулы сохраняет ее имя, удаленная формула больше не доступна
+	update := models.FormulaRequest{Expression: "price * (1 - discount)", Parameters: []string{"price", "discount"}}
+	if code := apiRequest(t, handler, http.MethodPut, "/api/v1/formulas/net_price", token, update, &created); code != http.StatusOK {
+		t.Fatalf("Формула должна быть изменена, получено %d", code)
+	}
+	if created.Formula.Name != "net_price" || created.Formula.Expression != update.Expression || len(created.Formula.Parameters) != 2 {
+		t.Errorf("Неожиданная измененная формула: %+v", created.Formula)
+	}
+	if code := apiRequest(t, handler, http.MethodDelete, "/api/v1/formulas/net_price", token, nil, nil); code != http.StatusOK {
+		t.Errorf("Формула должна быть удалена, получено %d", code)
+	}
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/formulas/net_price", token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Ожидался код 404 для удаленной формулы, получено %d", code)
+	}
+	if code := apiRequest(t, handler, http.MethodGet, "/api/v1/formulas/net_price", other, nil, nil); code != http.StatusOK {
+		t.Errorf("Формула другого пользователя не должна быть удалена, получено %d", code)
+	}
+}
+
+func TestFormulas(t *testing.T) {
+	defer func() { orchestrator.Quotas = orchestrator.NewQuotaTracker() }()
+
+	forEachDB(t, testFormulas)
+}
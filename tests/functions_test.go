@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/agent"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func TestParseFunctions(t *testing.T) {
+	cases := []struct {
+		expr string
+		ops  []string
+		args [][]string
+	}{
+		{"sqrt(16)", []string{"sqrt"}, [][]string{{"16"}}},
+		{"max(1, 2*3, 4)", []string{"*", "max"}, [][]string{nil, {"1", "result1", "4"}}},
+		{"min(1,5)", []string{"min"}, [][]string{{"1", "5"}}},
+		{"min((1,5))", []string{"min"}, [][]string{{"1.5"}}},
+		{"max(1; 2)", []string{"max"}, [][]string{{"1", "2"}}},
+		{"2 * abs(-3)", []string{"abs", "*"}, [][]string{{"-3"}, nil}},
+		{"log(8, 2) + round(sin(1))", []string{"log", "sin", "round", "+"}, [][]string{{"8", "2"}, {"1"}, {"result2"}, nil}},
+	}
+
+	for _, c := range cases {
+		tasks, err := orchestrator.ParseExpression(c.expr)
+		if err != nil {
+			t.Errorf("%q: неожиданная ошибка разбора: %v", c.expr, err)
+			continue
+		}
+		if len(tasks) != len(c.ops) {
+			t.Errorf("%q: ожидалось %d задач, получено %d: %+v", c.expr, len(c.ops), len(tasks), tasks)
+			continue
+		}
+		for i, task := range tasks {
+			if task.Operation != c.ops[i] || !reflect.DeepEqual(task.Args, c.args[i]) {
+				t.Errorf("%q: задача %d = %s%v, ожидалось %s%v", c.expr, i+1, task.Operation, task.Args, c.ops[i], c.args[i])
+			}
+		}
+	}
+
+	root, err := orchestrator.Parse("max(1,2)+sqrt((4))")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка разбора: %v", err)
+	}
+	if got := orchestrator.FormatNode(root); got != "max(1, 2) + sqrt(4)" {
+		t.Errorf("Каноническая запись %q", got)
+	}
+}
+
+func TestParseFunctionsInvalid(t *testing.T) {
+	cases := []struct {
+		expr     string
+		kind     orchestrator.ParseErrorKind
+		position int
+	}{
+		{"foo(1)", orchestrator.ErrKindUnknownFunction, 1},
+		{"x + 1", orchestrator.ErrKindUnknownIdentifier, 1},
+		{"sqrt 4", orchestrator.ErrKindUnexpectedToken, 6},
+		{"2 + sqrt(1, 2)", orchestrator.ErrKindArgumentCount, 5},
+		{"min()", orchestrator.ErrKindArgumentCount, 1},
+		{"max(1, 2", orchestrator.ErrKindUnbalancedParenthesis, 4},
+		{"max(1 2)", orchestrator.ErrKindUnexpectedToken, 7},
+		{"1, 2", orchestrator.ErrKindInvalidCharacter, 2},
+	}
+
+	for _, c := range cases {
+		_, err := orchestrator.ParseExpression(c.expr)
+		var parseErr *orchestrator.ParseError
+		if !errors.As(err, &parseErr) || parseErr.Kind != c.kind || parseErr.Position != c.position {
+			t.Errorf("%q: ожидалась ошибка %s в позиции %d, получено %v", c.expr, c.kind, c.position, err)
+		}
+	}
+}
+
+func TestApplyFunction(t *testing.T) {
+	cases := []struct {
+		name string
+		args []float64
+		want float64
+	}{
+		{"sqrt", []float64{16}, 4},
+		{"abs", []float64{-2.5}, 2.5},
+		{"sin", []float64{0}, 0},
+		{"cos", []float64{0}, 1},
+		{"log", []float64{math.E}, 1},
+		{"log", []float64{8, 2}, 3},
+		{"min", []float64{3, -1, 2}, -1},
+		{"max", []float64{7}, 7},
+		{"round", []float64{2.5}, 3},
+		{"round", []float64{-2.5}, -3},
+		{"round", []float64{3.14159, 2}, 3.14},
+	}
+	for _, c := range cases {
+		got, err := agent.Evaluate(c.name, c.args)
+		if err != nil || math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%s%v = %v (%v), ожидалось %v", c.name, c.args, got, err, c.want)
+		}
+	}
+
+	failures := []struct {
+		name string
+		args []float64
+		code string
+	}{
+		{"sqrt", []float64{-1}, models.TaskErrorDomain},
+		{"log", []float64{0}, models.TaskErrorDomain},
+		{"log", []float64{4, 1}, models.TaskErrorDomain},
+		{"round", []float64{1, 0.5}, models.TaskErrorDomain},
+		{"sqrt", []float64{1, 2}, models.TaskErrorInvalidArgument},
+		{"tan", []float64{1}, models.TaskErrorUnknownOperation},
+	}
+	for _, c := range failures {
+		_, err := agent.Evaluate(c.name, c.args)
+		var computeErr *agent.ComputeError
+		if !errors.As(err, &computeErr) || computeErr.Code != c.code {
+			t.Errorf("%s%v: ожидалась ошибка %s, получено %v", c.name, c.args, c.code, err)
+		}
+	}
+}
+
+// computeTestTask вычисляет задачу так же, как агент
+func computeTestTask(task models.Task) models.TaskResult {
+	args := make([]float64, 0, len(task.Operands()))
+	for _, operand := range task.Operands() {
+		value, err := strconv.ParseFloat(operand, 64)
+		if err != nil {
+			return models.TaskResult{ID: task.ID, LeaseID: task.LeaseID, ErrorCode: models.TaskErrorInvalidArgument, Error: err.Error()}
+		}
+		args = append(args, value)
+	}
+	value, err := agent.Evaluate(task.Operation, args)
+	if err != nil {
+		var computeErr *agent.ComputeError
+		errors.As(err, &computeErr)
+		return models.TaskResult{ID: task.ID, LeaseID: task.LeaseID, ErrorCode: computeErr.Code, Error: err.Error()}
+	}
+	return models.TaskResult{ID: task.ID, Result: value, LeaseID: task.LeaseID}
+}
+
+func TestManagerEvaluatesFunctions(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+
+	// Аргументы функции подставляются из результатов зависимых задач
+	exprID := addTestExpression(t, db, "max(1 + 2, sqrt(16), 2)")
+	for i := 0; i < 3; i++ {
+		task := takeTask(t, exprID)
+		if err := orchestrator.Manager.AddResult(computeTestTask(task)); err != nil {
+			t.Fatalf("Результат задачи #%d не принят: %v", task.ID, err)
+		}
+	}
+	expr, _ := orchestrator.Manager.GetExpression(exprID)
+	if expr.Status != "completed" || expr.Result != 4 {
+		t.Errorf("Ожидалось completed/4, получено %s/%v", expr.Status, expr.Result)
+	}
+
+	// Ошибка области определения завершает выражение с ошибкой
+	exprID = addTestExpression(t, db, "sqrt(0 - 4) + 1")
+	for i := 0; i < 2; i++ {
+		task := takeTask(t, exprID)
+		if task.IsFunction() && !reflect.DeepEqual(task.Args, []string{"-4"}) {
+			t.Errorf("Ожидалась подстановка результата в аргумент функции, получено %v", task.Args)
+		}
+		if err := orchestrator.Manager.AddResult(computeTestTask(task)); err != nil {
+			t.Fatalf("Результат задачи #%d не принят: %v", task.ID, err)
+		}
+	}
+	expr, _ = orchestrator.Manager.GetExpression(exprID)
+	if expr.Status != "error" || !strings.Contains(expr.Error, "корень из отрицательного числа") {
+		t.Errorf("Ожидалась ошибка области определения, получено %s/%q", expr.Status, expr.Error)
+	}
+}
+
+func TestFunctionTasksPersisted(t *testing.T) {
+	dbPath := "./test_functions.sqlite"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Не удалось создать базу данных: %v", err)
+	}
+	defer db.Close()
+	if err := db.MigrateDB(); err != nil {
+		t.Fatalf("Не удалось выполнить миграции: %v", err)
+	}
+
+	expr, tasks, err := orchestrator.NewExpression("min(1, 2, 3 * 4)")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка разбора: %v", err)
+	}
+	if err := db.SaveExpression(expr); err != nil {
+		t.Fatalf("Не удалось сохранить выражение: %v", err)
+	}
+	for i := range tasks {
+		tasks[i].ExpressionID = expr.ID
+	}
+	if err := db.SaveTasks(tasks); err != nil {
+		t.Fatalf("Не удалось сохранить задачи: %v", err)
+	}
+
+	stored, err := db.GetTasksByExprID(expr.ID)
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("Ожидалось 2 задачи, получено %d (%v)", len(stored), err)
+	}
+	if stored[0].Args != nil || !reflect.DeepEqual(stored[1].Args, []string{"1", "2", "result1"}) {
+		t.Errorf("Аргументы функции не сохранились: %v, %v", stored[0].Args, stored[1].Args)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startBufconnConn запускает CalculatorServer в памяти так же, как StartGRPCServer,
+// и возвращает подключенное к нему соединение
+func startBufconnConn(t *testing.T, db database.Database) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(orchestrator.MetricsServerOptions()...)
+	calculator.RegisterCalculatorServer(server, orchestrator.NewCalculatorServer(db, nil, nil))
+	orchestrator.RegisterHealthService(server)
+	go orchestrator.ServeGRPC(server, lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Не удалось подключиться к gRPC серверу: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// startBufconnServer запускает CalculatorServer в памяти и возвращает подключенного клиента
+func startBufconnServer(t *testing.T, db database.Database) calculator.CalculatorClient {
+	return calculator.NewCalculatorClient(startBufconnConn(t, db))
+}
+
+func TestGRPCGetTaskSubmitResult(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	client := startBufconnServer(t, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Пустая очередь: сервер возвращает пустую задачу
+	empty, err := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: 1})
+	if err != nil {
+		t.Fatalf("GetTask завершился ошибкой: %v", err)
+	}
+	if empty.GetId() != 0 {
+		t.Fatalf("Ожидалась пустая задача, получена #%d", empty.GetId())
+	}
+
+	exprID := addTestExpression(t, db, "6 * 7")
+
+	task, err := client.GetTask(ctx, &calculator.GetTaskRequest{AgentId: 1})
+	if err != nil {
+		t.Fatalf("GetTask завершился ошибкой: %v", err)
+	}
+	if task.GetOperation() != "*" || task.GetArg1() != "6" || task.GetArg2() != "7" ||
+		task.GetExpressionId() != exprID || task.GetLeaseId() == "" {
+		t.Fatalf("Получена неожиданная задача: %v", task)
+	}
+
+	resp, err := client.SubmitResult(ctx, &calculator.TaskResult{
+		Id: task.GetId(), Result: 42, ExpressionId: exprID, LeaseId: task.GetLeaseId(),
+	})
+	if err != nil {
+		t.Fatalf("SubmitResult завершился ошибкой: %v", err)
+	}
+	if !resp.GetSuccess() {
+		t.Fatalf("Результат не принят: %s", resp.GetMessage())
+	}
+
+	// Повторная отправка: задача уже выполнена
+	resp, err = client.SubmitResult(ctx, &calculator.TaskResult{
+		Id: task.GetId(), Result: 42, ExpressionId: exprID, LeaseId: task.GetLeaseId(),
+	})
+	if err != nil {
+		t.Fatalf("SubmitResult завершился ошибкой: %v", err)
+	}
+	if resp.GetSuccess() {
+		t.Error("Повторный результат выполненной задачи не должен приниматься")
+	}
+
+	if expr, _ := orchestrator.Manager.GetExpression(exprID); expr.Status != "completed" || expr.Result != 42 {
+		t.Errorf("Ожидалось completed/42, получено %s/%v", expr.Status, expr.Result)
+	}
+}
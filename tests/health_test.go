@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// readyz запрашивает /readyz и возвращает код ответа и состояние проверок
+func readyz(t *testing.T, db database.Database) (int, map[string]string) {
+	rr := httptest.NewRecorder()
+	orchestrator.ReadyzHandler(db)(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body struct {
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Ошибка декодирования ответа /readyz: %v", err)
+	}
+	return rr.Code, body.Checks
+}
+
+func TestReadinessChecks(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "health.db"))
+	if err != nil {
+		t.Fatalf("Не удалось создать базу данных: %v", err)
+	}
+	if err := db.MigrateDB(); err != nil {
+		t.Fatalf("Не удалось выполнить миграции: %v", err)
+	}
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	// gRPC сервер еще не запущен (серверы предыдущих тестов останавливаются асинхронно)
+	code, checks := readyz(t, db)
+	for deadline := time.Now().Add(2 * time.Second); code == http.StatusOK && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		code, checks = readyz(t, db)
+	}
+	if code != http.StatusServiceUnavailable || checks[orchestrator.CheckGRPC] == "ok" {
+		t.Fatalf("Без gRPC сервера ожидался код 503, получен %d: %v", code, checks)
+	}
+
+	conn := startBufconnConn(t, db)
+	health := healthpb.NewHealthClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// До первой проверки готовности агенты видят NOT_SERVING
+	if resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("Ожидался NOT_SERVING до проверки готовности: %v, %v", resp, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !orchestrator.UpdateGRPCHealth(db) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code, checks := readyz(t, db); code != http.StatusOK {
+		t.Fatalf("Ожидался код 200, получен %d: %v", code, checks)
+	}
+	if resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "calculator.Calculator"}); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Ожидался SERVING для готового оркестратора: %v, %v", resp, err)
+	}
+
+	// БД перестала отвечать
+	db.Close()
+	if code, checks := readyz(t, db); code != http.StatusServiceUnavailable || checks[orchestrator.CheckDatabase] == "ok" {
+		t.Errorf("С закрытой БД ожидался код 503, получен %d: %v", code, checks)
+	}
+	orchestrator.UpdateGRPCHealth(db)
+	if resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("С закрытой БД ожидался NOT_SERVING: %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// loginToken регистрирует пользователя и возвращает его JWT токен
+func loginToken(t *testing.T, db database.Database, login string) string {
+	req := &models.RegisterRequest{Login: login, Password: "password123"}
+	if err := auth.RegisterUser(db, req); err != nil {
+		t.Fatalf("Не удалось зарегистрировать пользователя %s: %v", login, err)
+	}
+	token, err := auth.LoginUser(db, &models.LoginRequest{Login: login, Password: "password123"})
+	if err != nil {
+		t.Fatalf("Не удалось войти пользователем %s: %v", login, err)
+	}
+	return token
+}
+
+// forEachDB запускает test на in-memory БД и на SQLite во временном каталоге
+func forEachDB(t *testing.T, test func(t *testing.T, db database.Database)) {
+	t.Run("Memory", func(t *testing.T) {
+		test(t, database.NewMemoryDB())
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		db, err := database.New(filepath.Join(t.TempDir(), "test.sqlite"))
+		if err != nil {
+			t.Fatalf("Не удалось создать базу данных: %v", err)
+		}
+		defer db.Close()
+		if err := db.MigrateDB(); err != nil {
+			t.Fatalf("Не удалось выполнить миграции: %v", err)
+		}
+		test(t, db)
+	})
+}
+
+// serveAPI выполняет запрос к handler с токеном token (если он задан) и телом body в JSON
+func serveAPI(handler http.HandlerFunc, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// apiRequest выполняет запрос через serveAPI, декодирует успешный ответ в out и возвращает код ответа
+func apiRequest(t *testing.T, handler http.HandlerFunc, method, path, token string, body, out interface{}) int {
+	t.Helper()
+	rr := serveAPI(handler, method, path, token, body)
+	if out != nil && rr.Code < http.StatusMultipleChoices {
+		if err := json.NewDecoder(rr.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: ошибка декодирования ответа: %v", method, path, err)
+		}
+	}
+	return rr.Code
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEM сохраняет ключ в PEM файл во временном каталоге теста
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Не удалось записать ключ: %v", err)
+	}
+	return path
+}
+
+// configureAuth применяет настройки JWT, после теста возвращаются настройки по умолчанию
+func configureAuth(t *testing.T, cfg config.Auth) {
+	if err := auth.Configure(cfg); err != nil {
+		t.Fatalf("Ошибка загрузки ключей JWT: %v", err)
+	}
+	t.Cleanup(func() { auth.Configure(config.Default().Auth) })
+}
+
+// fetchJWKS запрашивает открытые ключи оркестратора
+func fetchJWKS(t *testing.T) auth.JWKS {
+	rr := httptest.NewRecorder()
+	auth.JWKSHandler(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set auth.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&set); err != nil {
+		t.Fatalf("Ошибка декодирования JWKS: %v", err)
+	}
+	return set
+}
+
+// tokenHeader возвращает заголовок токена без проверки подписи
+func tokenHeader(t *testing.T, token string) map[string]interface{} {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &auth.Claims{})
+	if err != nil {
+		t.Fatalf("Не удалось разобрать токен: %v", err)
+	}
+	return parsed.Header
+}
+
+func TestJWTAsymmetricKeysAndRotation(t *testing.T) {
+	user := &models.User{ID: 42, Login: "rotation"}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Не удалось создать ключ RSA: %v", err)
+	}
+	rsaPublicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaPrivate := writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	rsaPublic := writePEM(t, "rsa.pub.pem", "PUBLIC KEY", rsaPublicDER)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPrivate := writePEM(t, "ed25519.pem", "PRIVATE KEY", edDER)
+
+	// RS256: токен содержит kid, открытый ключ публикуется в JWKS
+	cfg := config.Default().Auth
+	cfg.Algorithm, cfg.PrivateKeyFile = auth.AlgorithmRS256, rsaPrivate
+	configureAuth(t, cfg)
+
+	rsaToken, err := auth.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("Не удалось создать токен RS256: %v", err)
+	}
+	header := tokenHeader(t, rsaToken)
+	rsaKid, _ := header["kid"].(string)
+	if header["alg"] != "RS256" || rsaKid == "" {
+		t.Fatalf("Ожидался заголовок RS256 с kid, получено %v", header)
+	}
+	if claims, err := auth.ValidateToken(rsaToken); err != nil || claims.UserID != user.ID {
+		t.Fatalf("Токен RS256 не прошел проверку: %v", err)
+	}
+	if keys := fetchJWKS(t).Keys; len(keys) != 1 || keys[0].Kid != rsaKid || keys[0].Kty != "RSA" || keys[0].N == "" {
+		t.Errorf("В JWKS ожидался ключ RSA %s, получено %+v", rsaKid, keys)
+	}
+
+	// Токены HS256 не принимаются, в том числе подписанные открытым ключом (подмена алгоритма)
+	claims := &auth.Claims{UserID: user.ID, Login: user.Login, RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.DefaultJWTSecret))
+	if _, err := auth.ValidateToken(legacy); err == nil {
+		t.Error("Токен HS256 с секретом по умолчанию не должен приниматься при RS256")
+	}
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = rsaKid
+	confusedToken, _ := confused.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDER}))
+	if _, err := auth.ValidateToken(confusedToken); err == nil {
+		t.Error("Токен HS256, подписанный открытым ключом RSA, не должен приниматься")
+	}
+
+	// Смена ключа на EdDSA: прежние токены проверяются по открытому ключу RSA
+	cfg.Algorithm, cfg.PrivateKeyFile = auth.AlgorithmEdDSA, edPrivate
+	cfg.VerificationKeyFiles = []string{rsaPublic}
+	configureAuth(t, cfg)
+
+	if _, err := auth.ValidateToken(rsaToken); err != nil {
+		t.Errorf("Токен прежнего ключа должен проверяться во время смены ключа: %v", err)
+	}
+	edToken, _ := auth.GenerateToken(user)
+	header = tokenHeader(t, edToken)
+	if header["alg"] != "EdDSA" || header["kid"] == rsaKid {
+		t.Errorf("Новые токены должны подписываться ключом EdDSA, получено %v", header)
+	}
+	if _, err := auth.ValidateToken(edToken); err != nil {
+		t.Errorf("Токен EdDSA не прошел проверку: %v", err)
+	}
+	keys := fetchJWKS(t).Keys
+	if len(keys) != 2 || keys[0].Kty != "OKP" || keys[0].Crv != "Ed25519" || keys[1].Kid != rsaKid {
+		t.Errorf("В JWKS ожидались текущий ключ Ed25519 и прежний RSA, получено %+v", keys)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = "unknown"
+	unknownToken, _ := unknown.SignedString(edKey)
+	if _, err := auth.ValidateToken(unknownToken); err == nil {
+		t.Error("Токен с неизвестным kid не должен приниматься")
+	}
+
+	// После завершения смены прежний ключ удаляется, и его токены перестают приниматься
+	cfg.VerificationKeyFiles = nil
+	configureAuth(t, cfg)
+	if _, err := auth.ValidateToken(rsaToken); err == nil {
+		t.Error("Токен удаленного ключа не должен приниматься")
+	}
+}
+
+func TestJWTSecretRotation(t *testing.T) {
+	user := &models.User{ID: 7, Login: "secret"}
+
+	cfg := config.Default().Auth
+	cfg.JWTSecretFile = filepath.Join(t.TempDir(), "jwt_secret")
+	if err := os.WriteFile(cfg.JWTSecretFile, []byte("first-secret\n"), 0o600); err != nil {
+		t.Fatalf("Не удалось записать секрет: %v", err)
+	}
+	configureAuth(t, cfg)
+	oldToken, _ := auth.GenerateToken(user)
+
+	cfg.JWTSecretFile, cfg.JWTSecret = "", "second-secret"
+	cfg.PreviousSecrets = []string{"first-secret"}
+	configureAuth(t, cfg)
+	if _, err := auth.ValidateToken(oldToken); err != nil {
+		t.Errorf("Токен прежнего секрета должен приниматься: %v", err)
+	}
+	newToken, _ := auth.GenerateToken(user)
+	if tokenHeader(t, newToken)["kid"] == tokenHeader(t, oldToken)["kid"] {
+		t.Error("У нового секрета должен быть другой kid")
+	}
+	if keys := fetchJWKS(t).Keys; len(keys) != 0 {
+		t.Errorf("Секреты HMAC не должны публиковаться в JWKS, получено %+v", keys)
+	}
+
+	cfg.PreviousSecrets = nil
+	configureAuth(t, cfg)
+	if _, err := auth.ValidateToken(oldToken); err == nil {
+		t.Error("Токен удаленного секрета не должен приниматься")
+	}
+
+	cfg.Algorithm, cfg.PrivateKeyFile = auth.AlgorithmRS256, ""
+	if err := auth.Configure(cfg); err == nil {
+		t.Error("RS256 без закрытого ключа должен приводить к ошибке")
+	}
+}
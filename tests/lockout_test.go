@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func TestCredentialPolicy(t *testing.T) {
+	for _, login := range []string{"ab", "1user", "user name", "очень"} {
+		if err := auth.ValidateLogin(login); err == nil {
+			t.Errorf("Логин %q должен быть отклонен", login)
+		}
+	}
+	if err := auth.ValidateLogin("user_1.test"); err != nil {
+		t.Errorf("Логин должен быть принят: %v", err)
+	}
+
+	var policyErr *auth.PolicyError
+	if err := auth.ValidatePassword("short"); !errors.As(err, &policyErr) || len(policyErr.Problems) != 2 {
+		t.Errorf("Ожидались нарушения длины и отсутствия цифр, получено %v", err)
+	}
+	if err := auth.ValidatePassword("longpassword1"); err != nil {
+		t.Errorf("Пароль должен быть принят: %v", err)
+	}
+
+	db := database.NewMemoryDB()
+	err := auth.RegisterUser(db, &models.RegisterRequest{Login: "weak", Password: "password"})
+	if !errors.As(err, &policyErr) || policyErr.Field != "password" {
+		t.Errorf("Регистрация со слабым паролем должна быть отклонена, получено %v", err)
+	}
+
+	handlers := orchestrator.NewAuthHandlers(db)
+	body, _ := json.Marshal(models.RegisterRequest{Login: "x", Password: "password123"})
+	rr := httptest.NewRecorder()
+	handlers.RegisterHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/register", bytes.NewReader(body)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался код 422 для неверного логина, получено %d", rr.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	cfg := config.Default().Auth
+	cfg.MaxFailedLogins = 3
+	cfg.MaxFailedLoginsPerIP = 5
+	limiter := auth.NewLoginLimiter(cfg)
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+	auth.SetLoginLimiter(limiter)
+	defer auth.SetLoginLimiter(auth.NewLoginLimiter(config.Default().Auth))
+
+	db := database.NewMemoryDB()
+	if err := auth.RegisterUser(db, &models.RegisterRequest{Login: "victim", Password: "password123"}); err != nil {
+		t.Fatalf("Не удалось зарегистрировать пользователя: %v", err)
+	}
+	wrong := &models.LoginRequest{Login: "victim", Password: "wrong"}
+	right := &models.LoginRequest{Login: "victim", Password: "password123"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Login(db, wrong, "10.0.0.1"); err != auth.ErrInvalidCredentials {
+			t.Fatalf("Попытка %d: ожидалась ошибка неверного пароля, получено %v", i+1, err)
+		}
+	}
+
+	// Во время блокировки не принимается даже верный пароль
+	var lockout *auth.LockoutError
+	if _, err := auth.Login(db, right, "10.0.0.2"); !errors.As(err, &lockout) || lockout.RetryAfter <= 0 {
+		t.Fatalf("Ожидалась блокировка логина, получено %v", err)
+	}
+
+	now = now.Add(time.Duration(cfg.LockoutMs)*time.Millisecond + time.Second)
+	if _, err := auth.Login(db, right, "10.0.0.2"); err != nil {
+		t.Fatalf("После окончания блокировки вход должен быть разрешен: %v", err)
+	}
+
+	// Перебор разных логинов с одного IP блокирует IP
+	for i := 0; i < 5; i++ {
+		auth.Login(db, &models.LoginRequest{Login: fmt.Sprintf("ghost%d", i), Password: "x"}, "10.0.0.1")
+	}
+	if _, err := auth.Login(db, right, "10.0.0.1"); !errors.As(err, &lockout) {
+		t.Errorf("Ожидалась блокировка IP, получено %v", err)
+	}
+
+	entries, err := db.GetAuditEntries(100)
+	if err != nil {
+		t.Fatalf("Не удалось прочитать журнал: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		counts[entry.Event]++
+	}
+	if counts[models.AuditLoginFailed] != 8 || counts[models.AuditLockout] != 2 || counts[models.AuditLoginLocked] != 2 {
+		t.Errorf("Неожиданные записи журнала: %v", counts)
+	}
+
+	// Через HTTP блокировка возвращает 429 с Retry-After
+	handlers := orchestrator.NewAuthHandlers(db)
+	body, _ := json.Marshal(right)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:40000"
+	rr := httptest.NewRecorder()
+	handlers.LoginHandler(rr, req)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Ожидался код 429 с Retry-After, получено %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+}
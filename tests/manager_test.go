@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// addTestExpression разбирает выражение, сохраняет его в БД и добавляет задачи в менеджер
+func addTestExpression(t *testing.T, db database.Database, text string) string {
+	expr, tasks, err := orchestrator.NewExpression(text)
+	if err != nil {
+		t.Fatalf("%q: неожиданная ошибка разбора: %v", text, err)
+	}
+	if err := db.SaveExpression(expr); err != nil {
+		t.Fatalf("Не удалось сохранить выражение: %v", err)
+	}
+	orchestrator.Manager.AddExpression(expr.ID, tasks)
+	return expr.ID
+}
+
+// takeTask выдает следующую готовую задачу указанного выражения
+func takeTask(t *testing.T, exprID string) models.Task {
+	for i := 0; i < 100; i++ {
+		task, found := orchestrator.Manager.GetTask()
+		if !found {
+			break
+		}
+		if task.ExpressionID == exprID {
+			return task
+		}
+	}
+	t.Fatalf("Нет готовых задач для выражения %s", exprID)
+	return models.Task{}
+}
+
+func TestManagerCompletesExpression(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+
+	values := map[string]float64{"1+2": 3, "3+4": 7, "3*7": 21}
+	for i := 0; i < 3; i++ {
+		task := takeTask(t, exprID)
+		value, ok := values[task.Arg1+task.Operation+task.Arg2]
+		if !ok {
+			t.Fatalf("Неожиданная задача: %s %s %s", task.Arg1, task.Operation, task.Arg2)
+		}
+		if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID, Result: value, LeaseID: task.LeaseID}); err != nil {
+			t.Fatalf("Результат задачи #%d не принят: %v", task.ID, err)
+		}
+	}
+
+	expr, _ := orchestrator.Manager.GetExpression(exprID)
+	if expr.Status != "completed" || expr.Result != 21 {
+		t.Errorf("Ожидалось completed/21, получено %s/%v", expr.Status, expr.Result)
+	}
+
+	saved, err := db.GetExpression(exprID, 0)
+	if err != nil {
+		t.Fatalf("Не удалось получить выражение из БД: %v", err)
+	}
+	if saved.Status != "completed" || saved.Result != 21 {
+		t.Errorf("В БД ожидалось completed/21, получено %s/%v", saved.Status, saved.Result)
+	}
+}
+
+func TestManagerDivisionByZero(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+
+	exprID := addTestExpression(t, db, "1 / (2 - 2) + 3")
+
+	// Сначала выполняется 2 - 2
+	task := takeTask(t, exprID)
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID, Result: 0, LeaseID: task.LeaseID}); err != nil {
+		t.Fatalf("Результат задачи #%d не принят: %v", task.ID, err)
+	}
+
+	// Деление на ноль выдается агенту, а не блокируется навсегда
+	task = takeTask(t, exprID)
+	if task.Operation != "/" || task.Arg2 != "0" {
+		t.Fatalf("Ожидалась задача 1 / 0, получено %s %s %s", task.Arg1, task.Operation, task.Arg2)
+	}
+	failed := models.TaskResult{ID: task.ID, LeaseID: task.LeaseID, ErrorCode: models.TaskErrorDivisionByZero}
+	if err := orchestrator.Manager.AddResult(failed); err != nil {
+		t.Fatalf("Ошибка задачи #%d не принята: %v", task.ID, err)
+	}
+
+	expr, _ := orchestrator.Manager.GetExpression(exprID)
+	if expr.Status != "error" || expr.Error != "деление на ноль" {
+		t.Errorf("Ожидался статус error с причиной, получено %s/%q", expr.Status, expr.Error)
+	}
+
+	// Оставшаяся задача "+ 3" отменена
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID + 1, Result: 4}); !errors.Is(err, orchestrator.ErrTaskNotFound) {
+		t.Errorf("Результат отмененной задачи не должен приниматься, получено: %v", err)
+	}
+
+	saved, err := db.GetExpression(exprID, 0)
+	if err != nil {
+		t.Fatalf("Не удалось получить выражение из БД: %v", err)
+	}
+	if saved.Status != "error" || saved.Error != "деление на ноль" {
+		t.Errorf("В БД ожидался статус error с причиной, получено %s/%q", saved.Status, saved.Error)
+	}
+}
+
+func TestManagerLeaseExpiry(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+
+	exprID := addTestExpression(t, db, "6 * 7")
+
+	// Агент получил задачу и пропал: после истечения аренды задача возвращается в очередь
+	stale := takeTask(t, exprID)
+	deadline := orchestrator.LeaseDeadline(time.Now(), stale.OperationTime)
+	if released := orchestrator.Manager.ReleaseExpiredLeases(deadline.Add(time.Second)); released == 0 {
+		t.Fatal("Задача с истекшей арендой не освобождена")
+	}
+
+	fresh := takeTask(t, exprID)
+	if fresh.ID != stale.ID || fresh.LeaseID == stale.LeaseID {
+		t.Fatalf("Ожидалась повторная выдача задачи #%d с новой арендой, получено #%d (%s)", stale.ID, fresh.ID, fresh.LeaseID)
+	}
+
+	// Запоздавший результат по старой аренде отклоняется
+	err := orchestrator.Manager.AddResult(models.TaskResult{ID: stale.ID, Result: 42, LeaseID: stale.LeaseID})
+	if !errors.Is(err, orchestrator.ErrStaleLease) {
+		t.Errorf("Ожидалась ошибка ErrStaleLease, получено: %v", err)
+	}
+
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: fresh.ID, Result: 42, LeaseID: fresh.LeaseID}); err != nil {
+		t.Fatalf("Результат по действующей аренде не принят: %v", err)
+	}
+	if expr, _ := orchestrator.Manager.GetExpression(exprID); expr.Status != "completed" || expr.Result != 42 {
+		t.Errorf("Ожидалось completed/42, получено %s/%v", expr.Status, expr.Result)
+	}
+}
+
+func TestManagerRestoreAfterRestart(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "restore.sqlite"))
+	if err != nil {
+		t.Fatalf("Не удалось создать базу данных: %v", err)
+	}
+	defer db.Close()
+	if err := db.MigrateDB(); err != nil {
+		t.Fatalf("Не удалось выполнить миграции: %v", err)
+	}
+
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() {
+		orchestrator.DB = prevDB
+		orchestrator.InitTaskManager()
+	}()
+	orchestrator.InitTaskManager()
+
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+	values := map[string]float64{"1+2": 3, "3+4": 7, "3*7": 21}
+
+	// Одна задача выполнена, вторая выдана агенту и еще вычисляется
+	done := takeTask(t, exprID)
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: done.ID, Result: values[done.Arg1+done.Operation+done.Arg2], LeaseID: done.LeaseID}); err != nil {
+		t.Fatalf("Результат задачи #%d не принят: %v", done.ID, err)
+	}
+	inFlight := takeTask(t, exprID)
+
+	// Перезапуск: менеджер сбрасывается и восстанавливается из SQLite
+	orchestrator.InitTaskManager()
+
+	expr, exists := orchestrator.Manager.GetExpression(exprID)
+	if !exists || expr.Status != "pending" || expr.Expression != "(1 + 2) * (3 + 4)" {
+		t.Fatalf("Выражение не восстановлено: %+v", expr)
+	}
+	if _, found := orchestrator.Manager.GetTask(); found {
+		t.Fatal("Задача в аренде не должна выдаваться повторно до истечения аренды")
+	}
+
+	// Агент, получивший задачу до перезапуска, присылает результат по прежней аренде
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: inFlight.ID, Result: values[inFlight.Arg1+inFlight.Operation+inFlight.Arg2], LeaseID: inFlight.LeaseID}); err != nil {
+		t.Fatalf("Результат по аренде до перезапуска не принят: %v", err)
+	}
+
+	root := takeTask(t, exprID)
+	if root.Operation != "*" || root.Arg1 != "3" || root.Arg2 != "7" {
+		t.Fatalf("Ожидалась задача 3 * 7, получено %s %s %s", root.Arg1, root.Operation, root.Arg2)
+	}
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: root.ID, Result: 21, LeaseID: root.LeaseID}); err != nil {
+		t.Fatalf("Результат задачи #%d не принят: %v", root.ID, err)
+	}
+
+	saved, err := db.GetExpression(exprID, 0)
+	if err != nil {
+		t.Fatalf("Не удалось получить выражение из БД: %v", err)
+	}
+	if saved.Status != "completed" || saved.Result != 21 {
+		t.Errorf("В БД ожидалось completed/21, получено %s/%v", saved.Status, saved.Result)
+	}
+
+	// Нумерация задач продолжается после восстановленных
+	nextID := addTestExpression(t, db, "8 - 1")
+	if next := takeTask(t, nextID); next.ID <= root.ID {
+		t.Errorf("ID новой задачи %d должен быть больше %d", next.ID, root.ID)
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/metrics"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+// scrape запрашивает /metrics и возвращает текст ответа
+func scrape(t *testing.T, handler http.Handler) string {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Неожиданный ответ /metrics: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(rr.Body)
+	return string(body)
+}
+
+func TestMetricsTextFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.NewCounterVec("test_requests_total", "Запросы", "method", "code")
+	histogram := registry.NewHistogramVec("test_duration_seconds", "Длительность", []float64{0.1, 1}, "op")
+	registry.NewGaugeVecFunc("test_items", "Элементы", "state", func() map[string]float64 {
+		return map[string]float64{"ready": 2}
+	})
+
+	counter.Inc("Get", "OK")
+	counter.Add(2, "Get", "OK")
+	histogram.Observe(0.05, "+")
+	histogram.Observe(0.5, "+")
+	histogram.Observe(5, "+")
+
+	body := scrape(t, registry.Handler())
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{method="Get",code="OK"} 3`,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{op="+",le="0.1"} 1`,
+		`test_duration_seconds_bucket{op="+",le="1"} 2`,
+		`test_duration_seconds_bucket{op="+",le="+Inf"} 3`,
+		`test_duration_seconds_sum{op="+"} 5.55`,
+		`test_duration_seconds_count{op="+"} 3`,
+		`test_items{state="ready"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("В ответе нет строки %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestOrchestratorMetrics(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+	task := takeTask(t, exprID)
+
+	body := scrape(t, metrics.Handler())
+	for _, line := range []string{
+		"calculator_ready_tasks 1",
+		"calculator_inflight_tasks 1",
+		`calculator_expressions{status="pending"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("В ответе нет строки %q", line)
+		}
+	}
+
+	if err := orchestrator.Manager.AddResult(models.TaskResult{ID: task.ID, Result: 3, LeaseID: task.LeaseID}); err != nil {
+		t.Fatalf("Результат не принят: %v", err)
+	}
+	body = scrape(t, metrics.Handler())
+	if !strings.Contains(body, `calculator_task_duration_seconds_count{operation="+"}`) ||
+		!strings.Contains(body, `calculator_task_results_total{operation="+",outcome="ok"}`) {
+		t.Errorf("Время выполнения задачи не учтено в метриках:\n%s", body)
+	}
+}
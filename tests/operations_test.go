@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/agent"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+	"github.com/GGmuzem/yandex-project/pkg/operations"
+)
+
+func TestApplyOperation(t *testing.T) {
+	cases := []struct {
+		op   string
+		a, b float64
+		want float64
+	}{
+		{"^", 2, 10, 1024},
+		{"^", -2, 3, -8},
+		{"^", 4, 0.5, 2},
+		{"^", 2, -2, 0.25},
+		{"//", 7, 2, 3},
+		{"//", -7, 2, -4},
+		{"//", 7, -2, -4},
+		{"//", 7.5, 2, 3},
+		{"%", 7, 3, 1},
+		{"%", -7, 2, 1},
+		{"%", 7, -2, -1},
+		{"%", 5.5, 2, 1.5},
+		{"%", -5.5, 2, 0.5},
+	}
+	for _, c := range cases {
+		got, err := agent.Evaluate(c.op, []float64{c.a, c.b})
+		if err != nil || math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%v %s %v = %v (%v), ожидалось %v", c.a, c.op, c.b, got, err, c.want)
+		}
+		// Целочисленное деление и остаток согласованы: a = b*(a//b) + a%b
+		if c.op == "%" {
+			q, _ := agent.Evaluate("//", []float64{c.a, c.b})
+			if math.Abs(c.b*q+got-c.a) > 1e-12 {
+				t.Errorf("%v // %v и %v %% %v не согласованы", c.a, c.b, c.a, c.b)
+			}
+		}
+	}
+
+	failures := []struct {
+		op   string
+		a, b float64
+		code string
+	}{
+		{"//", 1, 0, models.TaskErrorDivisionByZero},
+		{"%", 1, 0, models.TaskErrorDivisionByZero},
+		{"^", 0, -1, models.TaskErrorDivisionByZero},
+		{"^", -8, 1.0 / 3, models.TaskErrorDomain},
+		{"^", 10, 400, models.TaskErrorDomain},
+		{"?", 1, 2, models.TaskErrorUnknownOperation},
+	}
+	for _, c := range failures {
+		_, err := agent.Evaluate(c.op, []float64{c.a, c.b})
+		var computeErr *agent.ComputeError
+		if !errors.As(err, &computeErr) || computeErr.Code != c.code {
+			t.Errorf("%v %s %v: ожидалась ошибка %s, получено %v", c.a, c.op, c.b, c.code, err)
+		}
+	}
+}
+
+func TestOperationTime(t *testing.T) {
+	defaults := orchestrator.Config.Operations
+	defer func() { orchestrator.Config.Operations = defaults }()
+	orchestrator.Config.Operations.ExponentiationMs = 31
+	orchestrator.Config.Operations.ModuloMs = 32
+	orchestrator.Config.Operations.IntDivisionMs = 33
+
+	tasks, err := orchestrator.ParseExpression("2 ^ 3 % 4 // 5")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка разбора: %v", err)
+	}
+	want := []int{31, 32, 33}
+	for i, task := range tasks {
+		if task.OperationTime != want[i] {
+			t.Errorf("Задача %s: время %d, ожидалось %d", formatTask(task), task.OperationTime, want[i])
+		}
+	}
+}
+
+func TestOperationRegistry(t *testing.T) {
+	defaults := config.Default().Operations
+	for _, symbol := range operations.Symbols() {
+		op, _ := operations.Lookup(symbol)
+		if op.Eval == nil || defaults.CostMs(op.Cost) <= 0 {
+			t.Errorf("Операция %s: нет вычисления или стоимости", symbol)
+		}
+		if op.Kind == operations.Binary && (op.Precedence == 0 || !op.Accepts(2) || op.Accepts(3)) {
+			t.Errorf("Оператор %s: неверный приоритет или число аргументов", symbol)
+		}
+	}
+
+	// Лексер сопоставляет самый длинный оператор первым
+	ops := operations.Operators()
+	if len(ops) == 0 || ops[0].Symbol != "//" {
+		t.Errorf("Первым должен сопоставляться оператор //, получено %v", ops)
+	}
+
+	if op, ok := operations.Lookup("^"); !ok || op.Associativity != operations.Right {
+		t.Error("Оператор ^ должен быть правоассоциативным")
+	}
+	if _, ok := operations.Lookup("tan"); ok {
+		t.Error("Функция tan не должна быть в реестре")
+	}
+
+	cfg := config.Default()
+	cfg.Agent.Operations = []string{"+", "tan"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "agent.operations") {
+		t.Errorf("Ожидалась ошибка неизвестной операции агента, получено %v", err)
+	}
+	if got := config.Default().Agent.SupportedOperations(); len(got) != len(operations.Symbols()) {
+		t.Errorf("По умолчанию агент должен поддерживать все операции, получено %v", got)
+	}
+}
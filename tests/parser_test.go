@@ -1,13 +1,138 @@
 package tests
 
 import (
-    "testing"
-    "github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"errors"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
 )
 
 func TestParseExpression(t *testing.T) {
-    tasks := orchestrator.ParseExpression("2 + 2 * 2")
-    if len(tasks) < 2 {
-        t.Errorf("Expected at least 2 tasks, got %d", len(tasks))
-    }
-}
\ No newline at end of file
+	tasks, err := orchestrator.ParseExpression("2 + 2 * 2")
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if len(tasks) < 2 {
+		t.Errorf("Expected at least 2 tasks, got %d", len(tasks))
+	}
+}
+
+func TestParseExpressionTasks(t *testing.T) {
+	cases := []struct {
+		expr  string
+		tasks [][3]string // arg1, operation, arg2
+	}{
+		{"2 + 2 * 2", [][3]string{{"2", "*", "2"}, {"2", "+", "result1"}}},
+		{"(2 + 2) * 2", [][3]string{{"2", "+", "2"}, {"result1", "*", "2"}}},
+		{"1 - 2 - 3", [][3]string{{"1", "-", "2"}, {"result1", "-", "3"}}},
+		{"-5 + 3", [][3]string{{"-5", "+", "3"}}},
+		{"2*-3", [][3]string{{"2", "*", "-3"}}},
+		{"1e-3 * 2", [][3]string{{"0.001", "*", "2"}}},
+		{"2.5E+2 / 5", [][3]string{{"250", "/", "5"}}},
+		{"3,5 + 1", [][3]string{{"3.5", "+", "1"}}},
+		{"(−2) * 4", [][3]string{{"-2", "*", "4"}}},
+		{"--4 - +1", [][3]string{{"4", "-", "1"}}},
+		{"-(1 + 2)", [][3]string{{"1", "+", "2"}, {"0", "-", "result1"}}},
+		{"2 ^ 3 ^ 2", [][3]string{{"3", "^", "2"}, {"2", "^", "result1"}}},
+		{"-2 ^ 2", [][3]string{{"2", "^", "2"}, {"0", "-", "result1"}}},
+		{"2 * 3 ^ 2", [][3]string{{"3", "^", "2"}, {"2", "*", "result1"}}},
+		{"7 // 2 % 3", [][3]string{{"7", "//", "2"}, {"result1", "%", "3"}}},
+		{"1 + 7%2", [][3]string{{"7", "%", "2"}, {"1", "+", "result1"}}},
+		{"2 ^ -1", [][3]string{{"2", "^", "-1"}}},
+	}
+
+	for _, c := range cases {
+		tasks, err := orchestrator.ParseExpression(c.expr)
+		if err != nil {
+			t.Errorf("%q: неожиданная ошибка разбора: %v", c.expr, err)
+			continue
+		}
+		if len(tasks) != len(c.tasks) {
+			t.Errorf("%q: ожидалось %d задач, получено %d: %+v", c.expr, len(c.tasks), len(tasks), tasks)
+			continue
+		}
+		for i, want := range c.tasks {
+			got := tasks[i]
+			if got.ID != i+1 || got.Arg1 != want[0] || got.Operation != want[1] || got.Arg2 != want[2] {
+				t.Errorf("%q: задача %d = %s, ожидалось %s %s %s", c.expr, i+1, formatTask(got), want[0], want[1], want[2])
+			}
+		}
+	}
+}
+
+func TestParseExpressionInvalid(t *testing.T) {
+	cases := []struct {
+		expr     string
+		kind     orchestrator.ParseErrorKind
+		token    string
+		position int
+	}{
+		{"(2 + 3", orchestrator.ErrKindUnbalancedParenthesis, "(", 1},
+		{"2 + 3)", orchestrator.ErrKindUnbalancedParenthesis, ")", 6},
+		{"2 + * 3", orchestrator.ErrKindUnexpectedToken, "*", 5},
+		{"2 3", orchestrator.ErrKindUnexpectedToken, "3", 3},
+		{"2 +", orchestrator.ErrKindUnexpectedEnd, "", 4},
+		{"1e + 2", orchestrator.ErrKindInvalidNumber, "1e", 1},
+		{"−2 $ 3", orchestrator.ErrKindInvalidCharacter, "$", 4},
+		{"(2 + ) * 3", orchestrator.ErrKindUnexpectedToken, ")", 6},
+		{"   ", orchestrator.ErrKindEmptyExpression, "", 4},
+		{"2 /// 3", orchestrator.ErrKindUnexpectedToken, "/", 5},
+		{"2 ^", orchestrator.ErrKindUnexpectedEnd, "", 4},
+	}
+
+	for _, c := range cases {
+		_, err := orchestrator.ParseExpression(c.expr)
+		var parseErr *orchestrator.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: ожидалась *ParseError, получено %v", c.expr, err)
+			continue
+		}
+		if parseErr.Kind != c.kind || parseErr.Token != c.token || parseErr.Position != c.position {
+			t.Errorf("%q: получено kind=%s token=%q position=%d, ожидалось kind=%s token=%q position=%d",
+				c.expr, parseErr.Kind, parseErr.Token, parseErr.Position, c.kind, c.token, c.position)
+		}
+	}
+}
+
+func TestFormatNode(t *testing.T) {
+	cases := []struct {
+		expr       string
+		normalized string
+	}{
+		{"2+2*2", "2 + 2 * 2"},
+		{"(2+2)*2", "(2 + 2) * 2"},
+		{"((2))*(3*4)", "2 * (3 * 4)"},
+		{"((2*3))*4", "2 * 3 * 4"},
+		{"1-(2-3)", "1 - (2 - 3)"},
+		{"1-(2+3)", "1 - (2 + 3)"},
+		{"(1-2)-3", "1 - 2 - 3"},
+		{"8/(4/2)", "8 / (4 / 2)"},
+		{"8/(4*2)", "8 / (4 * 2)"},
+		{"2*(3/4)", "2 * (3 / 4)"},
+		{"-(1+2)*3", "-(1 + 2) * 3"},
+		{"2*-3", "2 * -3"},
+		{"1e-3 + 3,5", "0.001 + 3.5"},
+		{"(−2) * 4", "-2 * 4"},
+		{"2^3^2", "2 ^ 3 ^ 2"},
+		{"(2^3)^2", "(2 ^ 3) ^ 2"},
+		{"(-2)^2", "(-2) ^ 2"},
+		{"-2^2", "-2 ^ 2"},
+		{"7//(2%3)", "7 // (2 % 3)"},
+	}
+
+	for _, c := range cases {
+		root, err := orchestrator.Parse(c.expr)
+		if err != nil {
+			t.Errorf("%q: неожиданная ошибка разбора: %v", c.expr, err)
+			continue
+		}
+		if got := orchestrator.FormatNode(root); got != c.normalized {
+			t.Errorf("%q: каноническая запись %q, ожидалось %q", c.expr, got, c.normalized)
+		}
+	}
+}
+
+func formatTask(task models.Task) string {
+	return task.Arg1 + " " + task.Operation + " " + task.Arg2
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func testQuotas(t *testing.T, db database.Database) {
+	now := time.Now()
+	orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	orchestrator.Quotas.SetClock(func() time.Time { return now })
+
+	handlers := orchestrator.NewAuthHandlers(db)
+	calculate := handlers.AuthMiddleware(handlers.CalculateWithAuthHandler)
+	submit := func(token, expression string) *httptest.ResponseRecorder {
+		return serveAPI(calculate, http.MethodPost, "/api/v1/calculate", token, map[string]string{"expression": expression})
+	}
+	token := loginToken(t, db, "limited")
+
+	// Маркерное ведро: два выражения подряд, третье ждет пополнения
+	for i := 0; i < 2; i++ {
+		if rr := submit(token, "1+2"); rr.Code != http.StatusCreated {
+			t.Fatalf("Выражение %d должно быть принято, получено %d", i+1, rr.Code)
+		}
+	}
+	if rr := submit(token, "1+2"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Ожидался код 429 с Retry-After 1, получено %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// Слишком большое выражение отклоняется без повтора
+	now = now.Add(2 * time.Second)
+	if rr := submit(token, "1+2+3+4"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался код 422 для выражения из 3 задач, получено %d", rr.Code)
+	}
+	if rr := submit(token, "3*4"); rr.Code != http.StatusCreated {
+		t.Fatalf("Выражение должно быть принято, получено %d", rr.Code)
+	}
+
+	// Три выражения еще вычисляются
+	now = now.Add(2 * time.Second)
+	if rr := submit(token, "5-6"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "5" {
+		t.Errorf("Ожидался отказ по числу вычисляемых выражений, получено %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// После вычисления место освобождается, но суточный лимит исчерпывается
+	exprs, err := db.GetExpressions(1)
+	if err != nil || len(exprs) != 3 {
+		t.Fatalf("Ожидалось 3 выражения пользователя, получено %d (%v)", len(exprs), err)
+	}
+	if err := db.UpdateExpressionStatus(exprs[0].ID, "completed", 3, ""); err != nil {
+		t.Fatalf("Не удалось обновить выражение: %v", err)
+	}
+	now = now.Add(2 * time.Second)
+	if rr := submit(token, "5-6"); rr.Code != http.StatusCreated {
+		t.Fatalf("Выражение должно быть принято, получено %d", rr.Code)
+	}
+	now = now.Add(2 * time.Second)
+	if rr := submit(token, "7-8"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Ожидался отказ по суточному лимиту, получено %d", rr.Code)
+	}
+
+	var usage orchestrator.Usage
+	code := apiRequest(t, handlers.AuthMiddleware(handlers.UsageHandler), http.MethodGet, "/api/v1/me/usage", token, nil, &usage)
+	if usage.Pending != 3 || usage.SubmittedToday != 4 || usage.Limits.MaxDaily != 4 ||
+		usage.RateRemaining == nil || *usage.RateRemaining != 1 || usage.DailyResetAt <= now.UnixMilli() {
+		t.Errorf("Неожиданное использование ограничений: %d %+v", code, usage)
+	}
+
+	// Для администраторов ограничения не заданы
+	adminToken := loginToken(t, db, "unlimited")
+	if err := auth.BootstrapAdmins(db, config.Auth{AdminLogins: []string{"unlimited"}}); err != nil {
+		t.Fatalf("Не удалось назначить администратора: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if rr := submit(adminToken, "1+2+3+4"); rr.Code != http.StatusCreated {
+			t.Fatalf("Выражение администратора %d должно быть принято, получено %d", i+1, rr.Code)
+		}
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	defaults := orchestrator.Config.Limits
+	orchestrator.Config.Limits = config.Limits{
+		UserRatePerMinute: 60,
+		UserBurst:         2,
+		UserMaxPending:    3,
+		UserMaxTasks:      2,
+		UserMaxDaily:      4,
+	}
+	defer func() {
+		orchestrator.Config.Limits = defaults
+		orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	}()
+
+	forEachDB(t, testQuotas)
+}
+
+// slowCountDB задерживает ответ на подсчет выражений, чтобы одновременные запросы
+// успели прочитать один и тот же счет до сохранения
+type slowCountDB struct {
+	database.Database
+}
+
+func (db slowCountDB) CountUserExpressions(userID int, since int64) (int, int, error) {
+	pending, submitted, err := db.Database.CountUserExpressions(userID, since)
+	time.Sleep(20 * time.Millisecond)
+	return pending, submitted, err
+}
+
+func TestQuotaConcurrentSubmissions(t *testing.T) {
+	defaults := orchestrator.Config.Limits
+	orchestrator.Config.Limits = config.Limits{UserRatePerMinute: 600, UserBurst: 20, UserMaxPending: 2}
+	orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	defer func() {
+		orchestrator.Config.Limits = defaults
+		orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	}()
+
+	db := slowCountDB{database.NewMemoryDB()}
+	handlers := orchestrator.NewAuthHandlers(db)
+	calculate := handlers.AuthMiddleware(handlers.CalculateWithAuthHandler)
+	token := loginToken(t, db, "flooder")
+
+	// Одновременные запросы не должны вместе превысить max_pending
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serveAPI(calculate, http.MethodPost, "/api/v1/calculate", token, models.CalculateRequest{Expression: "1+2"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			accepted++
+		}
+	}
+	if accepted != 2 {
+		t.Errorf("Ожидалось 2 принятых выражения, принято %d", accepted)
+	}
+}
+
+func TestQuotaPruneUsesOwnerLimits(t *testing.T) {
+	now := time.Now()
+	quotas := orchestrator.NewQuotaTracker()
+	quotas.SetClock(func() time.Time { return now })
+
+	slow := config.RoleLimits{RatePerMinute: 60, Burst: 2}
+	fast := config.RoleLimits{RatePerMinute: 6000, Burst: 1}
+	if wait := quotas.Take(1, slow); wait != 0 {
+		t.Fatalf("Первый маркер должен быть выдан сразу, ожидание %v", wait)
+	}
+
+	// Удаление наполнившихся ведер по быстрой роли не должно вернуть пользователю полное ведро
+	now = now.Add(500 * time.Millisecond)
+	for id := 2; id < 1100; id++ {
+		quotas.Take(id, fast)
+	}
+	if remaining := quotas.Remaining(1, slow); remaining != 1 {
+		t.Errorf("Ожидался 1 маркер после частичного пополнения, получено %d", remaining)
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/config"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func testRoles(t *testing.T, db database.Database) {
+	userToken := loginToken(t, db, "operator")
+	user, err := db.GetUserByLogin("operator")
+	if err != nil || user.Role != models.RoleUser {
+		t.Fatalf("Новый пользователь должен получить роль user, получено %+v (%v)", user, err)
+	}
+
+	// Администратор создается при первом запуске, повторный запуск его не пересоздает
+	weak := config.Auth{BootstrapAdmin: "root", BootstrapPassword: "rootpass"}
+	var policyErr *auth.PolicyError
+	if err := auth.BootstrapAdmins(db, weak); !errors.As(err, &policyErr) {
+		t.Errorf("Ожидался отказ для слабого пароля администратора, получено %v", err)
+	}
+	if exists, _ := db.UserExists("root"); exists {
+		t.Fatal("Администратор со слабым паролем не должен создаваться")
+	}
+
+	cfg := config.Auth{BootstrapAdmin: "root", BootstrapPassword: "rootpass1", AdminLogins: []string{"operator", "missing"}}
+	for i := 0; i < 2; i++ {
+		if err := auth.BootstrapAdmins(db, cfg); err != nil {
+			t.Fatalf("Не удалось назначить администраторов: %v", err)
+		}
+	}
+	root, err := db.GetUserByLogin("root")
+	if err != nil || root.Role != models.RoleAdmin {
+		t.Fatalf("Ожидался администратор root, получено %+v (%v)", root, err)
+	}
+	if _, err := auth.LoginUser(db, &models.LoginRequest{Login: "root", Password: "rootpass1"}); err != nil {
+		t.Errorf("Администратор должен входить с паролем из настроек: %v", err)
+	}
+
+	// Роль проверяется по БД, поэтому токен, выданный до повышения, уже дает права администратора
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	admin := auth.RequireRole(models.RoleAdmin, ok)
+	if code := apiRequest(t, auth.AuthMiddleware(db, admin), http.MethodGet, "/api/v1/admin/queue", userToken, nil, nil); code != http.StatusOK {
+		t.Errorf("Пользователь из admin_logins должен получить роль admin, код %d", code)
+	}
+
+	plainToken := loginToken(t, db, "plain")
+	if code := apiRequest(t, auth.AuthMiddleware(db, admin), http.MethodGet, "/api/v1/admin/queue", plainToken, nil, nil); code != http.StatusForbidden {
+		t.Errorf("Обычному пользователю доступ должен быть запрещен, код %d", code)
+	}
+	if code := apiRequest(t, auth.AuthMiddleware(db, auth.RequireRole(models.RoleUser, ok)), http.MethodGet, "/api/v1/expressions", userToken, nil, nil); code != http.StatusOK {
+		t.Errorf("Администратору доступно все, что доступно пользователю, код %d", code)
+	}
+
+	claims, err := auth.ValidateToken(plainToken)
+	if err != nil || claims.Role != models.RoleUser {
+		t.Errorf("Токен должен содержать роль пользователя, получено %+v (%v)", claims, err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	forEachDB(t, testRoles)
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/auth"
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func testSessions(t *testing.T, db database.Database) {
+	if err := auth.RegisterUser(db, &models.RegisterRequest{Login: "alice", Password: "password123"}); err != nil {
+		t.Fatalf("Не удалось зарегистрировать пользователя: %v", err)
+	}
+	login, err := auth.Login(db, &models.LoginRequest{Login: "alice", Password: "password123"}, "")
+	if err != nil {
+		t.Fatalf("Не удалось войти: %v", err)
+	}
+	if login.Token == "" || login.RefreshToken == "" || login.ExpiresIn <= 0 {
+		t.Fatalf("Ожидались access и refresh токены, получено %+v", login)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	if code := apiRequest(t, auth.AuthMiddleware(db, ok), http.MethodGet, "/api/v1/expressions", login.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("Access токен сессии не принят: %d", code)
+	}
+
+	// Обмен refresh токена выдает новую пару, старый refresh токен одноразовый
+	refreshed, err := auth.RefreshSession(db, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("Не удалось обновить токены: %v", err)
+	}
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Error("Refresh токен должен меняться при каждом обмене")
+	}
+	if code := apiRequest(t, auth.AuthMiddleware(db, ok), http.MethodGet, "/api/v1/expressions", refreshed.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("Обновленный access токен не принят: %d", code)
+	}
+
+	// Повторное использование обмененного токена завершает сессию целиком
+	if _, err := auth.RefreshSession(db, login.RefreshToken); err != auth.ErrSessionRevoked {
+		t.Fatalf("Ожидалась ошибка %v при повторном использовании, получено %v", auth.ErrSessionRevoked, err)
+	}
+	if _, err := auth.RefreshSession(db, refreshed.RefreshToken); err != auth.ErrSessionRevoked {
+		t.Errorf("После повторного использования сессия должна быть завершена, получено %v", err)
+	}
+	if code := apiRequest(t, auth.AuthMiddleware(db, ok), http.MethodGet, "/api/v1/expressions", refreshed.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Access токен завершенной сессии должен отклоняться, получено %d", code)
+	}
+
+	if _, err := auth.RefreshSession(db, "unknown"); err != auth.ErrInvalidToken {
+		t.Errorf("Ожидалась ошибка %v для неизвестного токена, получено %v", auth.ErrInvalidToken, err)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachDB(t, testSessions)
+}
+
+func TestRefreshAndLogoutHandlers(t *testing.T) {
+	db := database.NewMemoryDB()
+	handlers := orchestrator.NewAuthHandlers(db)
+	if err := auth.RegisterUser(db, &models.RegisterRequest{Login: "bob", Password: "password123"}); err != nil {
+		t.Fatalf("Не удалось зарегистрировать пользователя: %v", err)
+	}
+
+	post := func(handler http.HandlerFunc, path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := post(handlers.LoginHandler, "/api/v1/login", "", models.LoginRequest{Login: "bob", Password: "password123"})
+	var login models.LoginResponse
+	if err := json.NewDecoder(rr.Body).Decode(&login); err != nil || login.RefreshToken == "" {
+		t.Fatalf("Вход должен вернуть refresh токен: %d %v", rr.Code, err)
+	}
+
+	rr = post(handlers.RefreshHandler, "/api/v1/token/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken})
+	var refreshed models.LoginResponse
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Ожидался код 200 при обновлении, получено %d", rr.Code)
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&refreshed); err != nil {
+		t.Fatalf("Ошибка декодирования ответа: %v", err)
+	}
+
+	logout := handlers.AuthMiddleware(handlers.LogoutHandler)
+	if rr := post(logout, "/api/v1/logout", refreshed.Token, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Ожидался код 200 при выходе, получено %d", rr.Code)
+	}
+	if rr := post(logout, "/api/v1/logout", refreshed.Token, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("После выхода access токен должен отклоняться, получено %d", rr.Code)
+	}
+	rr = post(handlers.RefreshHandler, "/api/v1/token/refresh", "", models.RefreshRequest{RefreshToken: refreshed.RefreshToken})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("После выхода refresh токен должен отклоняться, получено %d", rr.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+)
+
+func TestDrainFinishesInFlightTasks(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+	defer orchestrator.InitTaskManager()
+
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeTaskStream(ctx)
+	server := orchestrator.NewCalculatorServer(db, nil, nil)
+	done := make(chan error, 1)
+	go func() { done <- server.StreamTasks(stream) }()
+
+	stream.in <- &calculator.AgentMessage{AgentId: 5, Capacity: 1}
+	task := stream.receive(t).Task
+	if task == nil {
+		t.Fatal("Ожидалась задача в потоке")
+	}
+
+	orchestrator.Manager.Drain()
+
+	// Новые выражения отклоняются, готовые задачи больше не выдаются
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBufferString(`{"expression": "2 + 2"}`))
+	rr := httptest.NewRecorder()
+	orchestrator.CalculateHandler(rr, req)
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Ожидался 503 с Retry-After при остановке, получено %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, found := orchestrator.Manager.GetTask(); found {
+		t.Error("Задачи не должны выдаваться после начала остановки")
+	}
+	if code, checks := readyz(t, db); code != http.StatusServiceUnavailable || checks[orchestrator.CheckShutdown] == "ok" {
+		t.Errorf("Ожидалась неготовность из-за остановки, получено %d %v", code, checks)
+	}
+
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer shortCancel()
+	if err := orchestrator.Manager.WaitIdle(shortCtx); err == nil {
+		t.Error("WaitIdle не должен завершаться, пока задача в обработке")
+	}
+
+	// Результат выданной задачи принимается, после чего оркестратор закрывает поток
+	result := &calculator.TaskResult{Id: task.Id, Result: 3, ExpressionId: exprID, LeaseId: task.LeaseId}
+	if task.Arg1 == "3" {
+		result.Result = 7
+	}
+	stream.in <- &calculator.AgentMessage{AgentId: 5, Capacity: 1, Result: result}
+	if ack := stream.receive(t).Ack; ack == nil || !ack.Success {
+		t.Fatalf("Ожидалось подтверждение результата, получено %+v", ack)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Поток должен завершиться без ошибки, получено: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Поток не закрылся после выполнения задач агента")
+	}
+
+	idleCtx, idleCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer idleCancel()
+	if err := orchestrator.Manager.WaitIdle(idleCtx); err != nil {
+		t.Errorf("WaitIdle должен завершиться после результата задачи: %v", err)
+	}
+
+	select {
+	case msg := <-stream.out:
+		if msg.Task != nil {
+			t.Errorf("После начала остановки агенту выдана задача #%d", msg.Task.Id)
+		}
+	default:
+	}
+}
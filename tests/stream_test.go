@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/calculator"
+	"google.golang.org/grpc"
+)
+
+// fakeTaskStream серверная сторона потока StreamTasks поверх каналов
+type fakeTaskStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	in  chan *calculator.AgentMessage
+	out chan *calculator.ServerMessage
+}
+
+func newFakeTaskStream(ctx context.Context) *fakeTaskStream {
+	return &fakeTaskStream{
+		ctx: ctx,
+		in:  make(chan *calculator.AgentMessage, 10),
+		out: make(chan *calculator.ServerMessage, 10),
+	}
+}
+
+func (s *fakeTaskStream) Context() context.Context { return s.ctx }
+
+func (s *fakeTaskStream) Send(msg *calculator.ServerMessage) error {
+	s.out <- msg
+	return nil
+}
+
+func (s *fakeTaskStream) Recv() (*calculator.AgentMessage, error) {
+	select {
+	case msg, ok := <-s.in:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// receive ждет следующее сообщение оркестратора
+func (s *fakeTaskStream) receive(t *testing.T) *calculator.ServerMessage {
+	select {
+	case msg := <-s.out:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("Оркестратор не прислал сообщение в поток")
+		return nil
+	}
+}
+
+func TestStreamTasksPushesReadyTasks(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeTaskStream(ctx)
+	server := orchestrator.NewCalculatorServer(db, nil, nil)
+	done := make(chan error, 1)
+	go func() { done <- server.StreamTasks(stream) }()
+
+	// Агент объявляет два слота до появления задач
+	stream.in <- &calculator.AgentMessage{AgentId: 7, Capacity: 2}
+	exprID := addTestExpression(t, db, "(1 + 2) * (3 + 4)")
+
+	values := map[string]float64{"1+2": 3, "3+4": 7, "3*7": 21}
+	submit := func(task *calculator.Task) {
+		value, ok := values[task.Arg1+task.Operation+task.Arg2]
+		if !ok {
+			t.Fatalf("Неожиданная задача: %s %s %s", task.Arg1, task.Operation, task.Arg2)
+		}
+		result := &calculator.TaskResult{Id: task.Id, Result: value, ExpressionId: exprID, LeaseId: task.LeaseId}
+		stream.in <- &calculator.AgentMessage{AgentId: 7, Capacity: 1, Result: result}
+	}
+
+	// Обе независимые задачи приходят сразу, без опроса
+	first, second := stream.receive(t).Task, stream.receive(t).Task
+	if first == nil || second == nil {
+		t.Fatal("Ожидались две задачи в потоке")
+	}
+
+	submit(first)
+	if ack := stream.receive(t).Ack; ack == nil || !ack.Success || ack.TaskId != first.Id {
+		t.Fatalf("Ожидалось подтверждение результата задачи #%d, получено %+v", first.Id, ack)
+	}
+
+	// После второго результата приходит подтверждение и корневая задача (в любом порядке)
+	submit(second)
+	var root *calculator.Task
+	for i := 0; i < 2; i++ {
+		msg := stream.receive(t)
+		if msg.Task != nil {
+			root = msg.Task
+		} else if msg.Ack == nil || !msg.Ack.Success {
+			t.Fatalf("Ожидалось успешное подтверждение, получено %+v", msg.Ack)
+		}
+	}
+	if root == nil || root.Operation != "*" {
+		t.Fatalf("Ожидалась корневая задача 3 * 7, получено %+v", root)
+	}
+
+	submit(root)
+	if ack := stream.receive(t).Ack; ack == nil || !ack.Success {
+		t.Fatalf("Ожидалось подтверждение результата корневой задачи, получено %+v", ack)
+	}
+	if expr, _ := orchestrator.Manager.GetExpression(exprID); expr.Status != "completed" || expr.Result != 21 {
+		t.Errorf("Ожидалось completed/21, получено %s/%v", expr.Status, expr.Result)
+	}
+
+	close(stream.in)
+	if err := <-done; err != nil {
+		t.Errorf("Поток должен завершиться без ошибки после закрытия агентом, получено: %v", err)
+	}
+}
+
+func TestStreamTasksDisconnectReleasesTasks(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+
+	exprID := addTestExpression(t, db, "6 * 7")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newFakeTaskStream(ctx)
+	server := orchestrator.NewCalculatorServer(db, nil, nil)
+	done := make(chan error, 1)
+	go func() { done <- server.StreamTasks(stream) }()
+
+	stream.in <- &calculator.AgentMessage{AgentId: 3, Capacity: 1}
+	sent := stream.receive(t).Task
+	if sent == nil {
+		t.Fatal("Ожидалась задача в потоке")
+	}
+
+	// Агент пропал, не прислав результат: задача сразу возвращается в очередь
+	cancel()
+	<-done
+
+	task := takeTask(t, exprID)
+	if task.ID != int(sent.Id) || task.LeaseID == sent.LeaseId {
+		t.Errorf("Ожидалась повторная выдача задачи #%d с новой арендой, получено #%d (%s)", sent.Id, task.ID, task.LeaseID)
+	}
+}
+
+func TestStreamTasksDrainClosesAfterLastResult(t *testing.T) {
+	db := database.NewMemoryDB()
+	prevDB := orchestrator.DB
+	orchestrator.DB = db
+	defer func() { orchestrator.DB = prevDB }()
+	orchestrator.InitTaskManager()
+	defer orchestrator.InitTaskManager()
+
+	exprID := addTestExpression(t, db, "6 * 7")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeTaskStream(ctx)
+	server := orchestrator.NewCalculatorServer(db, nil, nil)
+	done := make(chan error, 1)
+	go func() { done <- server.StreamTasks(stream) }()
+
+	stream.in <- &calculator.AgentMessage{AgentId: 5, Capacity: 1}
+	task := stream.receive(t).Task
+	if task == nil {
+		t.Fatal("Ожидалась задача в потоке")
+	}
+	orchestrator.Manager.Drain()
+
+	// При остановке агент возвращает последний результат без освободившегося слота
+	result := &calculator.TaskResult{Id: task.Id, Result: 42, ExpressionId: exprID, LeaseId: task.LeaseId}
+	stream.in <- &calculator.AgentMessage{AgentId: 5, Capacity: 0, Result: result}
+	if ack := stream.receive(t).Ack; ack == nil || !ack.Success {
+		t.Fatalf("Ожидалось подтверждение результата, получено %+v", ack)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Поток должен завершиться без ошибки после последнего результата, получено: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Поток не закрылся после возврата всех задач при остановке")
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/GGmuzem/yandex-project/internal/database"
+	"github.com/GGmuzem/yandex-project/internal/orchestrator"
+	"github.com/GGmuzem/yandex-project/pkg/models"
+)
+
+func TestParseVariables(t *testing.T) {
+	vars := map[string]float64{"a": 2, "x": 3.5, "b": 1, "цена": 10, "unused": 7}
+
+	expr, tasks, err := orchestrator.NewExpressionWithVariables("a*x + b", vars)
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка разбора: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Arg1 != "2" || tasks[0].Arg2 != "3.5" || tasks[1].Arg2 != "1" {
+		t.Errorf("Переменные не подставлены в задачи: %+v", tasks)
+	}
+	if expr.Normalized != "a * x + b" {
+		t.Errorf("Каноническая запись %q", expr.Normalized)
+	}
+	// Сохраняются только использованные переменные
+	if !reflect.DeepEqual(expr.Variables, map[string]float64{"a": 2, "x": 3.5, "b": 1}) {
+		t.Errorf("Неожиданные переменные выражения: %v", expr.Variables)
+	}
+
+	// Выражение из одной переменной вычисляется сразу, переменные доступны и в функциях
+	expr, _, err = orchestrator.NewExpressionWithVariables("-цена", vars)
+	if err != nil || expr.Status != "completed" || expr.Result != -10 {
+		t.Errorf("Ожидалось completed/-10, получено %+v (%v)", expr, err)
+	}
+	_, tasks, err = orchestrator.NewExpressionWithVariables("max(a, x) ^ b", vars)
+	if err != nil || len(tasks) != 2 || !reflect.DeepEqual(tasks[0].Args, []string{"2", "3.5"}) {
+		t.Errorf("Переменные не подставлены в аргументы функции: %+v (%v)", tasks, err)
+	}
+
+	cases := []struct {
+		expr     string
+		vars     map[string]float64
+		kind     orchestrator.ParseErrorKind
+		position int
+	}{
+		{"a*x + c", vars, orchestrator.ErrKindUnknownIdentifier, 7},
+		{"a + 1", nil, orchestrator.ErrKindUnknownIdentifier, 1},
+		{"a(1)", vars, orchestrator.ErrKindUnknownFunction, 1},
+		{"x + 1", map[string]float64{"x": 1, "1y": 2}, orchestrator.ErrKindInvalidVariable, 0},
+		{"x + 1", map[string]float64{"x": 1, "sqrt": 2}, orchestrator.ErrKindInvalidVariable, 0},
+	}
+	for _, c := range cases {
+		_, _, err := orchestrator.NewExpressionWithVariables(c.expr, c.vars)
+		var parseErr *orchestrator.ParseError
+		if !errors.As(err, &parseErr) || parseErr.Kind != c.kind || parseErr.Position != c.position {
+			t.Errorf("%q %v: ожидалась ошибка %s в позиции %d, получено %v", c.expr, c.vars, c.kind, c.position, err)
+		}
+	}
+}
+
+func testVariables(t *testing.T, db database.Database) {
+	orchestrator.Quotas = orchestrator.NewQuotaTracker()
+	handlers := orchestrator.NewAuthHandlers(db)
+	token := loginToken(t, db, "pricing")
+	submit := func(req models.CalculateRequest) *httptest.ResponseRecorder {
+		return serveAPI(handlers.AuthMiddleware(handlers.CalculateWithAuthHandler), http.MethodPost, "/api/v1/calculate", token, req)
+	}
+
+	rr := submit(models.CalculateRequest{Expression: "a*x + b", Variables: map[string]float64{"a": 2, "x": 3.5, "b": 1}})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Выражение с переменными должно быть принято, получено %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = submit(models.CalculateRequest{Expression: "a*x + b", Variables: map[string]float64{"a": 3, "x": 0.5}})
+	var parseErr orchestrator.ParseError
+	json.NewDecoder(rr.Body).Decode(&parseErr)
+	if rr.Code != http.StatusUnprocessableEntity || parseErr.Kind != orchestrator.ErrKindUnknownIdentifier || parseErr.Token != "b" {
+		t.Errorf("Ожидался код 422 для незаданной переменной b, получено %d %+v", rr.Code, parseErr)
+	}
+
+	// История показывает, с какими значениями вычислялось выражение
+	var history struct {
+		Expressions []models.Expression `json:"expressions"`
+	}
+	code := apiRequest(t, handlers.AuthMiddleware(handlers.ListExpressionsWithAuthHandler), http.MethodGet, "/api/v1/expressions", token, nil, &history)
+	if code != http.StatusOK || len(history.Expressions) != 1 {
+		t.Fatalf("Ожидалось одно выражение в истории, получено %d %+v", code, history)
+	}
+	if got := history.Expressions[0].Variables; !reflect.DeepEqual(got, map[string]float64{"a": 2, "x": 3.5, "b": 1}) {
+		t.Errorf("Неожиданные переменные в истории: %v", got)
+	}
+}
+
+func TestCalculateWithVariables(t *testing.T) {
+	defer func() { orchestrator.Quotas = orchestrator.NewQuotaTracker() }()
+
+	forEachDB(t, testVariables)
+}
@@ -26,8 +26,7 @@ document.addEventListener('DOMContentLoaded', function() {
     if (logoutLink) {
         logoutLink.addEventListener('click', function(e) {
             e.preventDefault();
-            localStorage.removeItem('token');
-            window.location.href = '/';
+            logout();
         });
     }
     
@@ -40,4 +39,67 @@ document.addEventListener('DOMContentLoaded', function() {
             link.classList.add('active');
         }
     });
-}); 
\ No newline at end of file
+});
+
+// Обмен refresh токена на новую пару токенов. Возвращает false, если сессия завершена
+async function refreshAccessToken() {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) {
+        return false;
+    }
+
+    const response = await fetch('/api/v1/token/refresh', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ refresh_token: refreshToken })
+    });
+    if (!response.ok) {
+        localStorage.removeItem('token');
+        localStorage.removeItem('refreshToken');
+        return false;
+    }
+
+    const data = await response.json();
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refreshToken', data.refresh_token);
+    return true;
+}
+
+// Запрос к API с access токеном; при истекшем токене он обновляется и запрос повторяется
+async function authFetch(url, options = {}) {
+    const send = () => fetch(url, {
+        ...options,
+        headers: {
+            ...(options.headers || {}),
+            'Authorization': `Bearer ${localStorage.getItem('token')}`
+        }
+    });
+
+    const response = await send();
+    if (response.status === 401 && await refreshAccessToken()) {
+        return send();
+    }
+    return response;
+}
+
+// Выход: сессия завершается на сервере, затем токены удаляются из localStorage
+async function logout() {
+    const token = localStorage.getItem('token');
+    if (token) {
+        try {
+            await fetch('/api/v1/logout', {
+                method: 'POST',
+                headers: {
+                    'Authorization': `Bearer ${token}`
+                }
+            });
+        } catch (error) {
+            console.error('Logout error:', error);
+        }
+    }
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    window.location.href = '/';
+}